@@ -0,0 +1,54 @@
+package main
+
+import (
+	"fmt"
+
+	ntfs "github.com/corebreaker/ntfstool/core"
+	"github.com/corebreaker/ntfstool/inspect"
+)
+
+// Attribute definitions of the partition, or else the definitions of a volume formated by Windows.
+func get_attrdefs(disk *inspect.NtfsDisk) ntfs.AttrDefs {
+	if disk == nil {
+		fmt.Println("Warning: no partition is read, the default attribute definitions are used")
+
+		return ntfs.DefaultAttrDefs()
+	}
+
+	defs, err := disk.GetAttrDefs()
+	if err != nil {
+		fmt.Println("Warning: $AttrDef can not be read, the default attribute definitions are used:", err)
+
+		return ntfs.DefaultAttrDefs()
+	}
+
+	return defs
+}
+
+// Uses the definitions of $AttrDef to check the attributes of the MFT records read from the partition.
+func use_attrdefs(arg *tActionArg, disk *ntfs.DiskIO) {
+	defs, err := arg.disk.GetAttrDefs()
+	if err != nil {
+		fmt.Println("Warning: $AttrDef can not be read, the attributes are not checked:", err)
+
+		return
+	}
+
+	disk.SetAttrDefs(defs)
+	fmt.Println(fmt.Sprintf("Attributes checked with $AttrDef (%d definitions)", len(defs)))
+}
+
+func do_attrdef(arg *tActionArg) error {
+	defs, err := arg.disk.GetAttrDefs()
+	if err != nil {
+		return err
+	}
+
+	fmt.Println()
+	fmt.Println(fmt.Sprintf("Attribute definitions ($AttrDef, count= %d):", len(defs)))
+	for _, def := range defs.List() {
+		fmt.Println("  -", def)
+	}
+
+	return nil
+}
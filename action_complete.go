@@ -132,7 +132,7 @@ func do_complete(arg *tActionArg) error {
 		case inspect.STATE_RECORD_TYPE_FILE:
 			r := record.(*inspect.StateFileRecord)
 
-			if r.IsDir() {
+			if r.IsDir() && !r.IsExtension() {
 				mft := get_mft(r.MftId)
 				mft.dirs[r.Reference.GetFileIndex()] = r
 				if r.Header.MftRecordNumber == 5 {
@@ -151,6 +151,24 @@ func do_complete(arg *tActionArg) error {
 
 	fmt.Println("\rDone: 100 %")
 
+	fmt.Println("Merging extension records")
+	files, merged, orphans := inspect.MergeExtensions(files)
+	fmt.Println(fmt.Sprintf("Extension records merged: %d, without base record: %d", merged, orphans))
+
+	// The run list of an MFT can be in the extension records of its $MFT record
+	for _, file := range files {
+		mft, ok := mfts[file.MftId]
+		if (!ok) || (mft.state == nil) || (file.Position != mft.state.Position) || (len(file.Extensions) == 0) {
+			continue
+		}
+
+		for _, attr := range file.GetAttributes(ntfs.ATTR_DATA) {
+			if (attr.Header.NameLength == 0) && (len(attr.RunList) > len(mft.state.RunList)) {
+				mft.state.RunList = attr.RunList
+			}
+		}
+	}
+
 	// Gets root directories if not exist
 	for mftid, mft := range mfts {
 		if !mft.root.IsNull() {
@@ -159,8 +177,10 @@ func do_complete(arg *tActionArg) error {
 
 		var record ntfs.FileRecord
 
+		geometry := mft.state.GetGeometry()
+
 		arg.disk.SetStart(mft.state.PartOrigin)
-		arg.disk.SetMftShift(int64(mft.state.RunList[0].Start) * 4096)
+		arg.disk.SetMftShift(int64(mft.state.RunList[0].Start) * geometry.ClusterSize)
 
 		if err := arg.disk.ReadFileRecord(5, &record); err != nil {
 			return err
@@ -168,7 +188,7 @@ func do_complete(arg *tActionArg) error {
 
 		state := &inspect.StateFileRecord{
 			StateBase: inspect.StateBase{
-				Position: mft.state.PartOrigin + (int64(mft.state.RunList[0].Start) * 4096) + 5120,
+				Position: mft.state.GetStart() + (5 * geometry.RecordSize),
 				MftId:    mftid,
 			},
 			Header: record,
@@ -213,6 +233,8 @@ func do_complete(arg *tActionArg) error {
 			parent := data.FileRef(0)
 			fname := ""
 
+			var links []*inspect.StateLink
+
 			for _, attr := range file.Attributes {
 				if attr.Header.AttributeType != ntfs.ATTR_FILE_NAME {
 					continue
@@ -244,11 +266,22 @@ func do_complete(arg *tActionArg) error {
 				}
 
 				file.Names = append(file.Names, name)
+
+				if !attr_val.IsShortName() {
+					links = append(links, &inspect.StateLink{Name: name, Parent: attr_val.GetParent()})
+				}
 			}
 
 			file.Parent = parent
 			file.Name = fname
 
+			// The other names are the hard links of the file
+			for _, link := range links {
+				if (link.Name != fname) || (link.Parent != parent) {
+					file.Links = append(file.Links, link)
+				}
+			}
+
 			return nil
 		}()
 
@@ -352,9 +385,23 @@ func do_complete(arg *tActionArg) error {
 			}
 		}
 
-		if len(file.Name) > 0 {
-			records = append(records, file)
+		if len(file.Name) == 0 {
+			continue
 		}
+
+		// The links in a directory which has been reused by another directory are lost
+		links := make([]*inspect.StateLink, 0, len(file.Links))
+		for _, link := range file.Links {
+			parent, ok := mft.dirs[link.Parent.GetFileIndex()]
+			if ok && (parent.Header.SequenceNumber != link.Parent.GetSequenceNumber()) {
+				continue
+			}
+
+			links = append(links, link)
+		}
+
+		file.Links = links
+		records = append(records, file)
 	}
 
 	fmt.Println("\rDone: 100 %")
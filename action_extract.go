@@ -3,6 +3,8 @@ package main
 import (
 	"fmt"
 	"os"
+	"path"
+	"path/filepath"
 	"strings"
 
 	ntfs "github.com/corebreaker/ntfstool/core"
@@ -72,6 +74,40 @@ func do_show_id(id string, arg *tActionArg) error {
 	fmt.Println("Is File?=", file.IsFile())
 	fmt.Println("Is Root?=", file.IsRoot())
 
+	if f := file.GetFile(); (f != nil) && (f.Reparse != nil) {
+		fmt.Println("Reparse= ", f.Reparse)
+	}
+
+	if f := file.GetFile(); (f != nil) && !f.IsRoot() {
+		paths, err := files.GetFilePaths(f)
+		if err != nil {
+			return err
+		}
+
+		fmt.Println()
+		fmt.Println("Paths:")
+		for _, path := range paths {
+			fmt.Println("  -", path)
+		}
+	}
+
+	if f := file.GetFile(); (f != nil) && (f.Security != nil) {
+		fmt.Println("Owner=   ", f.Security.GetOwner())
+		fmt.Println()
+		fmt.Println("Security:")
+		for _, line := range f.Security.GetDescriptor().Lines() {
+			fmt.Println("  ", line)
+		}
+	}
+
+	if f := file.GetFile(); (f != nil) && (len(f.Streams) > 0) {
+		fmt.Println()
+		fmt.Println("Streams:")
+		for _, stream := range f.Streams {
+			fmt.Println("  -", stream)
+		}
+	}
+
 	fmt.Println()
 	fmt.Println("Record:")
 	file.Print()
@@ -180,7 +216,7 @@ func do_list_files(node_pattern string, arg *tActionArg) error {
 	msg := "Results:"
 
 	if node_pattern != "" {
-		matcher, err := parseNodePattern(node_pattern, tree)
+		matcher, err := parseNodePattern(node_pattern, tree, get_pattern_upcase(arg))
 		if err != nil {
 			return err
 		}
@@ -232,7 +268,32 @@ func do_list_files(node_pattern string, arg *tActionArg) error {
 		}
 
 		if n.IsFile() {
-			infos += ", File"
+			if n.File.Resident {
+				infos += fmt.Sprintf(", File {size=%d, resident}", n.File.Size)
+			} else {
+				infos += fmt.Sprintf(", File {size=%d, allocated=%d}", n.File.Size, n.File.Allocated)
+			}
+		}
+
+		if n.File.Reparse != nil {
+			infos += fmt.Sprintf(", Reparse {%s}", n.File.Reparse)
+		}
+
+		if n.File.Security != nil {
+			infos += fmt.Sprintf(", Owner {%s}", n.File.Security.GetOwner())
+		}
+
+		if len(n.File.Streams) > 0 {
+			names := make([]string, len(n.File.Streams))
+			for i, stream := range n.File.Streams {
+				names[i] = stream.String()
+			}
+
+			infos += fmt.Sprintf(", Streams {%s}", strings.Join(names, "; "))
+		}
+
+		if len(n.File.Links) > 0 {
+			infos += fmt.Sprintf(", Links {%s}", strings.Join(tree.GetFilePaths(n.File)[1:], "; "))
 		}
 
 		fmt.Println(fmt.Sprintf("   - %s (%s)", n.File.Id, infos))
@@ -285,7 +346,66 @@ func do_save_file(file string, arg *tActionArg) error {
 	_, noempty := arg.GetExt("noempty")
 	_, nometa := arg.GetExt("nometa")
 
-	_, err = extract.SaveNode(disk, node, destname, noempty, nometa)
+	stream_mode, _ := arg.GetExt("streams")
+	streams, err := extract.ParseStreamMode(stream_mode)
+	if err != nil {
+		return err
+	}
+
+	stream_name, _ := arg.GetExt("stream-name")
+	_, symlinks := arg.GetExt("symlinks")
+	_, acls := arg.GetExt("acls")
+
+	hardlink_mode, _ := arg.GetExt("hardlinks")
+	hardlinks, err := extract.ParseHardLinkMode(hardlink_mode)
+	if err != nil {
+		return err
+	}
+
+	manifest_name, has_manifest := arg.GetExt("manifest")
+	if !has_manifest || (len(manifest_name) == 0) {
+		manifest_name = filepath.Join(destname, extract.DEFAULT_MANIFEST_NAME)
+	}
+
+	manifest, err := extract.MakeManifest(manifest_name)
+	if err != nil {
+		return err
+	}
+
+	options := &extract.SaveOptions{
+		NoEmpty:    noempty,
+		NoMeta:     nometa,
+		Streams:    streams,
+		StreamName: stream_name,
+		Symlinks:   symlinks,
+		LinkRoot:   destname,
+		LinkPrefix: path.Dir(tree.GetNodePath(node)),
+		LinkDrive:  strings.TrimSuffix(arg.GetDef("drive", extract.DEFAULT_LINK_DRIVE), ":"),
+		Acls:       acls,
+		Manifest:   manifest,
+		HardLinks:  hardlinks,
+	}
 
-	return err
+	report := new(extract.SaveReport)
+	if _, err = extract.SaveNode(disk, node, destname, options, report); err != nil {
+		manifest.Close()
+
+		return err
+	}
+
+	if err := extract.SaveHardLinks(disk, options, report); err != nil {
+		manifest.Close()
+
+		return err
+	}
+
+	if err := manifest.Close(); err != nil {
+		return err
+	}
+
+	fmt.Println("Metadata manifest:", manifest_name)
+
+	report.Print()
+
+	return nil
 }
@@ -1,7 +1,9 @@
 package main
 
 import (
+	"errors"
 	"fmt"
+	"io"
 	"os"
 	"sort"
 	"syscall"
@@ -9,6 +11,11 @@ import (
 	ntfs "github.com/corebreaker/ntfstool/core"
 )
 
+// Maximal size of the content read to show a non-resident attribute.
+const FILE_NUM_PREVIEW_SIZE = 1024 * 1024
+
+var wof_preview_end = errors.New("End of the preview")
+
 func do_file_num(file int64, arg *tActionArg) error {
 	var record ntfs.FileRecord
 
@@ -26,6 +33,12 @@ func do_file_num(file int64, arg *tActionArg) error {
 		return nil
 	}
 
+	// The custom attribute types are named by $AttrDef
+	defs, err := arg.disk.GetAttrDefs()
+	if err != nil {
+		defs = nil
+	}
+
 	_, ok := arg.GetExt("data")
 	if ok {
 		fmt.Println()
@@ -45,21 +58,20 @@ func do_file_num(file int64, arg *tActionArg) error {
 
 	_, ok = arg.GetExt("name")
 	if ok {
-		for _, attr := range attributes {
-			if attr.AttributeType == ntfs.ATTR_FILE_NAME {
-				desc, err := record.MakeAttributeFromHeader(attr)
-				if err != nil {
-					return err
-				}
-
-				val, err := arg.disk.GetAttributeValue(desc, true)
-				if err != nil {
-					return err
-				}
+		// The names can be in the extension records
+		names, err := arg.disk.GetFileAttributes(&record, ntfs.ATTR_FILE_NAME)
+		if err != nil {
+			return err
+		}
 
-				fmt.Println()
-				fmt.Println("Filename:", val.GetFilename())
+		for _, desc := range names {
+			val, err := arg.disk.GetAttributeValue(desc, true)
+			if err != nil {
+				return err
 			}
+
+			fmt.Println()
+			fmt.Println("Filename:", val.GetFilename())
 		}
 	}
 
@@ -192,6 +204,10 @@ func do_file_num(file int64, arg *tActionArg) error {
 			return err
 		}
 
+		if err := merge_extents(arg, &record, desc); err != nil {
+			return err
+		}
+
 		fmt.Println()
 		fmt.Println("Attribute:")
 		ntfs.PrintStruct(desc.Desc)
@@ -202,7 +218,15 @@ func do_file_num(file int64, arg *tActionArg) error {
 		_, noread := arg.GetExt("noread")
 		_, ask_runlist := arg.GetExt("runlist")
 
-		val, err := arg.disk.GetAttributeValue(desc, !(noread || ask_runlist))
+		var val *ntfs.AttributeValue
+
+		// Only the start of a non-resident content is read, the whole content is read for the save
+		if noread || ask_runlist {
+			val, err = arg.disk.GetAttributeValue(desc, false)
+		} else {
+			val, err = arg.disk.GetAttributePreview(desc, FILE_NUM_PREVIEW_SIZE)
+		}
+
 		if err != nil {
 			return err
 		}
@@ -211,6 +235,9 @@ func do_file_num(file int64, arg *tActionArg) error {
 		fmt.Println(fmt.Sprintf("Value (size=%d):", val.Size))
 		ntfs.PrintStruct(val.Value)
 		fmt.Println("   First LCN:", val.FirstLCN)
+		if (val.Content != nil) && (len(val.Content) < val.Size) {
+			fmt.Println("   Preview size:", len(val.Content))
+		}
 
 		if ask_runlist {
 			fmt.Println()
@@ -222,6 +249,38 @@ func do_file_num(file int64, arg *tActionArg) error {
 			return nil
 		}
 
+		// The compressed stream of a WOF compressed file is shown and saved decompressed
+		is_wof := false
+		if (desc.Name == ntfs.WOF_STREAM_NAME) && (val.Content != nil) {
+			var content []byte
+
+			format, size, ok, err := read_wof_content(arg, &record, desc, func(data []byte) error {
+				if remain := FILE_NUM_PREVIEW_SIZE - len(content); remain < len(data) {
+					content = append(content, data[:remain]...)
+
+					return wof_preview_end
+				}
+
+				content = append(content, data...)
+
+				return nil
+			})
+
+			if err != nil {
+				fmt.Println()
+				fmt.Println("Warning: the WOF compressed content can not be decompressed:", ntfs.GetSource(err))
+			} else if ok {
+				fmt.Println()
+				fmt.Println(fmt.Sprintf("WOF compressed content (%s), decompressed size= %d", format, size))
+				if len(content) < int(size) {
+					fmt.Println("   Preview size:", len(content))
+				}
+
+				val.Content, val.Data, val.Size = content, content, int(size)
+				is_wof = true
+			}
+		}
+
 		if _, value := arg.GetExt("value"); value {
 			fmt.Println()
 			fmt.Println("Content:")
@@ -293,10 +352,28 @@ func do_file_num(file int64, arg *tActionArg) error {
 			defer ntfs.DeferedCall(f.Close)
 
 			fmt.Println()
-			fmt.Println("Header size:", val.Size-len(val.Data))
+			fmt.Println("Header size:", len(val.Content)-len(val.Data))
+
+			if is_wof {
+				_, _, _, err := read_wof_content(arg, &record, desc, func(data []byte) error {
+					_, err := f.Write(data)
+
+					return ntfs.WrapError(err)
+				})
+
+				return err
+			}
 
-			_, err = f.Write(val.Content)
+			if val.Content == nil {
+				return nil
+			}
+
+			reader, err := desc.GetReader(arg.disk.GetDisk())
 			if err != nil {
+				return err
+			}
+
+			if _, err := io.Copy(f, reader); err != nil {
 				return ntfs.WrapError(err)
 			}
 		}
@@ -317,6 +394,9 @@ func do_file_num(file int64, arg *tActionArg) error {
 		fmt.Println()
 		fmt.Println(fmt.Sprintf("Attribute %d :", idx))
 		ntfs.PrintStruct(attr)
+		if name := defs.GetTypeName(attr.AttributeType); name != attr.AttributeType.String() {
+			fmt.Println("   Type name:", name)
+		}
 
 		desc, err := record.MakeAttributeFromHeader(attr)
 		if err != nil {
@@ -328,5 +408,102 @@ func do_file_num(file int64, arg *tActionArg) error {
 		}
 	}
 
+	entries, err := arg.disk.GetAttributeList(&record)
+	if err != nil {
+		return err
+	}
+
+	if len(entries) > 0 {
+		fmt.Println()
+		fmt.Println("Attribute list:")
+		for _, entry := range entries {
+			fmt.Println("  -", entry)
+		}
+	}
+
+	security, security_id, err := arg.disk.GetFileSecurity(&record)
+	if err != nil {
+		fmt.Println()
+		fmt.Println("Warning: the security descriptor can not be read:", ntfs.GetSource(err))
+	} else if security != nil {
+		fmt.Println()
+		fmt.Println(fmt.Sprintf("Security (ID= %d):", security_id))
+		for _, line := range security.Lines() {
+			fmt.Println("  ", line)
+		}
+	}
+
+	return nil
+}
+
+// The run list of an attribute in several extents is merged from the extension records.
+func merge_extents(arg *tActionArg, record *ntfs.FileRecord, desc *ntfs.AttributeDesc) error {
+	if desc.NonResidentDesc() == nil {
+		return nil
+	}
+
+	attrs, err := arg.disk.GetFileAttributes(record, desc.Header.AttributeType)
+	if err != nil {
+		return err
+	}
+
+	for _, attr := range attrs {
+		if (attr.Record == desc.Record) && (attr.Index == desc.Index) {
+			desc.RunList = attr.GetRunList()
+		}
+	}
+
 	return nil
 }
+
+// Decompresses the content of a WOF compressed file, it returns the decompressed size and false if the file has no WOF reparse point.
+func read_wof_content(arg *tActionArg, record *ntfs.FileRecord, desc *ntfs.AttributeDesc, write func([]byte) error) (ntfs.WofFormat, int64, bool, error) {
+	attrs, err := arg.disk.GetFileAttributes(record, ntfs.ATTR_REPARSE_POINT, ntfs.ATTR_DATA)
+	if err != nil {
+		return 0, 0, false, err
+	}
+
+	var point *ntfs.ReparsePoint
+
+	size := int64(-1)
+
+	for _, attr := range attrs {
+		switch attr.Header.AttributeType {
+		case ntfs.ATTR_REPARSE_POINT:
+			val, err := arg.disk.GetAttributeValue(attr, true)
+			if (err != nil) || (val == nil) {
+				return 0, 0, false, err
+			}
+
+			if point, err = ntfs.ParseReparsePoint(val.Content); err != nil {
+				return 0, 0, false, err
+			}
+
+		case ntfs.ATTR_DATA:
+			if attr.Name == "" {
+				size = int64(attr.GetSize())
+			}
+		}
+	}
+
+	if (point == nil) || (point.Tag != ntfs.IO_REPARSE_TAG_WOF) || (size < 0) {
+		return 0, 0, false, nil
+	}
+
+	format, err := ntfs.GetWofFormat(point)
+	if err != nil {
+		return 0, 0, false, err
+	}
+
+	compressed, err := desc.GetReader(arg.disk.GetDisk())
+	if err != nil {
+		return 0, 0, false, err
+	}
+
+	err = ntfs.DecompressWof(compressed, compressed.Size(), format, size, write)
+	if (err != nil) && (err != wof_preview_end) {
+		return 0, 0, false, err
+	}
+
+	return format, size, true, nil
+}
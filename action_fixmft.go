@@ -64,6 +64,8 @@ func do_fixmft(verbose bool, arg *tActionArg) error {
 		return nil
 	}
 
+	geometry := arg.disk.GetGeometry()
+
 	fmt.Println("Finding MFTs")
 	for item := range stream {
 		fmt.Printf("\rDone: %d %%", 100*i/cnt)
@@ -85,6 +87,29 @@ func do_fixmft(verbose bool, arg *tActionArg) error {
 			file_pos := file_state.Position
 			is_dir := file_state.IsDir()
 
+			// The extension records have no name, they are kept to be merged with their base records
+			if file_state.IsExtension() {
+				mft, found := tables[file_pos]
+				if !found {
+					pendings[file_pos] = tPending{
+						state: file_state,
+						mft:   currentMft,
+					}
+
+					continue
+				}
+
+				if err := fix(file_state, mft); err != nil {
+					return err
+				}
+
+				if !file_state.Reference.IsNull() {
+					records = append(records, state)
+				}
+
+				continue
+			}
+
 			attr_list := file_state.GetAttributes(ntfs.ATTR_FILE_NAME, ntfs.ATTR_DATA, ntfs.ATTR_INDEX_ROOT)
 			switch len(attr_list) {
 			case 0, 1:
@@ -143,7 +168,7 @@ func do_fixmft(verbose bool, arg *tActionArg) error {
 					}
 
 					mft_rec_num--
-					mft_pos -= 1024
+					mft_pos -= geometry.RecordSize
 					fallthrough
 
 				case "$LogFile":
@@ -152,7 +177,7 @@ func do_fixmft(verbose bool, arg *tActionArg) error {
 					}
 
 					mft_rec_num--
-					mft_pos -= 1024
+					mft_pos -= geometry.RecordSize
 					fallthrough
 
 				case "$MFTMirr":
@@ -161,7 +186,7 @@ func do_fixmft(verbose bool, arg *tActionArg) error {
 					}
 
 					mft_rec_num--
-					mft_pos -= 1024
+					mft_pos -= geometry.RecordSize
 					fallthrough
 
 				case "$MFT":
@@ -175,7 +200,7 @@ func do_fixmft(verbose bool, arg *tActionArg) error {
 						disk := arg.disk.GetDisk()
 						defer disk.Close()
 
-						disk.SetOffset(mft_pos + 4096)
+						disk.SetOffset(mft_pos + (4 * geometry.RecordSize))
 
 						return disk.ReadStruct(0, &record)
 					}()
@@ -235,7 +260,7 @@ func do_fixmft(verbose bool, arg *tActionArg) error {
 						return err
 					}
 
-					disk.SetOffset(mft_pos + 1024)
+					disk.SetOffset(mft_pos + geometry.RecordSize)
 					if err := disk.ReadStruct(0, &record1); err != nil {
 						return err
 					}
@@ -260,7 +285,7 @@ func do_fixmft(verbose bool, arg *tActionArg) error {
 
 					rl0, rl1 := attr0.GetRunList(), attr1.GetRunList()
 
-					pos0, pos1 := int64(rl0[0].Start*0x1000), int64(rl1[0].Start*0x1000)
+					pos0, pos1 := int64(rl0[0].Start)*geometry.ClusterSize, int64(rl1[0].Start)*geometry.ClusterSize
 					origin := mft_pos - pos1
 					mft_pos += pos0 - pos1
 
@@ -346,7 +371,7 @@ func do_fixmft(verbose bool, arg *tActionArg) error {
 						},
 						Header:     mft_state.Header,
 						RunList:    data_attr.RunList,
-						PartOrigin: mft_pos - int64(data_attr.RunList[0].Start*0x1000),
+						PartOrigin: mft_pos - (int64(data_attr.RunList[0].Start) * geometry.ClusterSize),
 					}
 
 					ok, err := arg.disk.InitState(mft)
@@ -363,10 +388,10 @@ func do_fixmft(verbose bool, arg *tActionArg) error {
 							continue
 						}
 
-						pos_beg := mft.PartOrigin + int64(run.Start*0x1000)
-						pos_end := pos_beg + (run.Count * 0x1000)
+						pos_beg := mft.PartOrigin + (int64(run.Start) * geometry.ClusterSize)
+						pos_end := pos_beg + (run.Count * geometry.ClusterSize)
 
-						for position := pos_beg; position < pos_end; position += 1024 {
+						for position := pos_beg; position < pos_end; position += geometry.RecordSize {
 							prev, exists := tables[position]
 							if exists {
 								const msg = "  - Warning: MFT %s use position %d that has already used by MFT %s."
@@ -11,6 +11,8 @@ func do_help(arg *tActionArg) error {
 	fmt.Println("Usage:", os.Args[0], "partition parameters")
 	fmt.Println()
 	fmt.Println("  partition  =", _HELP_PARTITION_DESC)
+	fmt.Println("               or `@path` for an image file: raw, split raw (`disk.001`, `disk.002`, …), EWF (`disk.E01`),")
+	fmt.Println("               or a virtual machine disk (VHD, VHDX, VMDK, qcow2), differencing disks are read through their parents")
 	fmt.Println("  parameters = space separated list of parameters formated as following:")
 	fmt.Println("     - `name=value` for a parameter with a value, `name` is the parameter name")
 	fmt.Println("     - `name` for a parameter without any value")
@@ -23,8 +25,22 @@ Some parameters configures commands. This is the list of command configurators:
   - file=pathname:   specifies a input/output file for others commands
   - mft=offset:      specifies the MFT shift from the partition starting with an offset in the partition
   - start=offset:    specifies the offset in the partition where the readind starts (partition start)
+  - cache=size:      enables a cluster cache of ` + "`size`" + ` bytes (units: K, M, G), ie: cache=256M
+  - read-ahead=n:    count of clusters read ahead by the cache on sequential reads (default: 8)
+  - rescue:          enables the fault-tolerant reads: bad sectors are retried, then zero-filled
+  - retries=n:       count of retries of a failed read before it is done sector by sector (default: 3)
+  - errmap=pathname: map file of the bad ranges (ddrescue format), known bad ranges are skipped on later runs
+  - lenient:         keeps the readable sectors of the torn MFT and index records (the torn sectors are zero-filled),
+                     without it, the torn records are rejected
+  - overlay=pathname: enables a copy-on-write overlay: the writes go into the sparse delta file ` + "`pathname`" + `,
+                     the written areas are listed in ` + "`pathname.map`" + `, the source is never modified
+  - part=n:          selects the partition number ` + "`n`" + ` of a whole disk (MBR or GPT) as partition start
   - from=file-id:    specifies a file ID or a directorry ID for others commands
   - to=dest:         specifies a ` + "`dest`" + ` file or directory pathname for others commands
+  - sector-size=n:   overrides the sector size read from the boot sector
+  - cluster-size=n:  overrides the cluster size read from the boot sector
+  - record-size=n:   overrides the MFT file record size read from the boot sector
+  - index-size=n:    overrides the index block size read from the boot sector
 
 Some parameters are commands.
 For input and output files, there are 2 file formats (used for file recovery:
@@ -40,7 +56,15 @@ Commands to inspect the partition:
   - record=offset:   shows MFT record read from partition with an offset in MFT
   - sector=offset:   shows the sector with its offset in the partition
   - cluster=offset:  shows the cluster with its offset in the partition
-  - file-num=number: inspects file records in MFT from the partition
+  - file-num=number: inspects file records in MFT from the partition, with the $ATTRIBUTE_LIST entries,
+                     the attributes in extension records are followed, the WofCompressedData stream of a WOF compressed
+                     file is shown and saved decompressed, the security descriptor (owner, group and DACL)
+                     is read inline or from $Secure, only the first MiB of a content is shown, the whole content is saved
+  - partitions:      lists the partitions of a whole disk with their type, offset, size and filesystem
+  - alloc-stats:     shows the statistics of the cluster allocation read from $Bitmap
+  - attrdef:         shows the attribute definitions read from $AttrDef (names, sizes, flags)
+  - lookup=path:     finds a file from its path (ie: /Users/name/file.txt) with the indexes of the directories,
+                     the names are compared without case with the $UpCase table of the partition, as Windows does
 
 Commands to explore the input file:
   - record-count:    shows count of file records in the input file with a file node format
@@ -54,30 +78,73 @@ Commands to explore the input file:
   - at=offset:       shows the record in the input file at the specified file position (offset)
   - find-state:      find a record in the input file in state format
   - show-attr=attr   shows the attribute from its position for a state file record in the input file
-  - check:           checks the integrity of data structures in the input file in the state format
+  - check:           checks the integrity of data structures in the input file in the state format,
+                     the torn records are reported in any mode, the records of the input file (ie: from ` + "`scan`" + `) are read
+                     again from the partition, as ` + "`fill`" + ` does not keep them without the lenient option, the attributes are checked
+                     against the $AttrDef of the partition (or else the definitions of Windows)
   - compact:         compacts the input file
 
 Commands to explore or modify a file in file node format:
-  - id=file-id:      shows the record with file ID in the input file in file node format
+  - id=file-id:      shows the record with file ID in the input file in file node format, with its alternate data streams, its reparse point and its owner,
+                     and the paths of all its hard links
   - parent=file-id:  shows children files of file ID in the input file in file node format
   - parent-ref=idx:  shows children files of file index in the input file in file node format
-  - ls[=nodes]:      list files in directory from the input file
+  - ls[=nodes]:      list files in directory from the input file, with the logical and the allocated sizes of the files
+                     and their alternate data streams, reparse points (link targets), owners and the paths of their other hard links
   - mv=nodes:        moves file nodes to a directory from input file
-  - cp=nodes:        copies file nodes to a directory from input file
+  - cp=nodes:        copies file nodes to a directory from input file, the copies have no other hard links
   - rm=nodes:        copies file nodes to a directory from input file
   - mkdir=name:      create a directory to a directory from input file
 
 Commands for file recovery:
-  - scan:            scans the partition to find MFTs and MFT records and report them to the output file
-  - fill:            fill data info from the input file into the output file (in the state format)
+  - image=pathname:  copies the partition (or the whole disk) into a raw image file before any recovery,
+                     a fast copy is done first, then the skipped areas are read sector by sector and retried
+                     (` + "`retries`" + ` times), the progress is kept in ` + "`pathname.map`" + ` to resume an interrupted imaging,
+                     the SHA-256 hash of the image is written into ` + "`pathname.sha256`" + `,
+                     options: sparse (zero blocks are not written), block-size=size (default: 64K)
+  - scan:            scans the partition to find MFTs and MFT records and report them to the output file,
+                     with the ` + "`unallocated`" + ` option, only the clusters free in $Bitmap are scanned
+  - rebuild-boot:    derives a boot sector from the MFT records of the input file (from ` + "`scan`" + `) when the primary
+                     and the backup boot sectors are both lost, it is written into the output file (default: boot_sector.dat),
+                     never into the partition, but it is also written into the overlay if one is enabled
+  - overlay-list:    lists the areas written in the overlay
+  - overlay-diff[=true]: shows the areas of the overlay which differ from the source, with ` + "`true`" + ` their bytes are dumped
+  - overlay-export=pathname: copies the source patched with the overlay into a raw image file
+  - fill:            fill data info from the input file into the output file (in the state format),
+                     the records whose sector trailers do not match their update sequence number are reported as torn,
+                     the attributes not following $AttrDef (types, sizes, residency) are rejected and reported, their records are kept
   - fix-mft:         fixes MFT entries from the input file into the output file (in the state format)
-  - complete:        completes datas from the input file into the output file (in the state format)
-  - make-filelist:   builds the file list from the input file (states) into the output file (file nodes)
-  - save=file-id:    copy file from partition into the output file with the help of the input file
+  - complete:        completes datas from the input file into the output file (in the state format),
+                     the attributes of the extension records are merged into their base records, every name of a file
+                     (except the DOS names) is kept, the other names than the file name are its hard links
+  - make-filelist:   builds the file list from the input file (states) into the output file (file nodes),
+                     the named $DATA attributes are kept as alternate data streams, the security descriptors are read
+                     from $Secure ($SDS with the index $SII) or from the files, the timestamps of $STANDARD_INFORMATION
+                     and $FILE_NAME and the DOS attributes are kept, the content of the small files stored in their
+                     MFT record (resident $DATA) is kept in the file list, with the hard links of the files
+  - save=file-id:    copy file from partition into the output file with the help of the input file,
+                     files with zero-filled regions (unreadable sectors) are reported,
+                     the NTFS-compressed files (LZNT1) and the WOF compressed files (XPRESS4K/8K/16K, LZX)
+                     are decompressed, the small files are written from their MFT record, the sparse runs are left as holes
+                     in the saved files, and the saved and allocated sizes are summarized,
+                     options: streams=sidecar|xattr|none (default: sidecar), the alternate data streams are saved
+                     as sidecar files or as user extended attributes (Linux only, the streams over 64 KiB are saved as sidecar files),
+                     stream-name=format for the name of the sidecar files (default: {file}:{stream}),
+                     symlinks: the symbolic links, the junctions and the application execution aliases are saved
+                     as symbolic links, the absolute targets are rewritten into the output directory (which stands for
+                     the parent directory of the saved file in the volume), the targets outside the saved tree are not saved,
+                     drive=letter (default: C): the drive letter of the volume, the targets on another drive or on another
+                     volume are not saved,
+                     acls: the owner, the group and the DACL of each file are written into a sidecar file {file}.acl,
+                     the modification and access times are applied to the saved files and directories, all the times
+                     and the DOS attributes (read-only, hidden, system, ...) are written into a metadata manifest,
+                     manifest=pathname (default: ntfstool-manifest.csv in the output directory),
+                     hardlinks=link|copy|none (default: link), the other hard links of the saved files are made
+                     as hard links (or as copies when a hard link can not be made) or as copies, only in the saved directories
 
-Offset has unit suffixes:
+Offset has unit suffixes (sizes come from the boot sector, 512 bytes sectors and 4Ko clusters by default):
   - c = clusters, example: 2c = 2 clusters
-  - s = sectors, example: 4s = 4 sectors (2Ko)
+  - s = sectors, example: 4s = 4 sectors
 
 ` + "`nodes`" + ` values are a node query in the file node input file,
 it is a comma separated list of node expressions:
@@ -85,8 +152,15 @@ nodes = expression[,expression[,...]]
 
 A node expression is either an ID prefixed with ` + "`@`" + ` (ie: @ffbb5d4c2afe41e8949117d8743af40d),
 either a "glob" expression (cf: http://github.com/gobwas/glob).
+A glob matches the names and the paths of all the hard links of the files.
+An expression prefixed with ` + "`owner:`" + ` is a glob on the SID or the name of a well-known owner
+(ie: owner:S-1-5-21-*-1001, owner:Administrators), it restricts the files matched by the other expressions.
+With the ` + "`nocase`" + ` option, the globs match the names without case, as NTFS compares them ($UpCase of the partition
+for ` + "`save`" + `, or else a built-in table).
+The names of a directory are always compared without case to find the duplicate names (` + "`make-filelist`" + `, ` + "`check`" + `,
+` + "`mv`" + `, ` + "`cp`" + `, ` + "`mkdir`" + `).
 `)
-	fmt.Println("Show the content of the MBR:", prog, "(with no parameter)")
+	fmt.Println("Show the boot sector or the partition table:", prog, "(with no parameter)")
 	fmt.Println()
 	fmt.Println("For inspecting file records in MFT from partition:")
 	fmt.Println("  -", prog, "mft=2c file-num=0 raw")
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+
+	ntfs "github.com/corebreaker/ntfstool/core"
+)
+
+func do_image(dest string, arg *tActionArg) error {
+	if len(dest) == 0 {
+		return ntfs.WrapError(fmt.Errorf("No image file specified"))
+	}
+
+	partition, err := arg.GetPartition()
+	if err != nil {
+		return err
+	}
+
+	// No cache and no fault-tolerant reads here, the imaging handles the bad sectors itself
+	transforms := make([]ntfs.SourceTransform, 0)
+	if partition != nil {
+		transforms = append(transforms, ntfs.WindowTransform(partition.Start, partition.Size))
+	}
+
+	disk, err := ntfs.OpenDisk(arg.partition, transforms...)
+	if err != nil {
+		return err
+	}
+
+	defer ntfs.DeferedCall(disk.Close)
+
+	block_size, _, err := arg._args.SizeFull("block-size")
+	if err != nil {
+		return err
+	}
+
+	rescue, err := ntfs.LoadRescueMap(dest + ".map")
+	if err != nil {
+		return err
+	}
+
+	if position, pass := rescue.GetCurrent(); len(rescue.GetRanges()) > 0 {
+		fmt.Println(fmt.Sprintf("Resuming the imaging at pass %d, position %d", pass, position))
+	}
+
+	release := on_interrupt(func() {
+		fmt.Println()
+		fmt.Println("Imaging interrupted, saving the map file:", rescue.GetPath())
+		ntfs.PrintError(rescue.Save())
+		fmt.Println("Run the same command to resume the imaging")
+	})
+
+	defer release()
+
+	_, sparse := arg.GetExt("sparse")
+
+	options := ntfs.ImageOptions{
+		BlockSize: block_size,
+		Retries:   int(arg.IntDef("retries", ntfs.DEFAULT_RETRIES)),
+		Sparse:    sparse,
+	}
+
+	fmt.Println("Imaging into:", dest)
+	result, err := ntfs.CreateImage(disk, dest, rescue, options)
+	if err != nil {
+		ntfs.PrintError(rescue.Save())
+
+		return err
+	}
+
+	if err := rescue.Save(); err != nil {
+		return err
+	}
+
+	fmt.Println("Image:", result)
+	if result.Bad > 0 {
+		fmt.Println(fmt.Sprintf("Warning: %d bytes could not be read, they are zero-filled in the image", result.Bad))
+	}
+
+	return nil
+}
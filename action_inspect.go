@@ -3,6 +3,7 @@ package main
 import (
 	"fmt"
 	"os"
+	"sort"
 
 	ntfs "github.com/corebreaker/ntfstool/core"
 	"github.com/corebreaker/ntfstool/core/data"
@@ -27,6 +28,8 @@ func do_fillinfo(arg *tActionArg) error {
 	disk := arg.disk.GetDisk()
 	defer ntfs.DeferedCall(disk.Close)
 
+	use_attrdefs(arg, disk)
+
 	stream, err := states.MakeStream()
 	if err != nil {
 		return err
@@ -45,6 +48,9 @@ func do_fillinfo(arg *tActionArg) error {
 	idx_count, idx_good := 0, 0
 	resident_datas, external_names := 0, 0
 	no_name, no_data := 0, 0
+	torn_kept, torn_rejected := 0, 0
+	extensions := 0
+	rejected_attributes := make([]string, 0)
 
 	fmt.Println(fmt.Sprintf("Filling (count= %d)", cnt))
 	for item := range stream {
@@ -73,10 +79,44 @@ func do_fillinfo(arg *tActionArg) error {
 			return err
 		}
 
+		// The record is kept without the attributes which do not follow $AttrDef
+		if rec, is_file := state.(*inspect.StateFileRecord); is_file && (len(rec.Rejected) > 0) {
+			positions := make([]int, 0, len(rec.Rejected))
+			for pos := range rec.Rejected {
+				positions = append(positions, pos)
+			}
+
+			sort.Ints(positions)
+			for _, pos := range positions {
+				position := rec.Position + int64(rec.Header.PrefixSize()+pos)
+				msg := fmt.Sprintf("  - Rejected attribute at %d [record at %d]: %v", position, rec.Position, ntfs.GetSource(rec.Rejected[pos]))
+				rejected_attributes = append(rejected_attributes, msg)
+			}
+		}
+
+		if torn := state.GetTornSectors(); len(torn) > 0 {
+			if ok {
+				torn_kept++
+			} else {
+				torn_rejected++
+			}
+		}
+
 		if ok {
 			if rectyp == inspect.STATE_RECORD_TYPE_FILE {
 				rec := state.(*inspect.StateFileRecord)
 
+				// The data and the names of an extension record are the ones of its base record
+				if rec.IsExtension() {
+					extensions++
+
+					if err := writer.Write(state); err != nil {
+						return err
+					}
+
+					continue
+				}
+
 				if rec.IsDir() {
 					attrs := rec.GetAttributes(ntfs.ATTR_INDEX_ROOT)
 					if len(attrs) == 0 {
@@ -151,10 +191,50 @@ func do_fillinfo(arg *tActionArg) error {
 	fmt.Println("Records with Non-Resident name:", external_names)
 	fmt.Println("Records with no data found:    ", no_data)
 	fmt.Println("Records with no name found:    ", no_name)
+	fmt.Println("Extension records:             ", extensions)
+	fmt.Println("Torn records kept:             ", torn_kept)
+	fmt.Println("Torn records rejected:         ", torn_rejected)
+	fmt.Println("Rejected attributes:           ", len(rejected_attributes))
+
+	if len(rejected_attributes) > 0 {
+		fmt.Println()
+		fmt.Println("Attributes rejected by $AttrDef:")
+		for _, msg := range rejected_attributes {
+			fmt.Println(msg)
+		}
+	}
+
+	if (torn_rejected > 0) && !disk.IsLenient() {
+		fmt.Println("Use the `lenient` option to keep the readable sectors of the torn records")
+	}
 
 	return nil
 }
 
+// Partition to read the records again, nil if it can not be opened, the result is true if the partition is opened here.
+func get_check_disk(arg *tActionArg) (*inspect.NtfsDisk, bool) {
+	if arg.disk != nil {
+		return arg.disk, false
+	}
+
+	raw_disk, err := arg.OpenRawDisk()
+	if err != nil {
+		fmt.Println("Warning: the partition can not be opened, only the torn records kept in the input file are found:", err)
+
+		return nil, false
+	}
+
+	disk, err := inspect.NewNtfsDisk(raw_disk, 0)
+	if err != nil {
+		raw_disk.Close()
+		fmt.Println("Warning: the partition can not be read, only the torn records kept in the input file are found:", err)
+
+		return nil, false
+	}
+
+	return disk, true
+}
+
 func do_check(verbose bool, arg *tActionArg) error {
 	src, err := arg.GetInput()
 	if err != nil {
@@ -174,10 +254,26 @@ func do_check(verbose bool, arg *tActionArg) error {
 		return err
 	}
 
+	// Without the `lenient` option, the torn records are not kept by `fill`, so they are read again from the partition
+	var disk *ntfs.DiskIO
+
+	ntfs_disk, opened := get_check_disk(arg)
+	if ntfs_disk != nil {
+		if opened {
+			defer ntfs.DeferedCall(ntfs_disk.Close)
+		}
+
+		disk = ntfs_disk.GetDisk()
+	}
+
 	reg := make(inspect.FileFrequencies)
+	attrdefs := get_attrdefs(ntfs_disk)
+	upcase := get_disk_upcase(ntfs_disk)
 
 	non_resident_names := make([]string, 0)
 	duplicates := make([]string, 0)
+	torn_records := make([]string, 0)
+	bad_attributes := make([]string, 0)
 
 	i, sz := 0, states.GetCount()
 
@@ -195,12 +291,33 @@ func do_check(verbose bool, arg *tActionArg) error {
 			continue
 		}
 
+		torn := record.GetTornSectors()
+		is_torn := len(torn) > 0
+		if !is_torn && (disk != nil) {
+			// An unreadable record is not reported as torn
+			if sectors, ok, err := inspect.FindTornSectors(disk, record); err == nil {
+				torn, is_torn = sectors, ok
+			}
+		}
+
+		if is_torn {
+			msg := fmt.Sprintf("  - Torn record found at %d [record %d, sectors %v]", record.GetPosition(), item.Index(), torn)
+			torn_records = append(torn_records, msg)
+		}
+
 		if record.GetType() != inspect.STATE_RECORD_TYPE_FILE {
 			continue
 		}
 
 		r := record.(*inspect.StateFileRecord)
 		for n, attr := range r.Attributes {
+			if desc, err := r.GetAttributeDesc(attr); err == nil {
+				if err := attrdefs.CheckAttribute(desc); err != nil {
+					msg := fmt.Sprintf("  - Bad attribute found at %d [record %d, attribute %d]: %v", r.Position, item.Index(), n, ntfs.GetSource(err))
+					bad_attributes = append(bad_attributes, msg)
+				}
+			}
+
 			if attr.Header.AttributeType != ntfs.ATTR_FILE_NAME {
 				continue
 			}
@@ -212,7 +329,8 @@ func do_check(verbose bool, arg *tActionArg) error {
 		}
 
 		if (r.Names != nil) && (len(r.Names) > 0) && (r.Parent != 0) {
-			if reg.Add(r.Parent, r.Name) {
+			// The names of a directory are compared as NTFS does, without the case
+			if reg.Add(r.Parent, upcase.ToUpper(r.Name)) {
 				msg := fmt.Sprintf("  - Dupplicate found at %d [name pair %s/%v]", r.Position, r.Name, r.Parent)
 				duplicates = append(duplicates, msg)
 			}
@@ -242,6 +360,8 @@ func do_check(verbose bool, arg *tActionArg) error {
 
 	print_result(non_resident_names, "Non-resident names")
 	print_result(duplicates, "Duplicate paths")
+	print_result(torn_records, "Torn records")
+	print_result(bad_attributes, "Attributes not following $AttrDef")
 
 	if cnt == 0 {
 		fmt.Println("No problem encountered")
@@ -11,6 +11,165 @@ import (
 	"github.com/corebreaker/ntfstool/inspect"
 )
 
+func get_allocated_size(runlist ntfs.RunList, cluster_size int64) uint64 {
+	res := uint64(0)
+	for _, run := range runlist {
+		if !run.Zero {
+			res += uint64(run.Count * cluster_size)
+		}
+	}
+
+	return res
+}
+
+func make_stream(attr *inspect.StateAttribute, desc *ntfs.AttributeDesc, cluster_size int64) (*extract.Stream, error) {
+	res := &extract.Stream{
+		Name:        desc.Name,
+		Size:        desc.GetSize(),
+		Compression: desc.GetCompressionUnit(),
+	}
+
+	if desc.Header.NonResident.Value() {
+		res.RunList = attr.RunList
+		res.Allocated = get_allocated_size(attr.RunList, cluster_size)
+		res.Uninitialized = get_uninitialized_size(desc)
+
+		return res, nil
+	}
+
+	value, err := desc.GetValue(nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if value != nil {
+		res.Data = extract.StreamData(value.Content)
+	}
+
+	return res, nil
+}
+
+// Size of the data after the initialized size of a non-resident attribute, the clusters have stale data there.
+func get_uninitialized_size(desc *ntfs.AttributeDesc) uint64 {
+	attr := desc.NonResidentDesc()
+	if (attr == nil) || (attr.InitializedSize >= attr.DataSize) {
+		return 0
+	}
+
+	return attr.DataSize - attr.InitializedSize
+}
+
+func get_reparse(file *inspect.StateFileRecord, is_dir bool) (*extract.Reparse, error) {
+	attrs := file.GetAttributes(ntfs.ATTR_REPARSE_POINT)
+	if len(attrs) == 0 {
+		return nil, nil
+	}
+
+	desc, err := file.GetAttributeDesc(attrs[0])
+	if err != nil {
+		return nil, err
+	}
+
+	// The reparse points are small, the non-resident ones are not read
+	if desc.Header.NonResident.Value() {
+		return nil, ntfs.WrapError(fmt.Errorf("Non-resident reparse point"))
+	}
+
+	value, err := desc.GetValue(nil)
+	if (err != nil) || (value == nil) {
+		return nil, err
+	}
+
+	point, err := ntfs.ParseReparsePoint(value.Content)
+	if err != nil {
+		return nil, err
+	}
+
+	return extract.MakeReparse(point, is_dir), nil
+}
+
+func get_attribute_descs(file *inspect.StateFileRecord, types ...ntfs.AttributeType) ([]*ntfs.AttributeDesc, error) {
+	res := make([]*ntfs.AttributeDesc, 0)
+
+	for _, attr := range file.GetAttributes(types[0], types[1:]...) {
+		desc, err := file.GetAttributeDesc(attr)
+		if err != nil {
+			return nil, err
+		}
+
+		res = append(res, desc)
+	}
+
+	return res, nil
+}
+
+func get_secure(disk *ntfs.DiskIO, files []*inspect.StateFileRecord) (*ntfs.Secure, error) {
+	for _, file := range files {
+		if file.Header.MftRecordNumber != ntfs.SECURE_FILE_NUMBER {
+			continue
+		}
+
+		attrs, err := get_attribute_descs(file, ntfs.ATTR_DATA, ntfs.ATTR_INDEX_ROOT, ntfs.ATTR_INDEX_ALLOCATION)
+		if err != nil {
+			return nil, err
+		}
+
+		return ntfs.LoadSecure(disk, attrs)
+	}
+
+	return nil, ntfs.WrapError(fmt.Errorf("$Secure not found"))
+}
+
+func get_security(disk *ntfs.DiskIO, secure *ntfs.Secure, file *inspect.StateFileRecord) (*extract.Security, error) {
+	attrs, err := get_attribute_descs(file, ntfs.ATTR_STANDARD_INFORMATION, ntfs.ATTR_SECURITY_DESCRIPTOR)
+	if err != nil {
+		return nil, err
+	}
+
+	desc, id, err := ntfs.GetFileSecurity(disk, secure, attrs)
+	if (err != nil) || (desc == nil) {
+		return nil, err
+	}
+
+	return extract.MakeSecurity(id, desc), nil
+}
+
+// Timestamps of $STANDARD_INFORMATION and of the $FILE_NAME with the name of the file, and the DOS attributes.
+func get_file_times(file *inspect.StateFileRecord) (*extract.Times, *extract.Times, uint32, error) {
+	var times, name_times *extract.Times
+	var flags ntfs.FileAttrFlag
+
+	attrs, err := get_attribute_descs(file, ntfs.ATTR_STANDARD_INFORMATION, ntfs.ATTR_FILE_NAME)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+
+	for _, attr := range attrs {
+		value, err := attr.GetValue(nil)
+		if (err != nil) || (value == nil) {
+			continue
+		}
+
+		switch infos := value.Value.(type) {
+		case *ntfs.StandardInformationAttribute:
+			times = extract.MakeTimes(infos.CreationTime, infos.LastWriteTime, infos.ChangeTime, infos.LastAccessTime)
+			flags = infos.FileAttributes
+
+		case *ntfs.FilenameAttribute:
+			if (name_times != nil) && (value.GetFilename() != file.Name) {
+				continue
+			}
+
+			name_times = extract.MakeTimes(infos.CreationTime, infos.LastWriteTime, infos.ChangeTime, infos.LastAccessTime)
+			if times == nil {
+				flags = infos.FileAttributes
+			}
+		}
+	}
+
+	return times, name_times, uint32(flags), nil
+}
+
 func do_mkfilelist(verbose bool, arg *tActionArg) error {
 	src, dest, err := arg.GetFiles()
 	if err != nil {
@@ -30,6 +189,9 @@ func do_mkfilelist(verbose bool, arg *tActionArg) error {
 		return err
 	}
 
+	// The names of a directory are compared as NTFS does, without the case
+	upcase := get_upcase(arg)
+
 	type tNode struct {
 		file     *extract.File
 		children map[string]*tNode
@@ -46,7 +208,7 @@ func do_mkfilelist(verbose bool, arg *tActionArg) error {
 		}
 
 		node.addChild = func(child *tNode) bool {
-			name := child.file.Name
+			name := upcase.ToUpper(child.file.Name)
 			prev, exists := node.children[name]
 			if exists && (prev.file.FileRef.GetSequenceNumber() > child.file.FileRef.GetSequenceNumber()) {
 				for _, subchild := range child.children {
@@ -138,6 +300,7 @@ func do_mkfilelist(verbose bool, arg *tActionArg) error {
 	mfts := make(map[string]*tMft)
 	file_cnt := 0
 	no_mft := 0
+	resident_cnt := 0
 
 	i, cnt := 0, reader.GetCount()
 
@@ -198,13 +361,27 @@ func do_mkfilelist(verbose bool, arg *tActionArg) error {
 	fmt.Println("Building nodes")
 	i, cnt = 0, file_cnt
 
+	disk := arg.disk.GetDisk()
+	defer ntfs.DeferedCall(disk.Close)
+
 	for mftid, mft := range mfts {
 		if mft.state == nil {
 			return ntfs.WrapError(fmt.Errorf("No MFT with ID=%s", mftid))
 		}
 
 		origin := mft.state.PartOrigin
+		cluster_size := mft.state.GetGeometry().ClusterSize
 
+		disk.SetOffset(origin)
+
+		// Without $Secure, only the inline security descriptors are known
+		secure, err := get_secure(disk, mft.list)
+		if err != nil {
+			fmt.Println()
+			fmt.Println(fmt.Sprintf("Warning: the security descriptors of the MFT %s can not be read: %v", mftid, ntfs.GetSource(err)))
+		}
+
+	file_loop:
 		for _, file := range mft.list {
 			fmt.Printf("\rDone: %d %%", 100*i/cnt)
 			i++
@@ -218,22 +395,108 @@ func do_mkfilelist(verbose bool, arg *tActionArg) error {
 
 			var runlist ntfs.RunList
 			var size uint64
+			var compression int64
+			var allocated, uninitialized uint64
+			var streams []*extract.Stream
+			var content extract.StreamData
 
-			if !is_dir {
-				attrs := file.GetAttributes(ntfs.ATTR_DATA)
-				if len(attrs) == 0 {
-					continue
-				}
+			has_data, resident := false, false
 
-				attr_state := attrs[0]
+			// A damaged $DATA attribute only discards its file
+			skip_file := func(err error) {
+				fmt.Println()
+				fmt.Println(fmt.Sprintf("Warning: bad $DATA attribute for the file %s, the file is skipped: %v", file, ntfs.GetSource(err)))
+			}
 
+			for _, attr_state := range file.GetAttributes(ntfs.ATTR_DATA) {
 				attr_data, err := file.GetAttributeDesc(attr_state)
 				if err != nil {
-					return err
+					skip_file(err)
+
+					continue file_loop
+				}
+
+				// The named data attributes are the alternate data streams
+				if len(attr_data.Name) > 0 {
+					stream, err := make_stream(attr_state, attr_data, cluster_size)
+					if err != nil {
+						skip_file(err)
+
+						continue file_loop
+					}
+
+					streams = append(streams, stream)
+
+					continue
 				}
 
+				if is_dir || has_data {
+					continue
+				}
+
+				has_data = true
 				runlist = attr_state.RunList
 				size = attr_data.GetSize()
+				compression = attr_data.GetCompressionUnit()
+				allocated = get_allocated_size(runlist, cluster_size)
+				uninitialized = get_uninitialized_size(attr_data)
+
+				// The content of a small file is in its MFT record
+				if !attr_data.Header.NonResident.Value() {
+					value, err := attr_data.GetValue(nil)
+					if err != nil {
+						skip_file(err)
+
+						continue file_loop
+					}
+
+					resident = true
+					if value != nil {
+						content = extract.StreamData(value.Content)
+					}
+
+					resident_cnt++
+				}
+			}
+
+			reparse, err := get_reparse(file, is_dir)
+			if err != nil {
+				fmt.Println()
+				fmt.Println(fmt.Sprintf("Warning: bad reparse point for the file %s: %v", file, ntfs.GetSource(err)))
+			}
+
+			// The content of a WOF compressed file is in its compressed stream
+			if (reparse != nil) && (reparse.GetTag() == ntfs.IO_REPARSE_TAG_WOF) {
+				for _, stream := range streams {
+					if stream.Name == ntfs.WOF_STREAM_NAME {
+						allocated += stream.Allocated
+					}
+				}
+			}
+
+			// A link to a file has no data
+			if !is_dir && !has_data && ((reparse == nil) || !reparse.IsLink()) {
+				continue
+			}
+
+			security, err := get_security(disk, secure, file)
+			if err != nil {
+				fmt.Fprintf(&log, "Bad security descriptor for the file %s: %v", file, ntfs.GetSource(err))
+				fmt.Fprintln(&log)
+			}
+
+			times, name_times, attributes, err := get_file_times(file)
+			if err != nil {
+				return err
+			}
+
+			var links []*extract.FileLink
+
+			for _, link := range file.Links {
+				links = append(links, &extract.FileLink{
+					Name:      link.Name,
+					ParentRef: link.Parent,
+				})
 			}
 
 			f := new_node(&extract.File{
@@ -246,6 +509,20 @@ func do_mkfilelist(verbose bool, arg *tActionArg) error {
 				Size:      size,
 				Name:      name,
 				RunList:   runlist,
+
+				Compression: compression,
+				Allocated:   allocated,
+				Streams:     streams,
+				Reparse:     reparse,
+				Security:    security,
+				Times:       times,
+				NameTimes:   name_times,
+				Attributes:  attributes,
+				Resident:    resident,
+				Data:        content,
+				Links:       links,
+
+				Uninitialized: uninitialized,
 			})
 
 			mft.refs[ref] = id
@@ -302,34 +579,59 @@ func do_mkfilelist(verbose bool, arg *tActionArg) error {
 		mft.root.setParent(mft.lost)
 		mft.root.addChild(mft.lost)
 
+		// ID and reference of the parent directory with the reference `ref`
+		find_parent := func(ref data.FileRef) (string, data.FileRef, bool) {
+			if parent, ok := mft.refs[ref]; ok {
+				return parent, ref, true
+			}
+
+			idx := ref.GetFileIndex()
+			if idx == mft.root.file.FileRef.GetFileIndex() {
+				return mft.root.file.Id, ref, true
+			}
+
+			if fid, ok := mft.fidxs[idx]; ok {
+				return fid.id, data.MakeFileRef(fid.seq, idx), true
+			}
+
+			return "", ref, false
+		}
+
 		for _, file := range mft.files {
 			fmt.Printf("\rDone: %d %%", 100*i/cnt)
 			i++
 
-			ref := file.file.ParentRef
-			parent, ok := mft.refs[ref]
+			parent, ref, ok := find_parent(file.file.ParentRef)
 			if !ok {
-				idx := ref.GetFileIndex()
-
-				if idx == mft.root.file.FileRef.GetFileIndex() {
-					parent = mft.root.file.Id
-				} else {
-					fid, ok := mft.fidxs[idx]
-					if ok {
-						parent = fid.id
-						file.file.ParentRef = data.MakeFileRef(fid.seq, idx)
-					} else {
-						fmt.Fprintf(&log, fmt.Sprintf("Parent not found for file %s", file))
-						fmt.Fprintln(&log)
-
-						no_parents++
-
-						parent = mft.lost.file.Id
-					}
-				}
+				fmt.Fprintf(&log, fmt.Sprintf("Parent not found for file %s", file))
+				fmt.Fprintln(&log)
+
+				no_parents++
+
+				parent = mft.lost.file.Id
 			}
 
 			file.file.Parent = parent
+			file.file.ParentRef = ref
+
+			// A link in a directory which is not found is not kept
+			var links []*extract.FileLink
+
+			for _, link := range file.file.Links {
+				parent, ref, ok := find_parent(link.ParentRef)
+				if !ok {
+					fmt.Fprintf(&log, "Parent not found for the link %s of the file %s", link.Name, file.file)
+					fmt.Fprintln(&log)
+
+					continue
+				}
+
+				link.Parent = parent
+				link.ParentRef = ref
+				links = append(links, link)
+			}
+
+			file.file.Links = links
 		}
 	}
 
@@ -404,6 +706,7 @@ func do_mkfilelist(verbose bool, arg *tActionArg) error {
 	fmt.Println("File with no parent:", no_parents)
 	fmt.Println("File with no MFT:   ", no_mft)
 	fmt.Println("Dupplicate names:   ", dup_names)
+	fmt.Println("Resident files:     ", resident_cnt)
 
 	if verbose {
 		fmt.Fprintln(os.Stderr)
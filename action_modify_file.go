@@ -56,7 +56,7 @@ func do_make_dir(name string, arg *tActionArg) error {
 		return ntfs.WrapError(fmt.Errorf("Parent `%s` not found", parent_id))
 	}
 
-	if _, exists := parent_node.Children[name]; exists {
+	if parent_node.FindChild(name, get_upcase(arg)) != nil {
 		return ntfs.WrapError(fmt.Errorf("Name `%s` already exists in `%s`", name, parent_node.File))
 	}
 
@@ -104,7 +104,7 @@ func do_move_to(node_pattern string, arg *tActionArg) error {
 		return err
 	}
 
-	pattern, err := parseNodePattern(node_pattern, tree)
+	pattern, err := parseNodePattern(node_pattern, tree, get_pattern_upcase(arg))
 	if err != nil {
 		return err
 	}
@@ -158,10 +158,12 @@ func do_move_to(node_pattern string, arg *tActionArg) error {
 		return nil
 	}
 
+	upcase := get_upcase(arg)
+
 	for _, src_node := range src_nodes {
 		src := src_node.File
 
-		if _, exists := dir_node.Children[src.Name]; exists {
+		if dir_node.FindChild(src.Name, upcase) != nil {
 			const msg = "Name `%s` (from file `%s`, FileId=%s, RootId=%s) already exists in `%s` (DirID=%s, RootID=%s)"
 
 			src_path := tree.GetNodePath(src_node)
@@ -222,7 +224,7 @@ func do_copy_to(node_pattern string, arg *tActionArg) error {
 		return err
 	}
 
-	pattern, err := parseNodePattern(node_pattern, tree)
+	pattern, err := parseNodePattern(node_pattern, tree, get_pattern_upcase(arg))
 	if err != nil {
 		return err
 	}
@@ -249,6 +251,22 @@ func do_copy_to(node_pattern string, arg *tActionArg) error {
 			Position:  src.Position,
 			Size:      src.Size,
 			RunList:   src.RunList,
+
+			Compression: src.Compression,
+			Allocated:   src.Allocated,
+			Streams:     src.Streams,
+			Reparse:     src.Reparse,
+			Security:    src.Security,
+			Times:       src.Times,
+			NameTimes:   src.NameTimes,
+			Attributes:  src.Attributes,
+			Resident:    src.Resident,
+			Data:        src.Data,
+
+			// The hard links stay with the source, the copy is a new file with only its name in the directory
+			Links: nil,
+
+			Uninitialized: src.Uninitialized,
 		}
 
 		const msg = "Copy File `%s` (RootID=%s) with new ID `%s` to directory `%s` (DirID=%s, RootID=%s)"
@@ -323,10 +341,12 @@ func do_copy_to(node_pattern string, arg *tActionArg) error {
 		return nil
 	}
 
+	upcase := get_upcase(arg)
+
 	for _, src_node := range src_nodes {
 		src := src_node.File
 
-		if _, exists := dir_node.Children[src.Name]; exists {
+		if dir_node.FindChild(src.Name, upcase) != nil {
 			const msg = "Name `%s` (from file `%s`, FileId=%s, RootId=%s) already exists in `%s` (DirID=%s, RootID=%s)"
 
 			src_path := tree.GetNodePath(src_node)
@@ -373,7 +393,7 @@ func do_remove_from(node_pattern string, arg *tActionArg) error {
 		return err
 	}
 
-	pattern, err := parseNodePattern(node_pattern, tree)
+	pattern, err := parseNodePattern(node_pattern, tree, get_pattern_upcase(arg))
 	if err != nil {
 		return err
 	}
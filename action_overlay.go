@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+
+	ntfs "github.com/corebreaker/ntfstool/core"
+)
+
+func do_overlay_list(arg *tActionArg) error {
+	disk, overlay, err := arg.OpenOverlay()
+	if err != nil {
+		return err
+	}
+
+	defer ntfs.DeferedCall(disk.Close)
+
+	written := overlay.GetWritten()
+	total := int64(0)
+
+	fmt.Println("Overlay:", overlay.GetDeltaPath())
+	fmt.Println("Written areas (offsets in the source):")
+	for _, area := range written {
+		fmt.Println(fmt.Sprintf("  - %d - %d [ Size= %d ]", area.Position, area.GetEnd()-1, area.Size))
+		total += area.Size
+	}
+
+	fmt.Println(fmt.Sprintf("Total: %d bytes in %d areas", total, len(written)))
+
+	return nil
+}
+
+func do_overlay_diff(verbose bool, arg *tActionArg) error {
+	disk, overlay, err := arg.OpenOverlay()
+	if err != nil {
+		return err
+	}
+
+	defer ntfs.DeferedCall(disk.Close)
+
+	changes, err := overlay.Diff()
+	if err != nil {
+		return err
+	}
+
+	if len(changes) == 0 {
+		fmt.Println("No difference between the overlay and the source")
+
+		return nil
+	}
+
+	for _, change := range changes {
+		fmt.Println("Change:", change)
+
+		if verbose {
+			fmt.Println("Source:")
+			ntfs.PrintBytes(change.Source)
+			fmt.Println("Overlay:")
+			ntfs.PrintBytes(change.Overlay)
+			fmt.Println()
+		}
+	}
+
+	fmt.Println("Changes:", len(changes))
+
+	return nil
+}
+
+func do_overlay_export(dest string, arg *tActionArg) error {
+	if len(dest) == 0 {
+		return ntfs.WrapError(fmt.Errorf("No image file specified"))
+	}
+
+	disk, overlay, err := arg.OpenOverlay()
+	if err != nil {
+		return err
+	}
+
+	defer ntfs.DeferedCall(disk.Close)
+
+	fmt.Println("Exporting the patched source into:", dest)
+
+	return overlay.Export(dest)
+}
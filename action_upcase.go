@@ -0,0 +1,52 @@
+package main
+
+import (
+	"fmt"
+
+	ntfs "github.com/corebreaker/ntfstool/core"
+	"github.com/corebreaker/ntfstool/inspect"
+)
+
+// Upper case table of the partition when it's opened, or else the built-in table.
+func get_upcase(arg *tActionArg) ntfs.UpCase {
+	return get_disk_upcase(arg.disk)
+}
+
+// Upper case table of a partition, the built-in table is used without partition.
+func get_disk_upcase(disk *inspect.NtfsDisk) ntfs.UpCase {
+	if disk == nil {
+		return ntfs.DefaultUpCase()
+	}
+
+	table, err := disk.GetUpCase()
+	if err != nil {
+		fmt.Println("Warning: $UpCase can not be read, the built-in upper case table is used:", err)
+
+		return ntfs.DefaultUpCase()
+	}
+
+	return table
+}
+
+func do_lookup(path string, arg *tActionArg) error {
+	ref, err := arg.disk.LookupPath(path, get_upcase(arg))
+	if err != nil {
+		return err
+	}
+
+	var record ntfs.FileRecord
+
+	if err := arg.disk.ReadFileRecordFromRef(ref, &record); err != nil {
+		return err
+	}
+
+	name, err := arg.disk.GetFileRecordFilename(&record)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println()
+	fmt.Println(fmt.Sprintf("Found: %s (file-num=%d, reference= %s, directory= %v)", name, ref.GetFileIndex(), ref, record.IsDir()))
+
+	return nil
+}
@@ -1,8 +1,10 @@
 package main
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
+	"path/filepath"
 	"strings"
 
 	"github.com/siddontang/go/ioutil2"
@@ -39,6 +41,11 @@ var (
 		tDefaultActionDef{handler: do_listnames, name: "list-names"},
 		tDefaultActionDef{handler: do_shownames, name: "show-names"},
 		tDefaultActionDef{handler: do_scan, name: "scan"},
+		tStringActionDef{handler: do_image, name: "image"},
+		tDefaultActionDef{handler: do_rebuild_boot, name: "rebuild-boot"},
+		tDefaultActionDef{handler: do_overlay_list, name: "overlay-list"},
+		tBoolActionDef{handler: do_overlay_diff, name: "overlay-diff"},
+		tStringActionDef{handler: do_overlay_export, name: "overlay-export"},
 		tStringActionDef{handler: do_list_files, name: "ls"},
 		tStringActionDef{handler: do_move_to, name: "mv"},
 		tStringActionDef{handler: do_copy_to, name: "cp"},
@@ -63,15 +70,59 @@ var (
 		tIntegerActionDef{handler: do_sector, name: "sector", offset: true},
 		tIntegerActionDef{handler: do_cluster, name: "cluster", offset: true},
 		tIntegerActionDef{handler: do_file_num, name: "file-num"},
+		tDefaultActionDef{handler: do_partitions, name: "partitions"},
+		tDefaultActionDef{handler: do_alloc_stats, name: "alloc-stats"},
+		tDefaultActionDef{handler: do_attrdef, name: "attrdef"},
+		tStringActionDef{handler: do_lookup, name: "lookup"},
 	}
 )
 
 func do_open_disk(arg *tActionArg) error {
-	disk, err := inspect.OpenNtfsDisk(arg.partition, 0)
+	transforms, err := arg.GetTransforms()
 	if err != nil {
 		return err
 	}
 
+	partition, err := arg.GetPartition()
+	if err != nil {
+		return err
+	}
+
+	raw_disk, err := ntfs.OpenDisk(arg.partition, transforms...)
+	if err != nil {
+		return err
+	}
+
+	if partition != nil {
+		raw_disk.SetOffset(partition.Start)
+		raw_disk.SetSize(partition.Size)
+	}
+
+	_, lenient := arg.GetExt("lenient")
+	raw_disk.SetLenient(lenient)
+
+	disk, err := inspect.NewNtfsDisk(raw_disk, 0)
+	if err != nil {
+		raw_disk.Close()
+
+		return err
+	}
+
+	override, err := arg._args.GetGeometryOverride()
+	if err != nil {
+		disk.Close()
+
+		return err
+	}
+
+	if override != nil {
+		if err := disk.SetGeometryOverride(override); err != nil {
+			disk.Close()
+
+			return err
+		}
+	}
+
 	arg.disk = disk
 	return nil
 }
@@ -267,14 +318,14 @@ func do_record(record_num int64, arg *tActionArg) error {
 }
 
 func do_sector(offset int64, arg *tActionArg) error {
-	var sector [512]byte
-
-	num := (offset + 511) / 512
-
 	disk := arg.disk.GetDisk()
 	defer ntfs.DeferedCall(disk.Close)
 
-	if err := disk.ReadSector(num, sector[:]); err != nil {
+	geometry := disk.GetGeometry()
+	sector := make([]byte, geometry.SectorSize)
+	num := geometry.SectorOf(offset)
+
+	if err := disk.ReadSector(num, sector); err != nil {
 		return err
 	}
 
@@ -282,27 +333,46 @@ func do_sector(offset int64, arg *tActionArg) error {
 	fmt.Println("Content:")
 	fmt.Printf("Content at %d:", num)
 	fmt.Println()
-	ntfs.PrintBytes(sector[:])
+	ntfs.PrintBytes(sector)
 
 	return nil
 }
 
 func do_cluster(offset int64, arg *tActionArg) error {
-	var cluster [4096]byte
-
-	num := (offset + 4095) / 4096
-
 	disk := arg.disk.GetDisk()
 	defer ntfs.DeferedCall(disk.Close)
 
-	if err := disk.ReadCluster(num, cluster[:]); err != nil {
+	geometry := disk.GetGeometry()
+	cluster := make([]byte, geometry.ClusterSize)
+	num := geometry.ClusterOf(offset)
+
+	if err := disk.ReadCluster(num, cluster); err != nil {
 		return err
 	}
 
 	fmt.Println()
-	fmt.Printf("Content at %d:", num*8)
+	fmt.Printf("Content at %d:", geometry.ClusterToSector(num))
 	fmt.Println()
-	ntfs.PrintBytes(cluster[:])
+	ntfs.PrintBytes(cluster)
+
+	return nil
+}
+
+func do_partitions(arg *tActionArg) error {
+	disk, err := ntfs.OpenDisk(arg.partition)
+	if err != nil {
+		return err
+	}
+
+	defer ntfs.DeferedCall(disk.Close)
+
+	partitions, err := ntfs.ReadPartitions(disk)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println()
+	ntfs.PrintPartitions(partitions)
 
 	return nil
 }
@@ -313,5 +383,158 @@ func do_scan(arg *tActionArg) error {
 		return err
 	}
 
-	return inspect.Scan(arg.partition, destination)
+	disk, err := arg.OpenRawDisk()
+	if err != nil {
+		return err
+	}
+
+	defer ntfs.DeferedCall(disk.Close)
+
+	if _, ok := arg.GetExt("unallocated"); !ok {
+		return inspect.ScanDisk(disk, destination)
+	}
+
+	ntfs_disk, err := inspect.NewNtfsDisk(disk.Shift(0), 0)
+	if err != nil {
+		return err
+	}
+
+	defer ntfs.DeferedCall(ntfs_disk.Close)
+
+	bitmap, err := ntfs_disk.GetBitmap()
+	if err != nil {
+		return err
+	}
+
+	fmt.Println("Only unallocated clusters are scanned:", bitmap.GetStats(ntfs_disk.GetGeometry().ClusterSize))
+
+	masked := ntfs.MaskDisk(ntfs_disk.GetDisk(), bitmap, true)
+	defer ntfs.DeferedCall(masked.Close)
+
+	return inspect.ScanDisk(masked, destination)
+}
+
+func do_rebuild_boot(arg *tActionArg) error {
+	src, err := arg.GetInput()
+	if err != nil {
+		return err
+	}
+
+	dest := arg.dest
+	if dest == nil {
+		dest, err = ntfs.OpenFile(filepath.Join(filepath.Dir(src.Name()), "boot_sector.dat"), ntfs.OPEN_WRONLY)
+		if err != nil {
+			return err
+		}
+
+		defer ntfs.DeferedCall(dest.Close)
+	}
+
+	fmt.Println("Reading")
+	states, err := inspect.MakeStateReader(src)
+	if err != nil {
+		return err
+	}
+
+	defer ntfs.DeferedCall(states.Close)
+
+	stream, err := states.MakeStream()
+	if err != nil {
+		return err
+	}
+
+	defer ntfs.DeferedCall(stream.Close)
+
+	positions := make([]int64, 0)
+	for item := range stream {
+		state := item.Record()
+		if err := state.GetError(); err != nil {
+			return err
+		}
+
+		if (!state.IsNull()) && (state.GetType() == inspect.STATE_RECORD_TYPE_FILE) {
+			positions = append(positions, state.GetPosition())
+		}
+	}
+
+	disk, err := arg.OpenRawDisk()
+	if err != nil {
+		return err
+	}
+
+	defer ntfs.DeferedCall(disk.Close)
+
+	override, err := arg._args.GetGeometryOverride()
+	if err != nil {
+		return err
+	}
+
+	sector_size := int64(0)
+	if override != nil {
+		sector_size = override.SectorSize
+	}
+
+	fmt.Println(fmt.Sprintf("Rebuilding the boot sector from %d MFT records", len(positions)))
+	boot, err := inspect.RebuildBootBlock(disk, positions, sector_size)
+	if err != nil {
+		return err
+	}
+
+	if err := ntfs.Write(dest, boot); err != nil {
+		return err
+	}
+
+	geometry, err := boot.GetGeometry()
+	if err != nil {
+		return err
+	}
+
+	fmt.Println()
+	fmt.Println("Boot sector written into:", dest.Name())
+
+	if ntfs.FindOverlay(disk.GetSource()) != nil {
+		var buffer bytes.Buffer
+
+		if err := ntfs.Write(&buffer, boot); err != nil {
+			return err
+		}
+
+		if _, err := disk.WriteAt(buffer.Bytes(), 0); err != nil {
+			return err
+		}
+
+		fmt.Println("Boot sector written into the overlay at the start of the partition")
+	}
+
+	fmt.Println("The source is not modified, to use these values without a boot sector:")
+	fmt.Println(fmt.Sprintf(
+		"  sector-size=%d cluster-size=%d record-size=%d index-size=%d mft=%dc",
+		geometry.SectorSize,
+		geometry.ClusterSize,
+		geometry.RecordSize,
+		geometry.IndexSize,
+		boot.MftStartLcn,
+	))
+
+	return nil
+}
+
+func do_alloc_stats(arg *tActionArg) error {
+	bitmap, err := arg.disk.GetBitmap()
+	if err != nil {
+		return err
+	}
+
+	geometry := arg.disk.GetGeometry()
+	stats := bitmap.GetStats(geometry.ClusterSize)
+
+	fmt.Println()
+	fmt.Println("Allocation ($Bitmap):")
+	fmt.Println(fmt.Sprintf("  Clusters:       %d (cluster size: %d)", stats.Total, geometry.ClusterSize))
+	fmt.Println(fmt.Sprintf("  Allocated:      %d clusters, %d bytes", stats.Allocated, stats.Allocated*geometry.ClusterSize))
+	fmt.Println(fmt.Sprintf("  Free:           %d clusters, %d bytes", stats.Free, stats.Free*geometry.ClusterSize))
+	fmt.Println(fmt.Sprintf("  Free ranges:    %d", stats.FreeRanges))
+	fmt.Println(fmt.Sprintf("  Largest free:   %d clusters", stats.LargestFree))
+
+	return nil
 }
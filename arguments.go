@@ -28,7 +28,13 @@ type tActionArg struct {
 	file      *os.File
 	from      string
 	into      string
+	rescue    *ntfs.RescueMap
 	_args     ntfs.Args
+
+	// Partition and geometry resolved once for the command
+	part_found bool
+	part       *ntfs.Partition
+	geometry   *ntfs.Geometry
 }
 
 func (self *tActionArg) Close() error {
@@ -74,10 +80,243 @@ func (self *tActionArg) Int(key string) int64                    { return self._
 func (self *tActionArg) IntDef(key string, val int64) int64      { return self._args.IntDef(key, val) }
 func (self *tActionArg) IntExt(key string) (int64, bool)         { return self._args.IntExt(key) }
 func (self *tActionArg) IntFull(key string) (int64, bool, error) { return self._args.IntFull(key) }
-func (self *tActionArg) Idx(key string) int64                    { return self._args.Idx(key) }
-func (self *tActionArg) IdxDef(key string, val int64) int64      { return self._args.IdxDef(key, val) }
-func (self *tActionArg) IdxExt(key string) (int64, bool)         { return self._args.IdxExt(key) }
-func (self *tActionArg) IdxFull(key string) (int64, bool, error) { return self._args.IdxFull(key) }
+func (self *tActionArg) Idx(key string) int64                    { return self.IdxDef(key, 0) }
+
+func (self *tActionArg) IdxDef(key string, default_value int64) int64 {
+	val, ok, err := self.IdxFull(key)
+	if err != nil {
+		ntfs.Abort(err)
+	}
+
+	if !ok {
+		return default_value
+	}
+
+	return val
+}
+
+func (self *tActionArg) IdxExt(key string) (int64, bool) {
+	val, ok, err := self.IdxFull(key)
+	if (!ok) || (err != nil) {
+		return 0, false
+	}
+
+	return val, true
+}
+
+func (self *tActionArg) IdxFull(key string) (int64, bool, error) {
+	if _, ok := self._args[key]; !ok {
+		return 0, false, nil
+	}
+
+	geometry, err := self.GetGeometry()
+	if err != nil {
+		return 0, false, err
+	}
+
+	return self._args.IdxFullWithGeometry(key, geometry)
+}
+
+func (self *tActionArg) GetPartition() (*ntfs.Partition, error) {
+	if self.part_found {
+		return self.part, nil
+	}
+
+	number, ok, err := self.IntFull("part")
+	if err != nil {
+		return nil, err
+	}
+
+	if !ok {
+		self.part_found = true
+
+		return nil, nil
+	}
+
+	disk, err := ntfs.OpenDisk(self.partition)
+	if err != nil {
+		return nil, err
+	}
+
+	defer ntfs.DeferedCall(disk.Close)
+
+	partition, err := ntfs.FindPartition(disk, int(number))
+	if err != nil {
+		return nil, err
+	}
+
+	fmt.Println("Partition:", partition)
+	if partition.Backup {
+		fmt.Println("Warning: primary GPT header is damaged, the partition is read from the backup header")
+	}
+
+	self.part, self.part_found = partition, true
+
+	return partition, nil
+}
+
+// The rescue map is shared by all the disks opened by the command.
+func (self *tActionArg) GetRescueMap() (*ntfs.RescueMap, bool, error) {
+	if self.rescue != nil {
+		return self.rescue, true, nil
+	}
+
+	_, rescue := self.GetExt("rescue")
+	_, has_retries := self.GetExt("retries")
+	path, has_map := self.GetExt("errmap")
+
+	if !(rescue || has_retries || has_map) {
+		return nil, false, nil
+	}
+
+	if !has_map {
+		self.rescue = ntfs.NewRescueMap("")
+
+		return self.rescue, true, nil
+	}
+
+	res, err := ntfs.LoadRescueMap(path)
+	if err != nil {
+		return nil, false, err
+	}
+
+	if count := len(res.Find(0, res.GetSize(), ntfs.RESCUE_BAD)); count > 0 {
+		fmt.Println(fmt.Sprintf("Rescue map: %d known bad ranges will be skipped", count))
+	}
+
+	self.rescue = res
+
+	return res, true, nil
+}
+
+func (self *tActionArg) GetTransforms() ([]ntfs.SourceTransform, error) {
+	res := make([]ntfs.SourceTransform, 0)
+
+	rescue, ok, err := self.GetRescueMap()
+	if err != nil {
+		return nil, err
+	}
+
+	if ok {
+		retries := self.IntDef("retries", ntfs.DEFAULT_RETRIES)
+
+		on_bad := func(position, size int64) {
+			fmt.Println(fmt.Sprintf("Warning: unreadable sector at offset %d, zero-filled", position))
+		}
+
+		res = append(res, ntfs.RescueTransform(rescue, int(retries), on_bad))
+	}
+
+	cache_size, ok, err := self._args.SizeFull("cache")
+	if err != nil {
+		return nil, err
+	}
+
+	if ok && (cache_size > 0) {
+		read_ahead := self.IntDef("read-ahead", ntfs.DEFAULT_READ_AHEAD)
+
+		// The blocks are set to the cluster size of the volume when its geometry is read (cf: CacheSource.SetBlockSize)
+		res = append(res, ntfs.CacheTransform(cache_size, ntfs.DEFAULT_CLUSTER_SIZE, int(read_ahead)))
+	}
+
+	// The overlay is on the top, so the written areas are never kept in the cache
+	if path, ok := self.GetExt("overlay"); ok && (path != "") {
+		res = append(res, ntfs.OverlayTransform(path))
+	}
+
+	return res, nil
+}
+
+func (self *tActionArg) OpenOverlay() (*ntfs.DiskIO, *ntfs.OverlaySource, error) {
+	if path, ok := self.GetExt("overlay"); !ok || (path == "") {
+		return nil, nil, ntfs.WrapError(fmt.Errorf("No overlay specified, use the parameter `overlay=pathname`"))
+	}
+
+	disk, err := self.OpenRawDisk()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return disk, ntfs.FindOverlay(disk.GetSource()), nil
+}
+
+func (self *tActionArg) PrintCacheStats(command string) {
+	if self.disk == nil {
+		return
+	}
+
+	disk := self.disk.GetDisk()
+	defer disk.Close()
+
+	cache := ntfs.FindCache(disk.GetSource())
+	if cache == nil {
+		return
+	}
+
+	fmt.Println(fmt.Sprintf("Cache (%s): %s", command, cache.GetStats()))
+	cache.ResetStats()
+}
+
+func (self *tActionArg) OpenRawDisk() (*ntfs.DiskIO, error) {
+	partition, err := self.GetPartition()
+	if err != nil {
+		return nil, err
+	}
+
+	transforms, err := self.GetTransforms()
+	if err != nil {
+		return nil, err
+	}
+
+	disk, err := ntfs.OpenDisk(self.partition, transforms...)
+	if err != nil {
+		return nil, err
+	}
+
+	if partition != nil {
+		disk.SetOffset(partition.Start)
+		disk.SetSize(partition.Size)
+	}
+
+	return disk, nil
+}
+
+func (self *tActionArg) GetGeometry() (*ntfs.Geometry, error) {
+	if self.disk != nil {
+		return self.disk.GetGeometry(), nil
+	}
+
+	if self.geometry != nil {
+		return self.geometry, nil
+	}
+
+	var base *ntfs.Geometry
+
+	// Only the boot sector is read, the image is opened without the transforms of the command
+	if partition, err := self.GetPartition(); err == nil {
+		if disk, err := ntfs.OpenDisk(self.partition); err == nil {
+			defer ntfs.DeferedCall(disk.Close)
+
+			if partition != nil {
+				disk.SetOffset(partition.Start)
+				disk.SetSize(partition.Size)
+			}
+
+			if boot, err := ntfs.ReadBootBlock(disk); err == nil {
+				base, _ = boot.GetGeometry()
+			}
+		}
+	}
+
+	geometry, err := self._args.GetGeometry(base)
+	if err != nil {
+		return nil, err
+	}
+
+	self.geometry = geometry
+
+	return geometry, nil
+}
 
 func (self *tActionArg) GetInput() (*os.File, error) {
 	if self.source == nil {
@@ -288,5 +527,9 @@ func run_action(action iActionDef, arg *tActionArg) (bool, error) {
 		return false, err
 	}
 
+	if len(name) > 0 {
+		arg.PrintCacheStats(name)
+	}
+
 	return action.do_stop(), nil
 }
@@ -21,6 +21,24 @@ func ToInt(v string) (int64, error) {
 	return res, nil
 }
 
+// Converts a size with an optional unit suffix: K, M, G (powers of 1024).
+func ToSize(v string) (int64, error) {
+	units := map[string]int64{"K": 1 << 10, "M": 1 << 20, "G": 1 << 30}
+
+	for suffix, unit := range units {
+		if strings.HasSuffix(strings.ToUpper(v), suffix) {
+			res, err := ToInt(v[:(len(v) - 1)])
+			if err != nil {
+				return 0, err
+			}
+
+			return res * unit, nil
+		}
+	}
+
+	return ToInt(v)
+}
+
 func ToBool(v string) (bool, error) {
 	if len(v) == 0 {
 		return false, nil
@@ -116,6 +134,20 @@ func (self Args) IntFull(key string) (int64, bool, error) {
 	return res, true, nil
 }
 
+func (self Args) SizeFull(key string) (int64, bool, error) {
+	v, ok := self[key]
+	if !ok {
+		return 0, false, nil
+	}
+
+	res, err := ToSize(v)
+	if err != nil {
+		return 0, false, err
+	}
+
+	return res, true, nil
+}
+
 func (self Args) Idx(key string) int64 {
 	return self.IdxDef(key, 0)
 }
@@ -143,6 +175,15 @@ func (self Args) IdxExt(key string) (int64, bool) {
 }
 
 func (self Args) IdxFull(key string) (int64, bool, error) {
+	geometry, err := self.GetGeometry(nil)
+	if err != nil {
+		return 0, false, err
+	}
+
+	return self.IdxFullWithGeometry(key, geometry)
+}
+
+func (self Args) IdxFullWithGeometry(key string, geometry *Geometry) (int64, bool, error) {
 	v, ok := self[key]
 	if !ok {
 		return 0, false, nil
@@ -157,7 +198,7 @@ func (self Args) IdxFull(key string) (int64, bool, error) {
 			return 0, false, err
 		}
 
-		return res * int64(4096), true, nil
+		return res * geometry.ClusterSize, true, nil
 
 	case strings.HasSuffix(v, "s"):
 		res, err := ToInt(v[:last])
@@ -165,7 +206,7 @@ func (self Args) IdxFull(key string) (int64, bool, error) {
 			return 0, false, err
 		}
 
-		return res * int64(512), true, nil
+		return res * geometry.SectorSize, true, nil
 
 	default:
 		res, err := ToInt(v)
@@ -177,6 +218,57 @@ func (self Args) IdxFull(key string) (int64, bool, error) {
 	}
 }
 
+func (self Args) GetGeometryOverride() (*Geometry, error) {
+	res := new(Geometry)
+	fields := map[string]*int64{
+		"sector-size":  &res.SectorSize,
+		"cluster-size": &res.ClusterSize,
+		"record-size":  &res.RecordSize,
+		"index-size":   &res.IndexSize,
+	}
+
+	found := false
+	for key, field := range fields {
+		val, ok, err := self.IntFull(key)
+		if err != nil {
+			return nil, err
+		}
+
+		if ok {
+			*field = val
+			found = true
+		}
+	}
+
+	if !found {
+		return nil, nil
+	}
+
+	return res, nil
+}
+
+func (self Args) GetGeometry(base *Geometry) (*Geometry, error) {
+	if base == nil {
+		base = DefaultGeometry()
+	}
+
+	override, err := self.GetGeometryOverride()
+	if err != nil {
+		return nil, err
+	}
+
+	if override == nil {
+		return base, nil
+	}
+
+	res := base.Merge(override)
+	if err := res.Check(); err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
 func GetArgs() Args {
 	res := make(Args)
 	for _, a := range os.Args[2:] {
@@ -0,0 +1,254 @@
+package core
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode/utf16"
+)
+
+type AttrDefFlag uint32
+
+const (
+	ATTRDEF_NONE            AttrDefFlag = 0x00
+	ATTRDEF_INDEXABLE       AttrDefFlag = 0x02
+	ATTRDEF_MULTIPLE        AttrDefFlag = 0x04
+	ATTRDEF_NOT_ZERO        AttrDefFlag = 0x08
+	ATTRDEF_INDEXED_UNIQUE  AttrDefFlag = 0x10
+	ATTRDEF_NAMED_UNIQUE    AttrDefFlag = 0x20
+	ATTRDEF_RESIDENT        AttrDefFlag = 0x40
+	ATTRDEF_LOG_NONRESIDENT AttrDefFlag = 0x80
+)
+
+var attrdef_flags = []struct {
+	flag AttrDefFlag
+	name string
+}{
+	{ATTRDEF_INDEXABLE, "INDEXABLE"},
+	{ATTRDEF_MULTIPLE, "MULTIPLE"},
+	{ATTRDEF_NOT_ZERO, "NOT_ZERO"},
+	{ATTRDEF_INDEXED_UNIQUE, "INDEXED_UNIQUE"},
+	{ATTRDEF_NAMED_UNIQUE, "NAMED_UNIQUE"},
+	{ATTRDEF_RESIDENT, "RESIDENT"},
+	{ATTRDEF_LOG_NONRESIDENT, "LOG_NONRESIDENT"},
+}
+
+func (self AttrDefFlag) String() string {
+	if self == ATTRDEF_NONE {
+		return "NONE"
+	}
+
+	names := make([]string, 0)
+	rest := self
+	for _, def := range attrdef_flags {
+		if (self & def.flag) != ATTRDEF_NONE {
+			names = append(names, def.name)
+			rest &^= def.flag
+		}
+	}
+
+	if rest != ATTRDEF_NONE {
+		names = append(names, fmt.Sprintf("%02X", uint32(rest)))
+	}
+
+	return strings.Join(names, " | ")
+}
+
+// Maximum size of the attributes without limit.
+const ATTRDEF_NO_MAXIMUM = ^uint64(0)
+
+func (self *AttributeDefinition) GetName() string {
+	size := 0
+	for (size < len(self.AttributeName)) && (self.AttributeName[size] != 0) {
+		size++
+	}
+
+	name := make([]uint16, size)
+	for i, c := range self.AttributeName[:size] {
+		name[i] = uint16(c)
+	}
+
+	return string(utf16.Decode(name))
+}
+
+func (self *AttributeDefinition) IsResident() bool {
+	return (self.Flags & ATTRDEF_RESIDENT) != ATTRDEF_NONE
+}
+
+func (self *AttributeDefinition) String() string {
+	max_size := "-"
+	if self.MaximumSize != ATTRDEF_NO_MAXIMUM {
+		max_size = fmt.Sprint(self.MaximumSize)
+	}
+
+	return fmt.Sprintf(
+		"%08X %-24s min= %d, max= %s, collation= %d, flags= %s",
+		uint32(self.AttributeNumber),
+		self.GetName(),
+		self.MinimumSize,
+		max_size,
+		self.CollationRule,
+		self.Flags,
+	)
+}
+
+// Checks the size of a value and its residency against the definition of its type.
+func (self *AttributeDefinition) Check(non_resident bool, size uint64) error {
+	name := self.GetName()
+
+	if non_resident && self.IsResident() {
+		return WrapError(fmt.Errorf("The attribute %s must be resident", name))
+	}
+
+	// An empty value is allowed, as the empty volume names
+	if (size > 0) && (size < self.MinimumSize) {
+		return WrapError(fmt.Errorf("The value of the attribute %s is too small (%d < %d)", name, size, self.MinimumSize))
+	}
+
+	if size > self.MaximumSize {
+		return WrapError(fmt.Errorf("The value of the attribute %s is too big (%d > %d)", name, size, self.MaximumSize))
+	}
+
+	return nil
+}
+
+// Attribute definitions read from the metafile $AttrDef.
+type AttrDefs map[AttributeType]*AttributeDefinition
+
+func (self AttrDefs) Get(attr_type AttributeType) *AttributeDefinition {
+	if self == nil {
+		return nil
+	}
+
+	return self[attr_type]
+}
+
+// Name of a type, the custom types are named by their definition.
+func (self AttrDefs) GetTypeName(attr_type AttributeType) string {
+	if _, ok := attr_types[attr_type]; !ok {
+		if def := self.Get(attr_type); def != nil {
+			return strings.TrimPrefix(def.GetName(), "$")
+		}
+	}
+
+	return attr_type.String()
+}
+
+// Definitions sorted by type.
+func (self AttrDefs) List() []*AttributeDefinition {
+	res := make([]*AttributeDefinition, 0, len(self))
+	for _, def := range self {
+		res = append(res, def)
+	}
+
+	sort.Slice(res, func(i, j int) bool { return res[i].AttributeNumber < res[j].AttributeNumber })
+
+	return res
+}
+
+// Checks an attribute of a MFT record, an attribute without definition is only accepted if its type is a known type.
+func (self AttrDefs) CheckAttribute(desc *AttributeDesc) error {
+	attr_type := desc.Header.AttributeType
+
+	def := self.Get(attr_type)
+	if def == nil {
+		if _, ok := attr_types[attr_type]; ok {
+			return nil
+		}
+
+		return WrapError(fmt.Errorf("The attribute type %08X is not defined", uint32(attr_type)))
+	}
+
+	if !desc.Header.NonResident.Value() {
+		return def.Check(false, uint64(desc.ResidentDesc().ValueLength))
+	}
+
+	// The data size is only in the first extent of a non-resident attribute
+	attr := desc.NonResidentDesc()
+	if attr.LowVcn != 0 {
+		return def.Check(true, 0)
+	}
+
+	return def.Check(true, attr.DataSize)
+}
+
+// Reads the content of $AttrDef, the entries end with an entry without type.
+func ParseAttrDefs(data []byte) (AttrDefs, error) {
+	res := make(AttrDefs)
+
+	var def AttributeDefinition
+
+	entry_size := StructSize(def)
+	for pos := 0; (pos + entry_size) <= len(data); pos += entry_size {
+		if err := Read(data[pos:], &def); err != nil {
+			return nil, err
+		}
+
+		if def.AttributeNumber == ATTR_NONE {
+			break
+		}
+
+		if (def.AttributeNumber == ATTR_END_OF_ATTRIBUTES) || (len(def.GetName()) == 0) {
+			return nil, WrapError(fmt.Errorf("Bad entry in $AttrDef at %d", pos))
+		}
+
+		entry := def
+		res[def.AttributeNumber] = &entry
+	}
+
+	// The definitions of a damaged $AttrDef are not used
+	if res.Get(ATTR_DATA) == nil {
+		return nil, WrapError(fmt.Errorf("No definition of $DATA in $AttrDef"))
+	}
+
+	return res, nil
+}
+
+// Definitions of a volume formated by Windows, they are used when the definitions of the volume are not read.
+func DefaultAttrDefs() AttrDefs {
+	defs := []struct {
+		name   string
+		number AttributeType
+		flags  AttrDefFlag
+		min    uint64
+		max    uint64
+	}{
+		{"$STANDARD_INFORMATION", ATTR_STANDARD_INFORMATION, ATTRDEF_RESIDENT, 0x30, 0x48},
+		{"$ATTRIBUTE_LIST", ATTR_ATTRIBUTE_LIST, ATTRDEF_LOG_NONRESIDENT, 0, ATTRDEF_NO_MAXIMUM},
+		{"$FILE_NAME", ATTR_FILE_NAME, ATTRDEF_RESIDENT | ATTRDEF_INDEXABLE, 0x44, 0x242},
+		{"$OBJECT_ID", ATTR_OBJECT_ID, ATTRDEF_RESIDENT, 0, 0x100},
+		{"$SECURITY_DESCRIPTOR", ATTR_SECURITY_DESCRIPTOR, ATTRDEF_LOG_NONRESIDENT, 0, ATTRDEF_NO_MAXIMUM},
+		{"$VOLUME_NAME", ATTR_VOLUME_NAME, ATTRDEF_RESIDENT, 2, 0x100},
+		{"$VOLUME_INFORMATION", ATTR_VOLUME_INFORMATION, ATTRDEF_RESIDENT, 0xC, 0xC},
+		{"$DATA", ATTR_DATA, ATTRDEF_NONE, 0, ATTRDEF_NO_MAXIMUM},
+		{"$INDEX_ROOT", ATTR_INDEX_ROOT, ATTRDEF_RESIDENT, 0, ATTRDEF_NO_MAXIMUM},
+		{"$INDEX_ALLOCATION", ATTR_INDEX_ALLOCATION, ATTRDEF_LOG_NONRESIDENT, 0, ATTRDEF_NO_MAXIMUM},
+		{"$BITMAP", ATTR_BITMAP, ATTRDEF_LOG_NONRESIDENT, 0, ATTRDEF_NO_MAXIMUM},
+		{"$REPARSE_POINT", ATTR_REPARSE_POINT, ATTRDEF_LOG_NONRESIDENT, 0, 0x4000},
+		{"$EA_INFORMATION", ATTR_EA_INFORMATION, ATTRDEF_RESIDENT, 8, 8},
+		{"$EA", ATTR_EA, ATTRDEF_NONE, 0, 0x10000},
+		{"$LOGGED_UTILITY_STREAM", ATTR_LOGGED_UTILITY_STREAM, ATTRDEF_LOG_NONRESIDENT, 0, 0x10000},
+	}
+
+	res := make(AttrDefs)
+	for _, def := range defs {
+		entry := &AttributeDefinition{
+			AttributeNumber: def.number,
+			Flags:           def.flags,
+			MinimumSize:     def.min,
+			MaximumSize:     def.max,
+		}
+
+		for i, c := range def.name {
+			entry.AttributeName[i] = Char(c)
+		}
+
+		if (def.flags & ATTRDEF_INDEXABLE) != ATTRDEF_NONE {
+			entry.CollationRule = 1
+		}
+
+		res[def.number] = entry
+	}
+
+	return res
+}
@@ -385,9 +385,10 @@ type EaAttribute struct {
 
 type AttributeDefinition struct {
 	AttributeName   [64]Char
-	AttributeNumber uint32
-	Unknown         [2]uint32
-	Flags           uint32
+	AttributeNumber AttributeType
+	DisplayRule     uint32
+	CollationRule   uint32
+	Flags           AttrDefFlag
 	MinimumSize     uint64
 	MaximumSize     uint64
 }
@@ -451,6 +452,15 @@ func (self *AttributeDesc) GetSize() uint64 {
 }
 
 func (self *AttributeDesc) GetValue(io *DiskIO) (*AttributeValue, error) {
+	return self.get_value(io, -1)
+}
+
+// Value with at most the given count of bytes of a non-resident content, the size of the value stays the data size.
+func (self *AttributeDesc) GetValuePreview(io *DiskIO, limit int) (*AttributeValue, error) {
+	return self.get_value(io, limit)
+}
+
+func (self *AttributeDesc) get_value(io *DiskIO, limit int) (*AttributeValue, error) {
 	var data []byte
 	var first_lcn int64
 	var size int
@@ -460,6 +470,10 @@ func (self *AttributeDesc) GetValue(io *DiskIO) (*AttributeValue, error) {
 		attr := self.ResidentDesc()
 		start := self.Index + int(attr.ValueOffset)
 		end := start + int(attr.ValueLength)
+		if end > len(self.Record.Data) {
+			return nil, WrapError(fmt.Errorf("Resident value outside of the record (%d > %d)", end, len(self.Record.Data)))
+		}
+
 		buffer := self.Record.Data[start:end]
 
 		size = len(buffer)
@@ -470,40 +484,25 @@ func (self *AttributeDesc) GetValue(io *DiskIO) (*AttributeValue, error) {
 		attr := self.NonResidentDesc()
 
 		size = int(attr.DataSize)
-		data = make([]byte, size)
-
-		run_datas := self.Record.Data[(self.Index + int(attr.RunArrayOffset)):]
-		run_size := 1
-		lcn, vcn := int64(0), int64(0)
-
-		for i := 0; (run_datas[i] != 0) && (vcn < int64(size)); i += run_size {
-			first := lcn == 0
-			infos := run_datas[i]
-			offs_sz, cnt_sz := int(infos>>4), int(infos&0xF)
-			run_size = offs_sz + cnt_sz + 1
+		if (limit >= 0) && (limit < size) {
+			data = make([]byte, limit)
+		} else {
+			data = make([]byte, size)
+		}
 
-			start := i + 1
-			cnt := DecodeInt(run_datas[start:(start + cnt_sz)])
-			start += cnt_sz
-			if offs_sz > 0 {
-				delta := DecodeInt(run_datas[start:(start + offs_sz)])
-				if delta > 0 {
-					lcn += delta
-					if err := io.ReadClusters(lcn, cnt, data[vcn:]); err != nil {
-						if IsEof(err) {
-							break
-						}
-
-						return nil, err
-					}
-				}
-			}
+		// The run list is used rather than the mapping pairs, it can be merged from several extents
+		runlist := self.GetRunList()
+		for _, run := range runlist {
+			if !run.Zero {
+				first_lcn = int64(run.Start)
 
-			if first {
-				first_lcn = lcn
+				break
 			}
+		}
 
-			vcn += cnt * int64(4096)
+		reader := NewAttributeReader(io, runlist, int64(size), int64(attr.InitializedSize), self.GetCompressionUnit())
+		if _, err := reader.ReadAt(data, 0); (err != nil) && !IsEof(err) {
+			return nil, err
 		}
 
 	default:
@@ -532,6 +531,7 @@ func (self *AttributeDesc) GetValue(io *DiskIO) (*AttributeValue, error) {
 			Content:  nil,
 			Size:     size,
 			Value:    nil,
+			Geometry: io.GetGeometry(),
 		}
 
 		return res, nil
@@ -557,6 +557,7 @@ func (self *AttributeDesc) GetValue(io *DiskIO) (*AttributeValue, error) {
 		Content:  data,
 		Size:     size,
 		Value:    value,
+		Geometry: io.GetGeometry(),
 	}
 
 	return res, nil
@@ -585,9 +586,8 @@ func (self *AttributeDesc) GetRunList() RunList {
 			cnt := DecodeInt(run_datas[start:(start + cnt_sz)])
 
 			start += cnt_sz
-			delta := ClusterNumber(DecodeInt(run_datas[start:(start + offs_sz)]))
-			if delta > 0 {
-				lcn += delta
+			if offs_sz > 0 {
+				lcn += ClusterNumber(DecodeSignedInt(run_datas[start:(start + offs_sz)]))
 
 				res = append(res, &RunEntry{
 					Count: cnt,
@@ -614,6 +614,15 @@ type AttributeValue struct {
 	Data     DataZone
 	Size     int
 	Value    interface{}
+	Geometry *Geometry
+}
+
+func (self *AttributeValue) get_index_size() uint {
+	if self.Geometry == nil {
+		return uint(DEFAULT_INDEX_SIZE)
+	}
+
+	return uint(self.Geometry.IndexSize)
 }
 
 func (self *AttributeValue) get_filename_attribute() *FilenameAttribute {
@@ -645,6 +654,13 @@ func (self *AttributeValue) IsLongName() bool {
 	return (value.NameType & NAME_TYPE_LONG) != 0
 }
 
+// A DOS name is the short name of a long name in the same directory, it's not a hard link.
+func (self *AttributeValue) IsShortName() bool {
+	value := self.get_filename_attribute()
+
+	return (value != nil) && (value.NameType == NAME_TYPE_SHORT)
+}
+
 func (self *AttributeValue) GetParent() data.FileRef {
 	value := self.get_filename_attribute()
 	if value == nil {
@@ -731,9 +747,9 @@ func (self *AttributeValue) GetNextEntry(entry *DirectoryEntry) (*DirectoryEntry
 			bias := uint(StructSize(ia_attr))
 
 			if block_offset == 0 {
-				block_offset = uint(4096) - bias
+				block_offset = self.get_index_size() - bias
 			} else {
-				block_offset += 4096
+				block_offset += self.get_index_size()
 			}
 
 			if uint64(block_offset+bias) >= self.Desc.GetSize() {
@@ -814,9 +830,9 @@ func (self *AttributeValue) GetIndexBlock(entry_position uint) (IndexValue, erro
 
 	for i := uint(0); i < entry_position; i++ {
 		if offset == 0 {
-			offset = block.PrefixSize()
+			offset = block.PrefixSize(int(self.get_index_size()))
 		} else {
-			offset += 4096
+			offset += int(self.get_index_size())
 		}
 
 		if err := Read(self.Data[offset:], block); err != nil {
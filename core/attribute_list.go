@@ -0,0 +1,161 @@
+package core
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/corebreaker/ntfstool/core/data"
+)
+
+// Entry of an $ATTRIBUTE_LIST, it locates an attribute of a file in its base record or in an extension record.
+type AttributeListEntry struct {
+	AttributeListAttribute
+
+	Name string
+}
+
+func (self *AttributeListEntry) GetFileRef() data.FileRef {
+	return data.FileRef(self.FileReferenceNumber)
+}
+
+func (self *AttributeListEntry) String() string {
+	const msg = "%s%s [VCN= %d] in record %d (attribute %d)"
+
+	name := ""
+	if self.Name != "" {
+		name = ":" + self.Name
+	}
+
+	return fmt.Sprintf(msg, self.AttributeType, name, self.LowVcn, self.GetFileRef().GetFileIndex(), self.AttributeNumber)
+}
+
+// Decodes the content of an $ATTRIBUTE_LIST attribute.
+func ParseAttributeList(content []byte) []*AttributeListEntry {
+	res := make([]*AttributeListEntry, 0)
+	header_size := StructSize(AttributeListAttribute{})
+
+	for pos := 0; (pos + header_size) <= len(content); {
+		entry := new(AttributeListEntry)
+		if err := Read(content[pos:], &entry.AttributeListAttribute); err != nil {
+			break
+		}
+
+		if (entry.Length == 0) || (entry.AttributeType == ATTR_END_OF_ATTRIBUTES) || ((pos + int(entry.Length)) > len(content)) {
+			break
+		}
+
+		if entry.NameLength > 0 {
+			start := pos + int(entry.NameOffset)
+			if end := start + (int(entry.NameLength) * 2); end <= len(content) {
+				entry.Name = DecodeString(content[start:end], int(entry.NameLength))
+			}
+		}
+
+		res = append(res, entry)
+		pos += int(entry.Length)
+	}
+
+	return res
+}
+
+// Builds the run list of a non-resident attribute stored in several extents, the extents are sorted by starting VCN,
+// the holes between extents are returned as sparse runs.
+func MergeExtents(extents []*AttributeDesc) (RunList, error) {
+	list := make([]*AttributeDesc, 0, len(extents))
+	for _, extent := range extents {
+		if extent.NonResidentDesc() == nil {
+			return nil, WrapError(fmt.Errorf("The attribute %s is resident, it has no extent", extent.Header.AttributeType))
+		}
+
+		list = append(list, extent)
+	}
+
+	sort.SliceStable(list, func(i, j int) bool {
+		return list[i].NonResidentDesc().LowVcn < list[j].NonResidentDesc().LowVcn
+	})
+
+	res := make(RunList, 0)
+	vcn := ClusterNumber(0)
+
+	for _, extent := range list {
+		desc := extent.NonResidentDesc()
+
+		if desc.LowVcn < vcn {
+			const msg = "The extents of the attribute %s overlap at VCN %d"
+
+			return nil, WrapError(fmt.Errorf(msg, extent.Header.AttributeType, desc.LowVcn))
+		}
+
+		if desc.LowVcn > vcn {
+			res = append(res, &RunEntry{Count: int64(desc.LowVcn - vcn), Zero: true})
+			vcn = desc.LowVcn
+		}
+
+		for _, run := range extent.GetRunList() {
+			entry := *run
+			res = append(res, &entry)
+			vcn += ClusterNumber(run.Count)
+		}
+	}
+
+	return res, nil
+}
+
+// Merges the extents of the non-resident attributes, an attribute in several extents is returned once,
+// as its first extent with the run list of all its extents. The order of the attributes is kept.
+func MergeAttributes(attributes []*AttributeDesc) ([]*AttributeDesc, error) {
+	type tKey struct {
+		attr_type AttributeType
+		name      string
+	}
+
+	groups := make(map[tKey][]*AttributeDesc)
+	for _, attr := range attributes {
+		if attr.NonResidentDesc() == nil {
+			continue
+		}
+
+		key := tKey{attr.Header.AttributeType, attr.Name}
+		groups[key] = append(groups[key], attr)
+	}
+
+	res := make([]*AttributeDesc, 0, len(attributes))
+	for _, attr := range attributes {
+		if attr.NonResidentDesc() == nil {
+			res = append(res, attr)
+
+			continue
+		}
+
+		key := tKey{attr.Header.AttributeType, attr.Name}
+		extents, ok := groups[key]
+		if !ok {
+			continue
+		}
+
+		delete(groups, key)
+
+		if len(extents) == 1 {
+			res = append(res, attr)
+
+			continue
+		}
+
+		first := extents[0]
+		for _, extent := range extents[1:] {
+			if extent.NonResidentDesc().LowVcn < first.NonResidentDesc().LowVcn {
+				first = extent
+			}
+		}
+
+		runlist, err := MergeExtents(extents)
+		if err != nil {
+			return nil, err
+		}
+
+		first.RunList = runlist
+		res = append(res, first)
+	}
+
+	return res, nil
+}
@@ -0,0 +1,290 @@
+package core
+
+import (
+	"fmt"
+	sysio "io"
+	"sort"
+)
+
+// Run of a non-resident attribute with its first VCN.
+type tReaderExtent struct {
+	vcn int64
+	run *RunEntry
+}
+
+// Streaming view over the value of an attribute, the data are read from the disk only when they are requested.
+// The VCNs are mapped through the run list (built at the first read), the sparse runs and the data after
+// the initialized size are read as zeros, and the compressed attributes are decompressed unit by unit.
+type AttributeReader struct {
+	io           *DiskIO
+	runlist      RunList
+	extents      []*tReaderExtent
+	cluster_size int64
+	size         int64
+	initialized  int64
+	unit         int64
+	unit_vcn     int64
+	unit_data    []byte
+	resident     []byte
+	pos          int64
+}
+
+func (self *AttributeReader) get_extents() []*tReaderExtent {
+	if self.extents == nil {
+		self.extents = make([]*tReaderExtent, 0, len(self.runlist))
+
+		vcn := int64(0)
+		for _, run := range self.runlist {
+			self.extents = append(self.extents, &tReaderExtent{vcn: vcn, run: run})
+			vcn += run.Count
+		}
+	}
+
+	return self.extents
+}
+
+// Reads the uncompressed data of the runs, `data` is zero-filled where the run list has no cluster.
+func (self *AttributeReader) read_runs(data []byte, offset int64) error {
+	extents := self.get_extents()
+
+	for len(data) > 0 {
+		vcn := offset / self.cluster_size
+		i := sort.Search(len(extents), func(i int) bool { return (extents[i].vcn + extents[i].run.Count) > vcn })
+		if i == len(extents) {
+			ClearBuffer(data)
+
+			return nil
+		}
+
+		extent := extents[i]
+		run_offset := offset - (extent.vcn * self.cluster_size)
+		count := (extent.run.Count * self.cluster_size) - run_offset
+		if count > int64(len(data)) {
+			count = int64(len(data))
+		}
+
+		part := data[:count]
+		if extent.run.Zero {
+			ClearBuffer(part)
+		} else {
+			position := (int64(extent.run.Start) * self.cluster_size) + run_offset
+			if n, err := self.io.ReadAt(part, position); err != nil {
+				if !IsEof(err) {
+					return err
+				}
+
+				// The clusters after the end of the disk are read as zeros
+				ClearBuffer(part[n:])
+			}
+		}
+
+		data = data[count:]
+		offset += count
+	}
+
+	return nil
+}
+
+// Reads the data of a compressed attribute, the last decompressed unit is kept for the next reads.
+func (self *AttributeReader) read_compressed(data []byte, offset int64) error {
+	unit_size := self.unit * self.cluster_size
+
+	for len(data) > 0 {
+		vcn := (offset / unit_size) * self.unit
+		if (self.unit_data == nil) || (self.unit_vcn != vcn) {
+			if self.unit_data == nil {
+				self.unit_data = make([]byte, unit_size)
+			}
+
+			self.unit_vcn = -1
+
+			ok, err := read_compression_unit(self.io, self.runlist, self.unit, vcn, self.unit_data)
+			if err != nil {
+				return err
+			}
+
+			if !ok {
+				ClearBuffer(self.unit_data)
+			}
+
+			self.unit_vcn = vcn
+		}
+
+		n := copy(data, self.unit_data[(offset%unit_size):])
+		data = data[n:]
+		offset += int64(n)
+	}
+
+	return nil
+}
+
+func (self *AttributeReader) ReadAt(data []byte, offset int64) (int, error) {
+	if offset < 0 {
+		return 0, WrapError(fmt.Errorf("Negative offset %d", offset))
+	}
+
+	if offset >= self.size {
+		return 0, sysio.EOF
+	}
+
+	count := int64(len(data))
+	if remain := self.size - offset; count > remain {
+		count = remain
+	}
+
+	res := data[:count]
+
+	if self.resident != nil {
+		copy(res, self.resident[offset:])
+	} else {
+		// The data after the initialized size are zeros, whatever the clusters contain
+		readable := int64(0)
+		if offset < self.initialized {
+			readable = self.initialized - offset
+		}
+
+		if readable > count {
+			readable = count
+		}
+
+		ClearBuffer(res[readable:])
+
+		if readable > 0 {
+			read := self.read_runs
+			if self.unit > 0 {
+				read = self.read_compressed
+			}
+
+			if err := read(res[:readable], offset); err != nil {
+				return 0, err
+			}
+		}
+	}
+
+	if count < int64(len(data)) {
+		return int(count), sysio.EOF
+	}
+
+	return int(count), nil
+}
+
+func (self *AttributeReader) Read(data []byte) (int, error) {
+	res, err := self.ReadAt(data, self.pos)
+	self.pos += int64(res)
+
+	return res, err
+}
+
+func (self *AttributeReader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case sysio.SeekStart:
+	case sysio.SeekCurrent:
+		offset += self.pos
+
+	case sysio.SeekEnd:
+		offset += self.size
+
+	default:
+		return 0, WrapError(fmt.Errorf("Bad whence %d", whence))
+	}
+
+	if offset < 0 {
+		return 0, WrapError(fmt.Errorf("Negative position %d", offset))
+	}
+
+	self.pos = offset
+
+	return offset, nil
+}
+
+// Size of the data of the attribute.
+func (self *AttributeReader) Size() int64 {
+	return self.size
+}
+
+// Size of the zero-filled regions (unreadable sectors) in the clusters of the data.
+func (self *AttributeReader) GetBadSize() int64 {
+	if self.resident != nil {
+		return 0
+	}
+
+	res := int64(0)
+
+	for _, extent := range self.get_extents() {
+		start := extent.vcn * self.cluster_size
+		if start >= self.size {
+			break
+		}
+
+		if extent.run.Zero {
+			continue
+		}
+
+		size := extent.run.Count * self.cluster_size
+		if remain := self.size - start; size > remain {
+			size = remain
+		}
+
+		for _, bad := range self.io.FindBadRanges(int64(extent.run.Start)*self.cluster_size, size) {
+			res += bad.Size
+		}
+	}
+
+	return res
+}
+
+// Reader over the data of a non-resident attribute, from its run list, its data size, its initialized size
+// and its compression unit (in clusters, zero if it's not compressed), a negative initialized size stands for the data size.
+func NewAttributeReader(io *DiskIO, runlist RunList, size, initialized, unit int64) *AttributeReader {
+	if (initialized < 0) || (initialized > size) {
+		initialized = size
+	}
+
+	return &AttributeReader{
+		io:           io,
+		runlist:      runlist,
+		cluster_size: io.GetGeometry().ClusterSize,
+		size:         size,
+		initialized:  initialized,
+		unit:         unit,
+		unit_vcn:     -1,
+	}
+}
+
+// Reader over data already in memory, as the value of a resident attribute.
+func NewResidentReader(data []byte) *AttributeReader {
+	if data == nil {
+		data = make([]byte, 0)
+	}
+
+	return &AttributeReader{
+		size:     int64(len(data)),
+		resident: data,
+		unit_vcn: -1,
+	}
+}
+
+// Reader over the value of the attribute, the value of a resident attribute is copied.
+func (self *AttributeDesc) GetReader(io *DiskIO) (*AttributeReader, error) {
+	if !self.Header.NonResident.Value() {
+		attr := self.ResidentDesc()
+		start := self.Index + int(attr.ValueOffset)
+		end := start + int(attr.ValueLength)
+		if end > len(self.Record.Data) {
+			return nil, WrapError(fmt.Errorf("Resident value outside of the record (%d > %d)", end, len(self.Record.Data)))
+		}
+
+		data := make([]byte, end-start)
+		copy(data, self.Record.Data[start:end])
+
+		return NewResidentReader(data), nil
+	}
+
+	if io == nil {
+		return nil, WrapError(fmt.Errorf("A disk is needed to read a non-resident attribute"))
+	}
+
+	desc := self.NonResidentDesc()
+
+	return NewAttributeReader(io, self.GetRunList(), int64(desc.DataSize), int64(desc.InitializedSize), self.GetCompressionUnit()), nil
+}
@@ -0,0 +1,255 @@
+package core
+
+import (
+	"fmt"
+)
+
+type ClusterRange struct {
+	Start ClusterNumber
+	Count int64
+}
+
+func (self ClusterRange) GetNext() ClusterNumber {
+	return self.Start + ClusterNumber(self.Count)
+}
+
+func (self ClusterRange) String() string {
+	return fmt.Sprintf("%d - %d [ Count= %d ]", self.Start, self.GetNext()-1, self.Count)
+}
+
+type BitmapStats struct {
+	Total       int64
+	Allocated   int64
+	Free        int64
+	FreeRanges  int64
+	LargestFree int64
+	ClusterSize int64
+}
+
+func (self BitmapStats) String() string {
+	ratio := float64(0)
+	if self.Total > 0 {
+		ratio = float64(self.Allocated) * 100 / float64(self.Total)
+	}
+
+	const msg = "clusters=%d allocated=%d (%.1f%%) free=%d in %d ranges, largest free range=%d clusters"
+
+	return fmt.Sprintf(msg, self.Total, self.Allocated, ratio, self.Free, self.FreeRanges, self.LargestFree)
+}
+
+// Allocation map of the clusters of a volume, as stored in the $Bitmap metafile.
+type ClusterBitmap struct {
+	data     []byte
+	clusters int64
+}
+
+func (self *ClusterBitmap) GetClusterCount() int64 {
+	return self.clusters
+}
+
+// Clusters outside the volume are considered as allocated.
+func (self *ClusterBitmap) IsAllocated(lcn ClusterNumber) bool {
+	if int64(lcn) >= self.clusters {
+		return true
+	}
+
+	return (self.data[lcn>>3] & (1 << uint(lcn&7))) != 0
+}
+
+func (self *ClusterBitmap) CountAllocated(lcn ClusterNumber, count int64) int64 {
+	res := int64(0)
+	for i := int64(0); i < count; i++ {
+		if self.IsAllocated(lcn + ClusterNumber(i)) {
+			res++
+		}
+	}
+
+	return res
+}
+
+// True if all the clusters of the range are allocated.
+func (self *ClusterBitmap) IsRangeAllocated(lcn ClusterNumber, count int64) bool {
+	return self.CountAllocated(lcn, count) == count
+}
+
+// True if none of the clusters of the range are allocated.
+func (self *ClusterBitmap) IsRangeFree(lcn ClusterNumber, count int64) bool {
+	return self.CountAllocated(lcn, count) == 0
+}
+
+// Length of the run of clusters starting at `lcn` with the same allocation state, limited to `max`.
+func (self *ClusterBitmap) GetRunLength(lcn ClusterNumber, max int64) int64 {
+	if remain := self.clusters - int64(lcn); (remain > 0) && (max > remain) {
+		max = remain
+	}
+
+	state := self.IsAllocated(lcn)
+
+	full := byte(0)
+	if state {
+		full = 0xFF
+	}
+
+	res := int64(1)
+	for res < max {
+		cur := lcn + ClusterNumber(res)
+
+		// Whole bytes are skipped at once
+		if ((cur & 7) == 0) && ((res + 8) <= max) && (int64(cur+8) <= self.clusters) && (self.data[cur>>3] == full) {
+			res += 8
+
+			continue
+		}
+
+		if self.IsAllocated(cur) != state {
+			break
+		}
+
+		res++
+	}
+
+	return res
+}
+
+func (self *ClusterBitmap) get_ranges(allocated bool) []ClusterRange {
+	res := make([]ClusterRange, 0)
+
+	for lcn := int64(0); lcn < self.clusters; {
+		count := self.GetRunLength(ClusterNumber(lcn), self.clusters-lcn)
+		if self.IsAllocated(ClusterNumber(lcn)) == allocated {
+			res = append(res, ClusterRange{Start: ClusterNumber(lcn), Count: count})
+		}
+
+		lcn += count
+	}
+
+	return res
+}
+
+func (self *ClusterBitmap) GetAllocatedRanges() []ClusterRange {
+	return self.get_ranges(true)
+}
+
+func (self *ClusterBitmap) GetFreeRanges() []ClusterRange {
+	return self.get_ranges(false)
+}
+
+func (self *ClusterBitmap) GetStats(cluster_size int64) BitmapStats {
+	res := BitmapStats{
+		Total:       self.clusters,
+		ClusterSize: cluster_size,
+	}
+
+	for _, free := range self.GetFreeRanges() {
+		res.Free += free.Count
+		res.FreeRanges++
+
+		if free.Count > res.LargestFree {
+			res.LargestFree = free.Count
+		}
+	}
+
+	res.Allocated = res.Total - res.Free
+
+	return res
+}
+
+func NewClusterBitmap(data []byte, clusters int64) *ClusterBitmap {
+	if max := int64(len(data)) * 8; (clusters <= 0) || (clusters > max) {
+		clusters = max
+	}
+
+	return &ClusterBitmap{
+		data:     data,
+		clusters: clusters,
+	}
+}
+
+// Source where the clusters of a volume with a given allocation state are read as zeros, without any I/O.
+type tMaskSource struct {
+	source       BlockSource
+	bitmap       *ClusterBitmap
+	offset       int64
+	cluster_size int64
+	allocated    bool
+}
+
+func (self *tMaskSource) ReadAt(data []byte, offset int64) (int, error) {
+	res := 0
+
+	for res < len(data) {
+		pos := offset + int64(res) - self.offset
+		buffer := data[res:]
+
+		if (pos < 0) || (pos >= (self.bitmap.GetClusterCount() * self.cluster_size)) {
+			if pos < 0 {
+				if int64(len(buffer)) > -pos {
+					buffer = buffer[:-pos]
+				}
+			}
+
+			n, err := self.source.ReadAt(buffer, offset+int64(res))
+			res += n
+
+			if err != nil {
+				return res, err
+			}
+
+			continue
+		}
+
+		lcn := ClusterNumber(pos / self.cluster_size)
+		max := (int64(len(buffer)) + (pos % self.cluster_size) + self.cluster_size - 1) / self.cluster_size
+		count := self.bitmap.GetRunLength(lcn, max)
+
+		if size := (count * self.cluster_size) - (pos % self.cluster_size); int64(len(buffer)) > size {
+			buffer = buffer[:size]
+		}
+
+		if self.bitmap.IsAllocated(lcn) == self.allocated {
+			ClearBuffer(buffer)
+			res += len(buffer)
+
+			continue
+		}
+
+		n, err := self.source.ReadAt(buffer, offset+int64(res))
+		res += n
+
+		if err != nil {
+			return res, err
+		}
+	}
+
+	return res, nil
+}
+
+func (self *tMaskSource) Size() int64 {
+	return self.source.Size()
+}
+
+func (self *tMaskSource) SectorSize() int64 {
+	return self.source.SectorSize()
+}
+
+func (self *tMaskSource) Inner() BlockSource {
+	return self.source
+}
+
+func (self *tMaskSource) Close() error {
+	return nil
+}
+
+// Shared disk where the clusters allocated (or free) in the bitmap are read as zeros.
+func MaskDisk(disk *DiskIO, bitmap *ClusterBitmap, allocated bool) *DiskIO {
+	res := disk.Shift(0)
+	res.source = &tMaskSource{
+		source:       disk.source,
+		bitmap:       bitmap,
+		offset:       disk.offset,
+		cluster_size: disk.GetGeometry().ClusterSize,
+		allocated:    allocated,
+	}
+
+	return res
+}
@@ -0,0 +1,252 @@
+package core
+
+import (
+	"container/list"
+	"fmt"
+	"sync"
+)
+
+const DEFAULT_READ_AHEAD = 8
+
+type CacheStats struct {
+	Hits      int64
+	Misses    int64
+	ReadAhead int64
+}
+
+func (self CacheStats) String() string {
+	ratio := float64(0)
+	if total := self.Hits + self.Misses; total > 0 {
+		ratio = float64(self.Hits) * 100 / float64(total)
+	}
+
+	const msg = "hits=%d misses=%d read-ahead=%d blocks (hit ratio: %.1f%%)"
+
+	return fmt.Sprintf(msg, self.Hits, self.Misses, self.ReadAhead, ratio)
+}
+
+type tCacheBlock struct {
+	index int64
+	data  []byte
+}
+
+// LRU cache of fixed size blocks, sequential misses read the following blocks ahead.
+type CacheSource struct {
+	source     BlockSource
+	size       int64
+	block_size int64
+	capacity   int
+	read_ahead int
+	blocks     map[int64]*list.Element
+	lru        *list.List
+	last_miss  int64
+	stats      CacheStats
+	mutex      sync.Mutex
+}
+
+func (self *CacheSource) add_block(index int64, data []byte) {
+	if elem, ok := self.blocks[index]; ok {
+		elem.Value.(*tCacheBlock).data = data
+		self.lru.MoveToFront(elem)
+
+		return
+	}
+
+	self.blocks[index] = self.lru.PushFront(&tCacheBlock{index: index, data: data})
+
+	for self.lru.Len() > self.capacity {
+		last := self.lru.Back()
+
+		self.lru.Remove(last)
+		delete(self.blocks, last.Value.(*tCacheBlock).index)
+	}
+}
+
+func (self *CacheSource) read(index int64, count int64) ([]byte, error) {
+	buffer := make([]byte, count*self.block_size)
+
+	n, err := self.source.ReadAt(buffer, index*self.block_size)
+	if (err != nil) && (!IsEof(err)) {
+		return nil, err
+	}
+
+	return buffer[:n], nil
+}
+
+func (self *CacheSource) get_block(index int64) ([]byte, error) {
+	if elem, ok := self.blocks[index]; ok {
+		self.stats.Hits++
+		self.lru.MoveToFront(elem)
+
+		return elem.Value.(*tCacheBlock).data, nil
+	}
+
+	self.stats.Misses++
+
+	count := int64(1)
+	if (index == (self.last_miss + 1)) && (self.read_ahead > 0) {
+		count += int64(self.read_ahead)
+
+		last := (self.source.Size() + self.block_size - 1) / self.block_size
+		if (index + count) > last {
+			count = last - index
+		}
+
+		for i := int64(1); i < count; i++ {
+			if _, ok := self.blocks[index+i]; ok {
+				count = i
+				break
+			}
+		}
+	}
+
+	data, err := self.read(index, count)
+	if (err != nil) && (count > 1) {
+		// A bad area in the read-ahead must not fail the requested block
+		count = 1
+		data, err = self.read(index, count)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	self.last_miss = index + count - 1
+	self.stats.ReadAhead += count - 1
+
+	for i := count - 1; i >= 0; i-- {
+		start := i * self.block_size
+		if start >= int64(len(data)) {
+			continue
+		}
+
+		end := start + self.block_size
+		if end > int64(len(data)) {
+			end = int64(len(data))
+		}
+
+		// Each block has its own buffer, a cached block must not keep the whole read-ahead buffer
+		block := make([]byte, end-start)
+		copy(block, data[start:end])
+
+		self.add_block(index+i, block)
+	}
+
+	if int64(len(data)) > self.block_size {
+		data = data[:self.block_size]
+	}
+
+	return data, nil
+}
+
+func (self *CacheSource) ReadAt(data []byte, offset int64) (int, error) {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	return read_blocks(data, offset, self.source.Size(), self.block_size, func(buffer []byte, block, start int64) error {
+		cached, err := self.get_block(block)
+		if err != nil {
+			return err
+		}
+
+		if start < int64(len(cached)) {
+			cached = cached[start:]
+		} else {
+			cached = nil
+		}
+
+		n := copy(buffer, cached)
+		ClearBuffer(buffer[n:])
+
+		return nil
+	})
+}
+
+func (self *CacheSource) Size() int64 {
+	return self.source.Size()
+}
+
+func (self *CacheSource) SectorSize() int64 {
+	return self.source.SectorSize()
+}
+
+func (self *CacheSource) Inner() BlockSource {
+	return self.source
+}
+
+func (self *CacheSource) Close() error {
+	return self.source.Close()
+}
+
+// Changes the size of the blocks, with the same size of the cache, the cached blocks are dropped.
+// The cache is made before the geometry is known, then its blocks are set to the cluster size of the volume.
+func (self *CacheSource) SetBlockSize(block_size int64) {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	if (block_size <= 0) || (block_size == self.block_size) {
+		return
+	}
+
+	self.block_size = block_size
+	self.capacity = int(self.size / block_size)
+	if self.capacity < 1 {
+		self.capacity = 1
+	}
+
+	self.blocks = make(map[int64]*list.Element)
+	self.lru = list.New()
+	self.last_miss = -2
+}
+
+func (self *CacheSource) GetStats() CacheStats {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	return self.stats
+}
+
+func (self *CacheSource) ResetStats() {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	self.stats = CacheStats{}
+}
+
+// Cache of `size` bytes made of blocks of `block_size` bytes.
+func CacheTransform(size, block_size int64, read_ahead int) SourceTransform {
+	return func(source BlockSource) (BlockSource, error) {
+		if block_size <= 0 {
+			block_size = DEFAULT_CLUSTER_SIZE
+		}
+
+		capacity := int(size / block_size)
+		if capacity < 1 {
+			capacity = 1
+		}
+
+		res := &CacheSource{
+			source:     source,
+			size:       size,
+			block_size: block_size,
+			capacity:   capacity,
+			read_ahead: read_ahead,
+			blocks:     make(map[int64]*list.Element),
+			lru:        list.New(),
+			last_miss:  -2,
+		}
+
+		return res, nil
+	}
+}
+
+// Finds the cache in a stack of sources.
+func FindCache(source BlockSource) *CacheSource {
+	res, _ := find_source(source, func(source BlockSource) bool {
+		_, ok := source.(*CacheSource)
+
+		return ok
+	}).(*CacheSource)
+
+	return res
+}
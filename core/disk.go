@@ -1,7 +1,7 @@
 package core
 
 import (
-	"os"
+	"fmt"
 	"reflect"
 )
 
@@ -9,156 +9,243 @@ var (
 	header = reflect.TypeOf(RecordHeader{})
 )
 
-type tSharedFile struct {
-	file           *os.File
-	instance_count uint
+type DiskIO struct {
+	source   BlockSource
+	geometry *Geometry
+	offset   int64
+	size     int64
+	shared   bool
+	lenient  bool
+	defs     AttrDefs
 }
 
-func (self *tSharedFile) inc() *tSharedFile {
-	self.instance_count++
+func (self *DiskIO) GetOffset() int64 {
+	return self.offset
+}
 
-	return self
+func (self *DiskIO) SetOffset(offset int64) {
+	self.offset = offset
 }
 
-func (self *tSharedFile) close() error {
-	self.instance_count--
-	if self.instance_count != 0 {
-		return nil
+func (self *DiskIO) GetSource() BlockSource {
+	return self.source
+}
+
+func (self *DiskIO) GetGeometry() *Geometry {
+	if self == nil {
+		return DefaultGeometry()
 	}
 
-	return WrapError(self.file.Close())
-}
+	if self.geometry == nil {
+		res := DefaultGeometry()
+		if sector_size := self.source.SectorSize(); sector_size > res.SectorSize {
+			res.SectorSize = sector_size
+			if res.ClusterSize < sector_size {
+				res.ClusterSize = sector_size
+			}
+		}
 
-type DiskIO struct {
-	in     *tSharedFile
-	buffer [512]byte
-	offset int64
-}
+		return res
+	}
 
-func (self *DiskIO) GetOffset() int64 {
-	return self.offset
+	return self.geometry
 }
 
-func (self *DiskIO) SetOffset(offset int64) {
-	self.offset = offset
+func (self *DiskIO) SetGeometry(geometry *Geometry) {
+	self.geometry = geometry
 }
 
+// The shifted disk shares the source, closing it does not close the source.
 func (self *DiskIO) Shift(offset int64) *DiskIO {
+	size := int64(0)
+	if self.size > 0 {
+		size = self.size - offset
+	}
+
 	return &DiskIO{
-		in:     self.in.inc(),
-		offset: self.offset + offset,
+		source:   self.source,
+		geometry: self.geometry,
+		offset:   self.offset + offset,
+		size:     size,
+		shared:   true,
+		lenient:  self.lenient,
+		defs:     self.defs,
 	}
 }
 
-func (self *DiskIO) ReadSector(position int64, data []byte) error {
-	buffer := data
-	to_copy := false
+// Limits the size of the disk, ie: to the size of a partition, a null size means up to the end of the source.
+func (self *DiskIO) SetSize(size int64) {
+	self.size = size
+}
 
-	buf_sz := len(buffer)
-	if buf_sz > 512 {
-		buffer = buffer[:512]
-	} else {
-		to_copy = buf_sz < 512
-		if to_copy {
-			buffer = self.buffer[:]
-		}
+func (self *DiskIO) GetSize() int64 {
+	if self.size > 0 {
+		return self.size
 	}
 
-	_, err := self.in.file.ReadAt(buffer, self.offset+(position*512))
+	return self.source.Size() - self.offset
+}
+
+// In lenient mode, the readable sectors of torn records are kept, the torn ones are zero-filled.
+func (self *DiskIO) SetLenient(lenient bool) {
+	self.lenient = lenient
+}
+
+func (self *DiskIO) IsLenient() bool {
+	return self.lenient
+}
+
+// Definitions of the volume used to check the attributes of the records, no check is done without them.
+func (self *DiskIO) SetAttrDefs(defs AttrDefs) {
+	self.defs = defs
+}
+
+func (self *DiskIO) GetAttrDefs() AttrDefs {
+	return self.defs
+}
 
-	if (err == nil) && to_copy {
-		copy(data, buffer)
+// Bad ranges which were zero-filled by the rescue source, if any.
+func (self *DiskIO) FindBadRanges(position, size int64) []RescueRange {
+	rescue := FindRescue(self.source)
+	if rescue == nil {
+		return nil
 	}
 
-	return WrapError(err)
+	return rescue.GetMap().Find(self.offset+position, size, RESCUE_BAD)
 }
 
-func (self *DiskIO) ReadSectors(position, count int64, data []byte) error {
-	buffer := data
-	to_copy := false
+func (self *DiskIO) ReadAt(data []byte, position int64) (int, error) {
+	n, err := self.source.ReadAt(data, self.offset+position)
 
-	buf_sz := len(buffer)
-	read_sz := int(count * 512)
-	if buf_sz > read_sz {
-		buffer = buffer[:read_sz]
-	} else {
-		to_copy = buf_sz < 512
-		if to_copy {
-			buffer = self.buffer[:]
-		}
+	return n, WrapError(err)
+}
+
+// Writes are only done into an overlay, the source is never modified.
+func (self *DiskIO) WriteAt(data []byte, position int64) (int, error) {
+	overlay := FindOverlay(self.source)
+	if overlay == nil {
+		return 0, WrapError(fmt.Errorf("The disk is read-only, an overlay is needed to write into it"))
 	}
 
-	_, err := self.in.file.ReadAt(buffer, self.offset+(position*512))
+	if (self.size > 0) && ((position + int64(len(data))) > self.size) {
+		return 0, WrapError(fmt.Errorf("Write of %d bytes at %d beyond the end of the disk", len(data), position))
+	}
+
+	return overlay.WriteAt(data, self.offset+position)
+}
+
+func (self *DiskIO) ReadSector(position int64, data []byte) error {
+	return self.ReadSectors(position, 1, data)
+}
+
+func (self *DiskIO) ReadSectors(position, count int64, data []byte) error {
+	sector_size := self.GetGeometry().SectorSize
 
-	if (err == nil) && to_copy {
-		copy(data, buffer)
+	buffer := data
+	if read_sz := count * sector_size; int64(len(buffer)) > read_sz {
+		buffer = buffer[:read_sz]
 	}
 
-	return WrapError(err)
+	_, err := self.ReadAt(buffer, position*sector_size)
+
+	return err
 }
 
 func (self *DiskIO) ReadCluster(position int64, data []byte) error {
-	return self.ReadSectors(position*8, 8, data)
+	return self.ReadClusters(position, 1, data)
 }
 
 func (self *DiskIO) ReadClusters(position, count int64, data []byte) error {
-	return self.ReadSectors(position*8, 8*count, data)
+	sectors := self.GetGeometry().SectorsPerCluster()
+
+	return self.ReadSectors(position*sectors, count*sectors, data)
 }
 
 func (self *DiskIO) ReadStruct(position int64, ptr interface{}) error {
-	sz := int64(StructSize(ptr))
-	buffer := make([]byte, sz)
+	return self.ReadStructAt(position*self.GetGeometry().SectorSize, ptr)
+}
+
+func (self *DiskIO) ReadStructAt(offset int64, ptr interface{}) error {
+	_, err := self.ReadRecordAt(offset, ptr)
 
-	if err := self.ReadSectors(position, (sz+511)/512, buffer); err != nil {
-		return err
+	return err
+}
+
+// Record with a variable size, decoded from its whole content (cf: FileRecord).
+type tRecordDecoder interface {
+	decode_record(buffer []byte) error
+}
+
+// Reads a structure, for FILE and INDX records the whole record is read to apply and check the fixups,
+// the returned status is nil for other structures.
+func (self *DiskIO) ReadRecordAt(offset int64, ptr interface{}) (*FixupStatus, error) {
+	decoder, is_decoder := ptr.(tRecordDecoder)
+
+	// A FILE record has the size of the geometry, the fixups can extend it
+	var sz int64
+	if is_decoder {
+		sz = self.GetGeometry().RecordSize
+	} else {
+		sz = int64(StructSize(ptr))
 	}
 
-	first := reflect.ValueOf(ptr).Elem().Type().Field(0)
-	if first.Anonymous && (first.Type == header) {
-		var h RecordHeader
+	buffer := make([]byte, sz)
+
+	if _, err := self.ReadAt(buffer, offset); err != nil {
+		return nil, err
+	}
 
-		if err := Read(buffer, &h); err != nil {
-			return WrapError(err)
+	if !is_decoder {
+		first := reflect.ValueOf(ptr).Elem().Type().Field(0)
+		if !(first.Anonymous && (first.Type == header)) {
+			return nil, WrapError(Read(buffer, ptr))
 		}
+	}
 
-		if (h.UsaCount <= 3) && ((h.UsaOffset + (h.UsaCount * 2)) < 1024) {
-			idx := int64(h.UsaOffset + 2)
-			pos := int64(510) // 255 * 2
-			for i := uint16(1); i < h.UsaCount; i++ {
-				if (pos >= sz) || ((idx + 2) >= sz) {
-					break
-				}
-
-				copy(buffer[pos:], buffer[idx:(idx+2)])
-				idx += 2
-				pos += 512
-			}
+	var h RecordHeader
+
+	if err := Read(buffer, &h); err != nil {
+		return nil, WrapError(err)
+	}
+
+	if record_sz := FixupSize(&h); (record_sz > sz) && (record_sz <= MAX_RECORD_SIZE) {
+		buffer = make([]byte, record_sz)
+
+		if _, err := self.ReadAt(buffer, offset); err != nil {
+			return nil, err
 		}
 	}
 
-	return WrapError(Read(buffer, ptr))
+	status := ApplyFixups(buffer, self.lenient)
+	if is_decoder {
+		return status, decoder.decode_record(buffer)
+	}
+
+	return status, WrapError(Read(buffer, ptr))
 }
 
 func (self *DiskIO) Close() error {
-	if self == nil {
+	if (self == nil) || self.shared {
 		return nil
 	}
 
-	return self.in.close()
+	return WrapError(self.source.Close())
+}
+
+func NewDisk(source BlockSource) *DiskIO {
+	return &DiskIO{source: source}
 }
 
-func OpenDisk(name string) (*DiskIO, error) {
-	file, err := os.Open(name)
+func OpenDisk(name string, transforms ...SourceTransform) (*DiskIO, error) {
+	source, err := OpenSource(name)
 	if err != nil {
-		return nil, WrapError(err)
+		return nil, err
 	}
 
-	res := &DiskIO{
-		in: &tSharedFile{
-			file:           file,
-			instance_count: 1,
-		},
+	source, err = StackSource(source, transforms...)
+	if err != nil {
+		return nil, err
 	}
 
-	return res, nil
+	return NewDisk(source), nil
 }
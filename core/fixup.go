@@ -0,0 +1,98 @@
+package core
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// Size of the blocks protected by an entry of the update sequence array, whatever the sector size is.
+const FIXUP_STRIDE = 512
+
+// Biggest FILE or INDX record which is read as a whole to check its fixups.
+const MAX_RECORD_SIZE = 64 * 1024
+
+// Result of the application of the update sequence array on a FILE or INDX record.
+type FixupStatus struct {
+	Sectors int
+	Torn    []int
+	Bad     bool
+}
+
+// True if the update sequence array is unusable or if at least a sector trailer does not match the USN.
+func (self *FixupStatus) IsTorn() bool {
+	return (self != nil) && (self.Bad || (len(self.Torn) > 0))
+}
+
+// True if the record cannot be used at all, even by keeping its readable sectors.
+func (self *FixupStatus) IsBroken() bool {
+	return (self != nil) && (self.Bad || ((len(self.Torn) > 0) && (self.Torn[0] == 0)))
+}
+
+func (self *FixupStatus) String() string {
+	if self.Bad {
+		return "invalid update sequence array"
+	}
+
+	if len(self.Torn) == 0 {
+		return fmt.Sprintf("%d sectors, valid", self.Sectors)
+	}
+
+	return fmt.Sprintf("%d sectors, torn sectors: %v", self.Sectors, self.Torn)
+}
+
+// Size of the record protected by the update sequence array of the header.
+func FixupSize(header *RecordHeader) int64 {
+	if header.UsaCount < 2 {
+		return 0
+	}
+
+	return int64(header.UsaCount-1) * FIXUP_STRIDE
+}
+
+// Checks each sector trailer of the record against the update sequence number, then restores the original
+// values from the update sequence array. In lenient mode, the torn sectors are zero-filled, so only the readable
+// sectors are kept, otherwise they are left as read.
+func ApplyFixups(buffer []byte, lenient bool) *FixupStatus {
+	var header RecordHeader
+
+	res := new(FixupStatus)
+	if err := Read(buffer, &header); err != nil {
+		res.Bad = true
+
+		return res
+	}
+
+	size := int64(len(buffer))
+	usa_start := int64(header.UsaOffset)
+	usa_end := usa_start + int64(header.UsaCount)*2
+
+	if (header.UsaCount < 2) || (usa_end > FIXUP_STRIDE) || (usa_end > size) || (FixupSize(&header) > size) {
+		res.Bad = true
+
+		return res
+	}
+
+	res.Sectors = int(header.UsaCount - 1)
+	usn := buffer[usa_start:(usa_start + 2)]
+
+	for i := 0; i < res.Sectors; i++ {
+		start := int64(i) * FIXUP_STRIDE
+		pos := start + FIXUP_STRIDE - 2
+		idx := usa_start + int64(i+1)*2
+
+		if binary.LittleEndian.Uint16(buffer[pos:]) != binary.LittleEndian.Uint16(usn) {
+			res.Torn = append(res.Torn, i)
+
+			// The first sector holds the header, it is never cleared
+			if lenient && (i > 0) {
+				ClearBuffer(buffer[start:(start + FIXUP_STRIDE)])
+			}
+
+			continue
+		}
+
+		copy(buffer[pos:], buffer[idx:(idx+2)])
+	}
+
+	return res
+}
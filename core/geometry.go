@@ -0,0 +1,143 @@
+package core
+
+import (
+	"fmt"
+)
+
+const (
+	DEFAULT_SECTOR_SIZE  int64 = 512
+	DEFAULT_CLUSTER_SIZE int64 = 4096
+	DEFAULT_RECORD_SIZE  int64 = 1024
+	DEFAULT_INDEX_SIZE   int64 = 4096
+)
+
+type Geometry struct {
+	SectorSize  int64
+	ClusterSize int64
+	RecordSize  int64
+	IndexSize   int64
+}
+
+func (self *Geometry) SectorsPerCluster() int64 {
+	return self.ClusterSize / self.SectorSize
+}
+
+func (self *Geometry) ClusterToSector(lcn int64) int64 {
+	return lcn * self.SectorsPerCluster()
+}
+
+func (self *Geometry) SectorOf(offset int64) int64 {
+	return (offset + self.SectorSize - 1) / self.SectorSize
+}
+
+func (self *Geometry) ClusterOf(offset int64) int64 {
+	return (offset + self.ClusterSize - 1) / self.ClusterSize
+}
+
+func (self *Geometry) Merge(other *Geometry) *Geometry {
+	res := *self
+
+	if other == nil {
+		return &res
+	}
+
+	if other.SectorSize != 0 {
+		res.SectorSize = other.SectorSize
+	}
+
+	if other.ClusterSize != 0 {
+		res.ClusterSize = other.ClusterSize
+	}
+
+	if other.RecordSize != 0 {
+		res.RecordSize = other.RecordSize
+	}
+
+	if other.IndexSize != 0 {
+		res.IndexSize = other.IndexSize
+	}
+
+	return &res
+}
+
+func (self *Geometry) Check() error {
+	check := func(name string, value int64) error {
+		if (value < 256) || ((value & (value - 1)) != 0) {
+			return WrapError(fmt.Errorf("Bad %s: %d (should be a power of 2, at least 256)", name, value))
+		}
+
+		return nil
+	}
+
+	if err := check("sector size", self.SectorSize); err != nil {
+		return err
+	}
+
+	if err := check("cluster size", self.ClusterSize); err != nil {
+		return err
+	}
+
+	if err := check("file record size", self.RecordSize); err != nil {
+		return err
+	}
+
+	if err := check("index block size", self.IndexSize); err != nil {
+		return err
+	}
+
+	if self.ClusterSize < self.SectorSize {
+		return WrapError(fmt.Errorf("Cluster size %d is less than sector size %d", self.ClusterSize, self.SectorSize))
+	}
+
+	return nil
+}
+
+func (self *Geometry) String() string {
+	const msg = "{Sector=%d Cluster=%d Record=%d Index=%d}"
+
+	return fmt.Sprintf(msg, self.SectorSize, self.ClusterSize, self.RecordSize, self.IndexSize)
+}
+
+func DefaultGeometry() *Geometry {
+	return &Geometry{
+		SectorSize:  DEFAULT_SECTOR_SIZE,
+		ClusterSize: DEFAULT_CLUSTER_SIZE,
+		RecordSize:  DEFAULT_RECORD_SIZE,
+		IndexSize:   DEFAULT_INDEX_SIZE,
+	}
+}
+
+// Sizes of file records and index blocks are stored as a signed byte:
+// positive values count clusters, negative values are a power of 2 in bytes.
+func decode_block_size(value uint32, cluster_size int64) int64 {
+	v := int8(value & 0xFF)
+	if v < 0 {
+		return int64(1) << uint(-v)
+	}
+
+	return int64(v) * cluster_size
+}
+
+func (self *BootBlock) GetGeometry() (*Geometry, error) {
+	sector_size := int64(self.BytesPerSector)
+
+	sectors_per_cluster := int64(self.SectorsPerCluster)
+	if sectors_per_cluster > 0x80 {
+		sectors_per_cluster = int64(1) << uint(256-sectors_per_cluster)
+	}
+
+	cluster_size := sector_size * sectors_per_cluster
+
+	res := &Geometry{
+		SectorSize:  sector_size,
+		ClusterSize: cluster_size,
+		RecordSize:  decode_block_size(self.ClustersPerFileRecord, cluster_size),
+		IndexSize:   decode_block_size(self.ClustersPerIndexBlock, cluster_size),
+	}
+
+	if err := res.Check(); err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
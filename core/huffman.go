@@ -0,0 +1,60 @@
+package core
+
+import (
+	"fmt"
+)
+
+// Canonical Huffman code (codes ordered by length, then by symbol), as used by XPRESS and LZX.
+// The codes are decoded bit by bit, from the most significant one.
+type tHuffman struct {
+	counts  []int
+	symbols []int
+}
+
+func make_huffman(lengths []uint8, max_length int) (*tHuffman, error) {
+	res := &tHuffman{
+		counts:  make([]int, max_length+1),
+		symbols: make([]int, 0, len(lengths)),
+	}
+
+	for symbol, length := range lengths {
+		if int(length) > max_length {
+			return nil, WrapError(fmt.Errorf("Huffman code of the symbol %d too long (%d bits)", symbol, length))
+		}
+
+		res.counts[length]++
+	}
+
+	res.counts[0] = 0
+
+	for length := 1; length <= max_length; length++ {
+		for symbol, symbol_length := range lengths {
+			if int(symbol_length) == length {
+				res.symbols = append(res.symbols, symbol)
+			}
+		}
+	}
+
+	return res, nil
+}
+
+// Decodes a symbol with the bits returned by `next`, it returns the symbol and the length of its code.
+func (self *tHuffman) decode(next func() uint32) (int, int, error) {
+	code, first, index := 0, 0, 0
+
+	for length := 1; length < len(self.counts); length++ {
+		code |= int(next())
+		count := self.counts[length]
+
+		if (code - count) < first {
+			return self.symbols[index+(code-first)], length, nil
+		}
+
+		index += count
+		first += count
+		first <<= 1
+		code <<= 1
+	}
+
+	return 0, 0, WrapError(fmt.Errorf("Bad Huffman code"))
+}
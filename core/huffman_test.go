@@ -0,0 +1,68 @@
+package core
+
+import (
+	"testing"
+)
+
+// Canonical Huffman code built as make_huffman does, to write the streams of the tests.
+type tTestCode struct {
+	lengths []uint8
+	codes   []uint32
+}
+
+func make_test_code(lengths []uint8) *tTestCode {
+	res := &tTestCode{
+		lengths: lengths,
+		codes:   make([]uint32, len(lengths)),
+	}
+
+	code := uint32(0)
+	for length := uint8(1); length <= _LZX_MAX_LENGTH; length++ {
+		for symbol, symbol_length := range lengths {
+			if symbol_length == length {
+				res.codes[symbol] = code
+				code++
+			}
+		}
+
+		code <<= 1
+	}
+
+	return res
+}
+
+func TestHuffmanCanonicalCodes(t *testing.T) {
+	// Codes: 1= 0, 0= 10, 2= 110, 3= 111
+	lengths := []uint8{2, 1, 3, 3, 0}
+	code := make_test_code(lengths)
+
+	huffman, err := make_huffman(lengths, _XPRESS_MAX_LENGTH)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for symbol, length := range lengths {
+		if length == 0 {
+			continue
+		}
+
+		bit := uint(length)
+		decoded, decoded_length, err := huffman.decode(func() uint32 {
+			bit--
+
+			return (code.codes[symbol] >> bit) & 1
+		})
+
+		if err != nil {
+			t.Fatalf("Symbol %d: %v", symbol, err)
+		}
+
+		if (decoded != symbol) || (decoded_length != int(length)) {
+			t.Errorf("Symbol %d: decoded as %d (length= %d)", symbol, decoded, decoded_length)
+		}
+	}
+
+	if _, err := make_huffman([]uint8{1, 16}, _XPRESS_MAX_LENGTH); err == nil {
+		t.Error("No error for a code too long")
+	}
+}
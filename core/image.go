@@ -0,0 +1,269 @@
+package core
+
+import (
+	"bytes"
+	"container/list"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+type tFileSource struct {
+	file        *os.File
+	size        int64
+	sector_size int64
+}
+
+func (self *tFileSource) ReadAt(data []byte, offset int64) (int, error) {
+	return self.file.ReadAt(data, offset)
+}
+
+func (self *tFileSource) Size() int64 {
+	return self.size
+}
+
+func (self *tFileSource) SectorSize() int64 {
+	return self.sector_size
+}
+
+func (self *tFileSource) Close() error {
+	return self.file.Close()
+}
+
+func open_raw_file(name string) (*os.File, int64, error) {
+	file, err := os.Open(name)
+	if err != nil {
+		return nil, 0, WrapError(err)
+	}
+
+	// Stat returns a null size for block devices, so the end is found by seeking
+	size, err := file.Seek(0, io.SeekEnd)
+	if err != nil {
+		file.Close()
+
+		return nil, 0, WrapError(err)
+	}
+
+	return file, size, nil
+}
+
+// Name of the first segment (.001) of a split image, with the width of the extension of `name`.
+func get_first_segment(name string) string {
+	ext := filepath.Ext(name)
+
+	return fmt.Sprintf("%s.%0*d", name[:len(name)-len(ext)], len(ext)-1, 1)
+}
+
+// A split image has a numeric extension of at least 3 digits (.001, .002 ...) and its first segment exists (.001),
+// so a file with such an extension is not a segment when there is no first segment beside it.
+func is_split_image(name string) bool {
+	ext := filepath.Ext(name)
+	if len(ext) < 4 {
+		return false
+	}
+
+	for _, c := range ext[1:] {
+		if (c < '0') || ('9' < c) {
+			return false
+		}
+	}
+
+	infos, err := os.Stat(get_first_segment(name))
+
+	return (err == nil) && infos.Mode().IsRegular()
+}
+
+// Count of the tables of an image (ie: the L2 tables of qcow2, the grain tables of VMDK) kept in memory.
+const IMAGE_TABLE_CACHE_SIZE = 256
+
+type tCachedTable struct {
+	key   uint64
+	table interface{}
+}
+
+// LRU cache of the tables read from an image, as CacheSource does for the blocks.
+type tTableCache struct {
+	capacity int
+	tables   map[uint64]*list.Element
+	lru      *list.List
+}
+
+func (self *tTableCache) get(key uint64) (interface{}, bool) {
+	elem, ok := self.tables[key]
+	if !ok {
+		return nil, false
+	}
+
+	self.lru.MoveToFront(elem)
+
+	return elem.Value.(*tCachedTable).table, true
+}
+
+func (self *tTableCache) add(key uint64, table interface{}) {
+	if elem, ok := self.tables[key]; ok {
+		elem.Value.(*tCachedTable).table = table
+		self.lru.MoveToFront(elem)
+
+		return
+	}
+
+	self.tables[key] = self.lru.PushFront(&tCachedTable{key: key, table: table})
+
+	for self.lru.Len() > self.capacity {
+		last := self.lru.Back()
+
+		self.lru.Remove(last)
+		delete(self.tables, last.Value.(*tCachedTable).key)
+	}
+}
+
+func new_table_cache(capacity int) *tTableCache {
+	return &tTableCache{
+		capacity: capacity,
+		tables:   make(map[uint64]*list.Element),
+		lru:      list.New(),
+	}
+}
+
+func read_image_struct(file io.ReaderAt, position int64, order binary.ByteOrder, ptr interface{}) error {
+	buffer := make([]byte, StructSize(ptr))
+
+	if _, err := file.ReadAt(buffer, position); err != nil {
+		return WrapError(err)
+	}
+
+	return WrapError(binary.Read(bytes.NewReader(buffer), order, ptr))
+}
+
+// Reads from the parent image of a differencing image, zeros are read when there is no parent.
+func read_parent(parent BlockSource, data []byte, offset int64) error {
+	if parent == nil {
+		ClearBuffer(data)
+
+		return nil
+	}
+
+	n, err := parent.ReadAt(data, offset)
+	if (err != nil) && (!IsEof(err)) {
+		return WrapError(err)
+	}
+
+	ClearBuffer(data[n:])
+
+	return nil
+}
+
+// Reads a virtual disk made of blocks, each call of `read` gets a buffer inside one block.
+func read_blocks(data []byte, offset, size, block_size int64, read func(buffer []byte, block, start int64) error) (int, error) {
+	res := 0
+
+	for res < len(data) {
+		pos := offset + int64(res)
+		if pos >= size {
+			return res, io.EOF
+		}
+
+		block, start := pos/block_size, pos%block_size
+
+		buffer := data[res:]
+		if remain := block_size - start; int64(len(buffer)) > remain {
+			buffer = buffer[:remain]
+		}
+
+		if remain := size - pos; int64(len(buffer)) > remain {
+			buffer = buffer[:remain]
+		}
+
+		if err := read(buffer, block, start); err != nil {
+			return res, err
+		}
+
+		res += len(buffer)
+	}
+
+	return res, nil
+}
+
+func resolve_image_path(child, path string) string {
+	path = strings.Replace(path, "\\", "/", -1)
+	if filepath.IsAbs(path) {
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+
+		path = filepath.Base(path)
+	}
+
+	return filepath.Join(filepath.Dir(child), path)
+}
+
+func open_image(name string) (BlockSource, error) {
+	file, size, err := open_raw_file(name)
+	if err != nil {
+		return nil, err
+	}
+
+	signature := make([]byte, 32)
+	if _, err := file.ReadAt(signature, 0); (err != nil) && (!IsEof(err)) {
+		file.Close()
+
+		return nil, WrapError(err)
+	}
+
+	footer := make([]byte, len(vhd_cookie))
+	if size >= 512 {
+		if _, err := file.ReadAt(footer, size-512); err != nil {
+			file.Close()
+
+			return nil, WrapError(err)
+		}
+	}
+
+	var open func(string) (BlockSource, error)
+
+	switch {
+	case bytes.HasPrefix(signature, ewf_signature):
+		open = open_ewf_image
+
+	case bytes.HasPrefix(signature, vhdx_signature):
+		open = open_vhdx_image
+
+	case bytes.HasPrefix(signature, vhd_cookie), bytes.Equal(footer, vhd_cookie):
+		open = open_vhd_image
+
+	case bytes.HasPrefix(signature, vmdk_magic), bytes.HasPrefix(signature, vmdk_descriptor):
+		open = open_vmdk_image
+
+	case bytes.HasPrefix(signature, qcow2_magic):
+		open = open_qcow2_image
+
+	case is_split_image(name):
+		open = open_split_image
+	}
+
+	if open != nil {
+		file.Close()
+
+		return open(name)
+	}
+
+	return &tFileSource{file: file, size: size, sector_size: get_sector_size(file)}, nil
+}
+
+// Opens a raw file or device without looking for an image format.
+func OpenFileSource(name string) (BlockSource, error) {
+	file, size, err := open_raw_file(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return &tFileSource{file: file, size: size, sector_size: get_sector_size(file)}, nil
+}
+
+// Opens a raw file or device, or an image file whose format is detected from its signature or its extension.
+func OpenSource(name string) (BlockSource, error) {
+	return open_image(name)
+}
@@ -0,0 +1,394 @@
+package core
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+var ewf_signature = []byte{'E', 'V', 'F', 0x09, 0x0D, 0x0A, 0xFF, 0x00}
+
+type tEwfFileHeader struct {
+	Signature     [8]byte
+	FieldsStart   uint8
+	SegmentNumber uint16
+	FieldsEnd     uint16
+}
+
+type tEwfSection struct {
+	Type     [16]byte
+	Next     uint64
+	Size     uint64
+	Padding  [40]byte
+	Checksum uint32
+}
+
+func (self *tEwfSection) GetType() string {
+	return strings.TrimRight(string(self.Type[:]), "\x00")
+}
+
+type tEwfVolume struct {
+	MediaType       uint8
+	Unknown1        [3]byte
+	ChunkCount      uint32
+	SectorsPerChunk uint32
+	BytesPerSector  uint32
+	SectorCount     uint64
+}
+
+type tEwfTable struct {
+	EntryCount uint32
+	Padding1   uint32
+	BaseOffset uint64
+	Padding2   uint32
+	Checksum   uint32
+}
+
+type tEwfChunk struct {
+	file       *os.File
+	offset     int64
+	size       int64
+	compressed bool
+}
+
+type tEwfImage struct {
+	files       []*os.File
+	chunks      []*tEwfChunk
+	chunk_size  int64
+	sector_size int64
+	size        int64
+
+	// Last decoded chunk, sequential reads often hit the same chunk several times
+	cache_index int
+	cache       []byte
+}
+
+func (self *tEwfImage) read_chunk(index int) ([]byte, error) {
+	if (index == self.cache_index) && (self.cache != nil) {
+		return self.cache, nil
+	}
+
+	chunk := self.chunks[index]
+	raw := make([]byte, chunk.size)
+
+	if _, err := chunk.file.ReadAt(raw, chunk.offset); (err != nil) && (!IsEof(err)) {
+		return nil, WrapError(err)
+	}
+
+	res := raw
+	if chunk.compressed {
+		reader, err := zlib.NewReader(bytes.NewReader(raw))
+		if err != nil {
+			return nil, WrapError(err)
+		}
+
+		res = make([]byte, self.chunk_size)
+
+		n, err := io.ReadFull(reader, res)
+		if (err != nil) && (err != io.ErrUnexpectedEOF) {
+			return nil, WrapError(err)
+		}
+
+		res = res[:n]
+	} else if int64(len(res)) > self.chunk_size {
+		// Uncompressed chunks are followed by their checksum
+		res = res[:self.chunk_size]
+	}
+
+	self.cache_index, self.cache = index, res
+
+	return res, nil
+}
+
+func (self *tEwfImage) ReadAt(data []byte, offset int64) (int, error) {
+	res := 0
+
+	for res < len(data) {
+		pos := offset + int64(res)
+		if pos >= self.size {
+			return res, io.EOF
+		}
+
+		index := int(pos / self.chunk_size)
+		if index >= len(self.chunks) {
+			return res, io.EOF
+		}
+
+		chunk, err := self.read_chunk(index)
+		if err != nil {
+			return res, err
+		}
+
+		start := pos % self.chunk_size
+		if start >= int64(len(chunk)) {
+			return res, io.EOF
+		}
+
+		buffer := chunk[start:]
+		if remain := self.size - pos; int64(len(buffer)) > remain {
+			buffer = buffer[:remain]
+		}
+
+		res += copy(data[res:], buffer)
+	}
+
+	return res, nil
+}
+
+func (self *tEwfImage) Size() int64 {
+	return self.size
+}
+
+func (self *tEwfImage) SectorSize() int64 {
+	return self.sector_size
+}
+
+func (self *tEwfImage) Close() error {
+	var res error
+
+	for _, file := range self.files {
+		if err := file.Close(); (err != nil) && (res == nil) {
+			res = err
+		}
+	}
+
+	return res
+}
+
+func (self *tEwfImage) read_table(file *os.File, position int64, end int64) error {
+	var table tEwfTable
+
+	buffer := make([]byte, StructSize(&table))
+	if _, err := file.ReadAt(buffer, position); err != nil {
+		return WrapError(err)
+	}
+
+	if err := Read(buffer, &table); err != nil {
+		return err
+	}
+
+	entries := make([]byte, int64(table.EntryCount)*4)
+	if _, err := file.ReadAt(entries, position+int64(len(buffer))); err != nil {
+		return WrapError(err)
+	}
+
+	get_entry := func(i int) int64 {
+		return int64(DecodeInt(entries[(i * 4):((i + 1) * 4)]))
+	}
+
+	// EnCase 6.7 writes segments over 2 GiB: once the offsets overflow 31 bits, the high bit is a part of the offsets
+	// and the next chunks are not compressed, the overflow is detected as libewf does
+	overflow := false
+
+	chunks := make([]*tEwfChunk, table.EntryCount)
+	for i := range chunks {
+		offset, compressed := get_entry(i), false
+		if !overflow {
+			offset, compressed = offset&0x7FFFFFFF, (offset&0x80000000) != 0
+		}
+
+		next := end - int64(table.BaseOffset)
+		if (i + 1) < len(chunks) {
+			next = get_entry(i + 1)
+			if !overflow && ((next & 0x7FFFFFFF) >= offset) {
+				next &= 0x7FFFFFFF
+			}
+		}
+
+		size := next - offset
+		if size < 0 {
+			return WrapError(fmt.Errorf("Bad EWF chunk table at position %d", position))
+		}
+
+		if !overflow && ((offset + size) > 0x7FFFFFFF) {
+			overflow, compressed = true, false
+		}
+
+		chunks[i] = &tEwfChunk{
+			file:       file,
+			offset:     int64(table.BaseOffset) + offset,
+			size:       size,
+			compressed: compressed,
+		}
+	}
+
+	self.chunks = append(self.chunks, chunks...)
+
+	return nil
+}
+
+// Reads the sections of a segment file, returns true if another segment follows.
+func (self *tEwfImage) read_segment(file *os.File) (bool, error) {
+	var header tEwfFileHeader
+	var section tEwfSection
+
+	buffer := make([]byte, StructSize(&section))
+	position := int64(StructSize(&header))
+	sectors_end := int64(-1)
+
+	for {
+		if _, err := file.ReadAt(buffer, position); err != nil {
+			return false, WrapError(err)
+		}
+
+		if err := Read(buffer, &section); err != nil {
+			return false, err
+		}
+
+		data_position := position + int64(len(buffer))
+
+		switch section.GetType() {
+		case "volume", "disk":
+			var volume tEwfVolume
+
+			data := make([]byte, StructSize(&volume))
+			if _, err := file.ReadAt(data, data_position); err != nil {
+				return false, WrapError(err)
+			}
+
+			if err := Read(data, &volume); err != nil {
+				return false, err
+			}
+
+			self.sector_size = int64(volume.BytesPerSector)
+			self.chunk_size = int64(volume.SectorsPerChunk) * self.sector_size
+			self.size = int64(volume.SectorCount) * int64(volume.BytesPerSector)
+
+		case "sectors":
+			sectors_end = position + int64(section.Size)
+
+		case "table":
+			end := sectors_end
+			if end < 0 {
+				end = int64(section.Next)
+			}
+
+			if err := self.read_table(file, data_position, end); err != nil {
+				return false, err
+			}
+
+		case "next":
+			return true, nil
+
+		case "done":
+			return false, nil
+		}
+
+		next := int64(section.Next)
+		if next <= position {
+			return false, nil
+		}
+
+		position = next
+	}
+}
+
+// Name of a segment from the name of the first segment without its extension and the first letter of its extension
+// (E01, then E02 ... E99, EAA ... EZZ, FAA ...).
+func ewf_segment_name(base string, first rune, number int) string {
+	if number < 100 {
+		return fmt.Sprintf("%s.%c%02d", base, first, number)
+	}
+
+	upper := ('A' <= first) && (first <= 'Z')
+	letter := func(v int) rune {
+		if upper {
+			return rune('A' + v)
+		}
+
+		return rune('a' + v)
+	}
+
+	v := number - 100
+
+	return fmt.Sprintf("%s.%c%c%c", base, first+rune(v/(26*26)), letter((v/26)%26), letter(v%26))
+}
+
+// Name without extension and first letter of the extension of the first segment, from any segment of the image.
+func ewf_first_segment(name string) (string, rune, error) {
+	file, err := os.Open(name)
+	if err != nil {
+		return "", 0, WrapError(err)
+	}
+
+	defer DeferedCall(file.Close)
+
+	var header tEwfFileHeader
+
+	if err := read_image_struct(file, 0, binary.LittleEndian, &header); err != nil {
+		return "", 0, err
+	}
+
+	ext := filepath.Ext(name)
+	base := name[:len(name)-len(ext)]
+	if len(ext) != 4 {
+		if header.SegmentNumber > 1 {
+			return "", 0, WrapError(fmt.Errorf("The first EWF segment of `%s` can not be found", name))
+		}
+
+		return base, 'E', nil
+	}
+
+	// From the segment 100, the first letter is increased each 26*26 segments
+	first := rune(ext[1])
+	if header.SegmentNumber >= 100 {
+		first -= rune((int(header.SegmentNumber) - 100) / (26 * 26))
+	}
+
+	return base, first, nil
+}
+
+func open_ewf_image(name string) (BlockSource, error) {
+	base, first, err := ewf_first_segment(name)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &tEwfImage{cache_index: -1}
+
+	// The segments are always read from the first one, whatever the segment given
+	for number := 1; ; number++ {
+		segment_name := ewf_segment_name(base, first, number)
+		if (number == 1) && (len(filepath.Ext(name)) != 4) {
+			segment_name = name
+		}
+
+		file, err := os.Open(segment_name)
+		if err != nil {
+			res.Close()
+
+			return nil, WrapError(err)
+		}
+
+		res.files = append(res.files, file)
+
+		more, err := res.read_segment(file)
+		if err != nil {
+			res.Close()
+
+			return nil, err
+		}
+
+		if !more {
+			break
+		}
+	}
+
+	if res.chunk_size == 0 {
+		res.Close()
+
+		return nil, WrapError(errors.New("No volume section found in EWF image"))
+	}
+
+	if res.size == 0 {
+		res.size = int64(len(res.chunks)) * res.chunk_size
+	}
+
+	return res, nil
+}
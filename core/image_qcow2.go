@@ -0,0 +1,232 @@
+package core
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+var qcow2_magic = []byte{'Q', 'F', 'I', 0xFB}
+
+const (
+	_QCOW2_OFFSET_MASK      uint64 = 0x00FFFFFFFFFFFE00
+	_QCOW2_COMPRESSED       uint64 = 1 << 62
+	_QCOW2_ZERO_CLUSTER     uint64 = 1
+	_QCOW2_COMPRESSION_ZLIB uint8  = 0
+)
+
+type tQcow2Header struct {
+	Magic                 [4]byte
+	Version               uint32
+	BackingFileOffset     uint64
+	BackingFileSize       uint32
+	ClusterBits           uint32
+	Size                  uint64
+	CryptMethod           uint32
+	L1Size                uint32
+	L1TableOffset         uint64
+	RefcountTableOffset   uint64
+	RefcountTableClusters uint32
+	NbSnapshots           uint32
+	SnapshotsOffset       uint64
+}
+
+type tQcow2Header3 struct {
+	IncompatibleFeatures uint64
+	CompatibleFeatures   uint64
+	AutoclearFeatures    uint64
+	RefcountOrder        uint32
+	HeaderLength         uint32
+	CompressionType      uint8
+}
+
+type tQcow2Image struct {
+	file         *os.File
+	header       tQcow2Header
+	cluster_size int64
+	l1           []uint64
+	l2           *tTableCache
+	parent       BlockSource
+}
+
+func (self *tQcow2Image) get_l2(index int64) ([]uint64, error) {
+	if index >= int64(len(self.l1)) {
+		return nil, nil
+	}
+
+	offset := self.l1[index] & _QCOW2_OFFSET_MASK
+	if offset == 0 {
+		return nil, nil
+	}
+
+	if table, ok := self.l2.get(offset); ok {
+		return table.([]uint64), nil
+	}
+
+	res := make([]uint64, self.cluster_size/8)
+	if err := read_image_struct(self.file, int64(offset), binary.BigEndian, res); err != nil {
+		return nil, err
+	}
+
+	self.l2.add(offset, res)
+
+	return res, nil
+}
+
+func (self *tQcow2Image) read_compressed(buffer []byte, entry uint64, start int64) error {
+	bits := uint(self.header.ClusterBits) - 8
+	shift := 62 - bits
+
+	offset := int64(entry & ((uint64(1) << shift) - 1))
+	sectors := int64((entry>>shift)&((uint64(1)<<bits)-1)) + 1
+	size := (sectors * 512) - (offset & 511)
+
+	compressed := make([]byte, size)
+	if n, err := self.file.ReadAt(compressed, offset); (err != nil) && !(IsEof(err) && (n > 0)) {
+		return WrapError(err)
+	}
+
+	cluster := make([]byte, self.cluster_size)
+	reader := flate.NewReader(bytes.NewReader(compressed))
+	defer reader.Close()
+
+	if _, err := io.ReadFull(reader, cluster); (err != nil) && (err != io.ErrUnexpectedEOF) {
+		return WrapError(err)
+	}
+
+	copy(buffer, cluster[start:])
+
+	return nil
+}
+
+func (self *tQcow2Image) read_cluster(buffer []byte, cluster, start int64) error {
+	per_table := self.cluster_size / 8
+	virtual := (cluster * self.cluster_size) + start
+
+	table, err := self.get_l2(cluster / per_table)
+	if err != nil {
+		return err
+	}
+
+	if table == nil {
+		return read_parent(self.parent, buffer, virtual)
+	}
+
+	entry := table[cluster%per_table]
+
+	switch {
+	case (entry & _QCOW2_COMPRESSED) != 0:
+		return self.read_compressed(buffer, entry&(_QCOW2_COMPRESSED-1), start)
+
+	case (entry & _QCOW2_ZERO_CLUSTER) != 0:
+		ClearBuffer(buffer)
+
+		return nil
+	}
+
+	offset := entry & _QCOW2_OFFSET_MASK
+	if offset == 0 {
+		return read_parent(self.parent, buffer, virtual)
+	}
+
+	_, err = self.file.ReadAt(buffer, int64(offset)+start)
+
+	return WrapError(err)
+}
+
+func (self *tQcow2Image) ReadAt(data []byte, offset int64) (int, error) {
+	return read_blocks(data, offset, int64(self.header.Size), self.cluster_size, self.read_cluster)
+}
+
+func (self *tQcow2Image) Size() int64 {
+	return int64(self.header.Size)
+}
+
+func (self *tQcow2Image) SectorSize() int64 {
+	return DEFAULT_SECTOR_SIZE
+}
+
+func (self *tQcow2Image) Close() error {
+	if self.parent != nil {
+		self.parent.Close()
+	}
+
+	return self.file.Close()
+}
+
+func open_qcow2_image(name string) (BlockSource, error) {
+	file, _, err := open_raw_file(name)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &tQcow2Image{
+		file: file,
+		l2:   new_table_cache(IMAGE_TABLE_CACHE_SIZE),
+	}
+
+	err = func() error {
+		header := &res.header
+
+		if err := read_image_struct(file, 0, binary.BigEndian, header); err != nil {
+			return err
+		}
+
+		if (header.Version < 2) || (header.Version > 3) {
+			return WrapError(fmt.Errorf("Unsupported qcow2 version: %d", header.Version))
+		}
+
+		if header.CryptMethod != 0 {
+			return WrapError(errors.New("Encrypted qcow2 images are not supported"))
+		}
+
+		if header.Version == 3 {
+			var header3 tQcow2Header3
+
+			if err := read_image_struct(file, int64(StructSize(header)), binary.BigEndian, &header3); err != nil {
+				return err
+			}
+
+			if (header3.HeaderLength > 104) && (header3.CompressionType != _QCOW2_COMPRESSION_ZLIB) {
+				return WrapError(errors.New("Only zlib compression is supported for qcow2 images"))
+			}
+		}
+
+		res.cluster_size = int64(1) << uint(header.ClusterBits)
+		res.l1 = make([]uint64, header.L1Size)
+
+		if err := read_image_struct(file, int64(header.L1TableOffset), binary.BigEndian, res.l1); err != nil {
+			return err
+		}
+
+		if header.BackingFileOffset == 0 {
+			return nil
+		}
+
+		backing := make([]byte, header.BackingFileSize)
+		if _, err := file.ReadAt(backing, int64(header.BackingFileOffset)); err != nil {
+			return WrapError(err)
+		}
+
+		parent, err := open_image(resolve_image_path(name, string(backing)))
+		if err != nil {
+			return err
+		}
+
+		res.parent = parent
+
+		return nil
+	}()
+
+	if err != nil {
+		file.Close()
+
+		return nil, err
+	}
+
+	return res, nil
+}
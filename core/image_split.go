@@ -0,0 +1,110 @@
+package core
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+type tSegment struct {
+	file  *os.File
+	start int64
+	size  int64
+}
+
+type tSplitImage struct {
+	segments []*tSegment
+	size     int64
+}
+
+func (self *tSplitImage) ReadAt(data []byte, offset int64) (int, error) {
+	idx := sort.Search(len(self.segments), func(i int) bool {
+		segment := self.segments[i]
+
+		return offset < (segment.start + segment.size)
+	})
+
+	res := 0
+	for (res < len(data)) && (idx < len(self.segments)) {
+		segment := self.segments[idx]
+		buffer := data[res:]
+		pos := offset + int64(res) - segment.start
+
+		if remain := segment.size - pos; int64(len(buffer)) > remain {
+			buffer = buffer[:remain]
+		}
+
+		n, err := segment.file.ReadAt(buffer, pos)
+		res += n
+
+		if (err != nil) && !((err == io.EOF) && (n == len(buffer))) {
+			return res, err
+		}
+
+		idx++
+	}
+
+	if res < len(data) {
+		return res, io.EOF
+	}
+
+	return res, nil
+}
+
+func (self *tSplitImage) Size() int64 {
+	return self.size
+}
+
+func (self *tSplitImage) SectorSize() int64 {
+	return DEFAULT_SECTOR_SIZE
+}
+
+func (self *tSplitImage) Close() error {
+	var res error
+
+	for _, segment := range self.segments {
+		if err := segment.file.Close(); (err != nil) && (res == nil) {
+			res = err
+		}
+	}
+
+	return res
+}
+
+// Opens all the segments of a split image from its first one, whatever the segment given by `name`.
+func open_split_image(name string) (BlockSource, error) {
+	ext := filepath.Ext(name)
+	base := name[:len(name)-len(ext)]
+	width := len(ext) - 1
+
+	const first = 1
+
+	res := new(tSplitImage)
+
+	for num := first; ; num++ {
+		segment_name := fmt.Sprintf("%s.%0*d", base, width, num)
+
+		file, size, err := open_raw_file(segment_name)
+		if err != nil {
+			if (num != first) && os.IsNotExist(GetSource(err)) {
+				break
+			}
+
+			res.Close()
+
+			return nil, err
+		}
+
+		res.segments = append(res.segments, &tSegment{
+			file:  file,
+			start: res.size,
+			size:  size,
+		})
+
+		res.size += size
+	}
+
+	return res, nil
+}
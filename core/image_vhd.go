@@ -0,0 +1,243 @@
+package core
+
+import (
+	"encoding/binary"
+	"fmt"
+	"os"
+	"strings"
+	"unicode/utf16"
+)
+
+var vhd_cookie = []byte("conectix")
+
+const (
+	_VHD_FIXED        uint32 = 2
+	_VHD_DYNAMIC      uint32 = 3
+	_VHD_DIFFERENCING uint32 = 4
+
+	_VHD_UNUSED uint32 = 0xFFFFFFFF
+)
+
+type tVhdFooter struct {
+	Cookie             [8]byte
+	Features           uint32
+	Version            uint32
+	DataOffset         uint64
+	Timestamp          uint32
+	CreatorApplication [4]byte
+	CreatorVersion     uint32
+	CreatorHostOs      uint32
+	OriginalSize       uint64
+	CurrentSize        uint64
+	DiskGeometry       uint32
+	DiskType           uint32
+	Checksum           uint32
+	UniqueId           [16]byte
+	SavedState         uint8
+	Reserved           [427]byte
+}
+
+type tVhdParentLocator struct {
+	PlatformCode       [4]byte
+	PlatformDataSpace  uint32
+	PlatformDataLength uint32
+	Reserved           uint32
+	PlatformDataOffset uint64
+}
+
+type tVhdDynamicHeader struct {
+	Cookie            [8]byte
+	DataOffset        uint64
+	TableOffset       uint64
+	HeaderVersion     uint32
+	MaxTableEntries   uint32
+	BlockSize         uint32
+	Checksum          uint32
+	ParentUniqueId    [16]byte
+	ParentTimestamp   uint32
+	Reserved1         uint32
+	ParentUnicodeName [256]uint16
+	ParentLocators    [8]tVhdParentLocator
+	Reserved2         [256]byte
+}
+
+type tVhdImage struct {
+	file       *os.File
+	size       int64
+	fixed      bool
+	block_size int64
+	bitmap_sz  int64
+	bat        []uint32
+	parent     BlockSource
+}
+
+func (self *tVhdImage) read_block(buffer []byte, block, start int64) error {
+	if block >= int64(len(self.bat)) {
+		return read_parent(self.parent, buffer, (block*self.block_size)+start)
+	}
+
+	entry := self.bat[block]
+	if entry == _VHD_UNUSED {
+		return read_parent(self.parent, buffer, (block*self.block_size)+start)
+	}
+
+	position := (int64(entry) * 512) + self.bitmap_sz
+	if self.parent == nil {
+		_, err := self.file.ReadAt(buffer, position+start)
+
+		return WrapError(err)
+	}
+
+	// In a differencing image, sectors not present in the block bitmap come from the parent
+	for done := int64(0); done < int64(len(buffer)); {
+		sector := (start + done) / 512
+		chunk := buffer[done:]
+		if remain := ((sector + 1) * 512) - (start + done); int64(len(chunk)) > remain {
+			chunk = chunk[:remain]
+		}
+
+		var bits [1]byte
+
+		if _, err := self.file.ReadAt(bits[:], (int64(entry)*512)+(sector/8)); err != nil {
+			return WrapError(err)
+		}
+
+		if (bits[0] & (0x80 >> uint(sector%8))) != 0 {
+			if _, err := self.file.ReadAt(chunk, position+start+done); err != nil {
+				return WrapError(err)
+			}
+		} else if err := read_parent(self.parent, chunk, (block*self.block_size)+start+done); err != nil {
+			return err
+		}
+
+		done += int64(len(chunk))
+	}
+
+	return nil
+}
+
+func (self *tVhdImage) ReadAt(data []byte, offset int64) (int, error) {
+	if self.fixed {
+		return read_blocks(data, offset, self.size, self.size, func(buffer []byte, block, start int64) error {
+			_, err := self.file.ReadAt(buffer, start)
+
+			return WrapError(err)
+		})
+	}
+
+	return read_blocks(data, offset, self.size, self.block_size, self.read_block)
+}
+
+func (self *tVhdImage) Size() int64 {
+	return self.size
+}
+
+func (self *tVhdImage) SectorSize() int64 {
+	return DEFAULT_SECTOR_SIZE
+}
+
+func (self *tVhdImage) Close() error {
+	if self.parent != nil {
+		self.parent.Close()
+	}
+
+	return self.file.Close()
+}
+
+func (self *tVhdImage) open_parent(name string, header *tVhdDynamicHeader) error {
+	candidates := make([]string, 0)
+
+	for _, locator := range header.ParentLocators {
+		code := string(locator.PlatformCode[:])
+		if (code != "W2ru") && (code != "W2ku") {
+			continue
+		}
+
+		data := make([]byte, locator.PlatformDataLength)
+		if _, err := self.file.ReadAt(data, int64(locator.PlatformDataOffset)); err != nil {
+			return WrapError(err)
+		}
+
+		candidates = append(candidates, strings.TrimRight(DecodeString(data, 0), "\x00"))
+	}
+
+	parent_name := string(utf16.Decode(header.ParentUnicodeName[:]))
+
+	candidates = append(candidates, strings.TrimRight(parent_name, "\x00"))
+
+	for _, path := range candidates {
+		if path == "" {
+			continue
+		}
+
+		path = resolve_image_path(name, path)
+		if _, err := os.Stat(path); err != nil {
+			continue
+		}
+
+		parent, err := open_image(path)
+		if err != nil {
+			return err
+		}
+
+		self.parent = parent
+
+		return nil
+	}
+
+	return WrapError(fmt.Errorf("Parent image of VHD `%s` not found", name))
+}
+
+func open_vhd_image(name string) (BlockSource, error) {
+	file, size, err := open_raw_file(name)
+	if err != nil {
+		return nil, err
+	}
+
+	var footer tVhdFooter
+
+	if err := read_image_struct(file, size-512, binary.BigEndian, &footer); err != nil {
+		file.Close()
+
+		return nil, err
+	}
+
+	res := &tVhdImage{
+		file: file,
+		size: int64(footer.CurrentSize),
+	}
+
+	if footer.DiskType == _VHD_FIXED {
+		res.fixed = true
+
+		return res, nil
+	}
+
+	var header tVhdDynamicHeader
+
+	if err := read_image_struct(file, int64(footer.DataOffset), binary.BigEndian, &header); err != nil {
+		file.Close()
+
+		return nil, err
+	}
+
+	res.block_size = int64(header.BlockSize)
+	res.bitmap_sz = (((res.block_size / 512 / 8) + 511) / 512) * 512
+	res.bat = make([]uint32, header.MaxTableEntries)
+
+	if err := read_image_struct(file, int64(header.TableOffset), binary.BigEndian, res.bat); err != nil {
+		file.Close()
+
+		return nil, err
+	}
+
+	if footer.DiskType == _VHD_DIFFERENCING {
+		if err := res.open_parent(name, &header); err != nil {
+			file.Close()
+
+			return nil, err
+		}
+	}
+
+	return res, nil
+}
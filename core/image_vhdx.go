@@ -0,0 +1,453 @@
+package core
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"os"
+	"strings"
+
+	"github.com/pborman/uuid"
+)
+
+var (
+	vhdx_signature = []byte("vhdxfile")
+
+	vhdx_bat_region      = vhdx_guid("2DC27766-F623-4200-9D64-115E9BFD4A08")
+	vhdx_metadata_region = vhdx_guid("8B7CA206-4790-4B9A-B8FE-575F050F886E")
+	vhdx_file_parameters = vhdx_guid("CAA16737-FA36-4D43-B3B6-33F0AA44E76B")
+	vhdx_disk_size       = vhdx_guid("2FA54224-CD1B-4876-B211-5DBED83BF4B8")
+	vhdx_sector_size     = vhdx_guid("8141BF1D-A96F-4709-BA47-F233A8FAAB5F")
+	vhdx_parent_locator  = vhdx_guid("A8D35F2D-B30B-454D-ABF7-D3D84834AB0C")
+)
+
+const (
+	_VHDX_PAYLOAD_NOT_PRESENT       uint64 = 0
+	_VHDX_PAYLOAD_UNDEFINED         uint64 = 1
+	_VHDX_PAYLOAD_ZERO              uint64 = 2
+	_VHDX_PAYLOAD_UNMAPPED          uint64 = 3
+	_VHDX_PAYLOAD_FULLY_PRESENT     uint64 = 6
+	_VHDX_PAYLOAD_PARTIALLY_PRESENT uint64 = 7
+
+	_VHDX_HAS_PARENT uint32 = 2
+)
+
+// GUIDs are stored with their 3 first fields in little endian.
+func vhdx_guid(value string) [16]byte {
+	var res [16]byte
+
+	copy(res[:], uuid.Parse(value))
+
+	res[0], res[1], res[2], res[3] = res[3], res[2], res[1], res[0]
+	res[4], res[5] = res[5], res[4]
+	res[6], res[7] = res[7], res[6]
+
+	return res
+}
+
+type tVhdxHeader struct {
+	Signature      [4]byte
+	Checksum       uint32
+	SequenceNumber uint64
+	FileWriteGuid  [16]byte
+	DataWriteGuid  [16]byte
+	LogGuid        [16]byte
+	LogVersion     uint16
+	Version        uint16
+	LogLength      uint32
+	LogOffset      uint64
+}
+
+type tVhdxRegionTableHeader struct {
+	Signature  [4]byte
+	Checksum   uint32
+	EntryCount uint32
+	Reserved   uint32
+}
+
+type tVhdxRegionTableEntry struct {
+	Guid       [16]byte
+	FileOffset uint64
+	Length     uint32
+	Required   uint32
+}
+
+type tVhdxMetadataTableHeader struct {
+	Signature  [8]byte
+	Reserved1  uint16
+	EntryCount uint16
+	Reserved2  [20]byte
+}
+
+type tVhdxMetadataTableEntry struct {
+	ItemId   [16]byte
+	Offset   uint32
+	Length   uint32
+	Flags    uint32
+	Reserved uint32
+}
+
+type tVhdxParentLocatorHeader struct {
+	LocatorType   [16]byte
+	Reserved      uint16
+	KeyValueCount uint16
+}
+
+type tVhdxParentLocatorEntry struct {
+	KeyOffset   uint32
+	ValueOffset uint32
+	KeyLength   uint16
+	ValueLength uint16
+}
+
+type tVhdxImage struct {
+	file        *os.File
+	size        int64
+	block_size  int64
+	sector_size int64
+	chunk_ratio int64
+	bat         []uint64
+	parent      BlockSource
+}
+
+func (self *tVhdxImage) read_sector_bit(chunk, sector int64) (bool, error) {
+	entry := self.bat[(chunk*(self.chunk_ratio+1))+self.chunk_ratio]
+	if (entry & 7) != _VHDX_PAYLOAD_FULLY_PRESENT {
+		return false, nil
+	}
+
+	var bits [1]byte
+
+	if _, err := self.file.ReadAt(bits[:], int64((entry>>20)<<20)+(sector/8)); err != nil {
+		return false, WrapError(err)
+	}
+
+	return (bits[0] & (1 << uint(sector%8))) != 0, nil
+}
+
+func (self *tVhdxImage) read_block(buffer []byte, block, start int64) error {
+	chunk := block / self.chunk_ratio
+	index := block + chunk
+	virtual := (block * self.block_size) + start
+
+	if index >= int64(len(self.bat)) {
+		return read_parent(self.parent, buffer, virtual)
+	}
+
+	entry := self.bat[index]
+	position := int64((entry>>20)<<20) + start
+
+	switch entry & 7 {
+	case _VHDX_PAYLOAD_FULLY_PRESENT:
+		_, err := self.file.ReadAt(buffer, position)
+
+		return WrapError(err)
+
+	case _VHDX_PAYLOAD_PARTIALLY_PRESENT:
+		// The sector bitmap of the chunk tells which sectors are in this file and which are in the parent
+		first_sector := ((block % self.chunk_ratio) * self.block_size) / self.sector_size
+
+		for done := int64(0); done < int64(len(buffer)); {
+			sector := (start + done) / self.sector_size
+			part := buffer[done:]
+			if remain := ((sector + 1) * self.sector_size) - (start + done); int64(len(part)) > remain {
+				part = part[:remain]
+			}
+
+			present, err := self.read_sector_bit(chunk, first_sector+sector)
+			if err != nil {
+				return err
+			}
+
+			if present {
+				if _, err := self.file.ReadAt(part, position+done); err != nil {
+					return WrapError(err)
+				}
+			} else if err := read_parent(self.parent, part, virtual+done); err != nil {
+				return err
+			}
+
+			done += int64(len(part))
+		}
+
+		return nil
+
+	case _VHDX_PAYLOAD_NOT_PRESENT:
+		return read_parent(self.parent, buffer, virtual)
+	}
+
+	ClearBuffer(buffer)
+
+	return nil
+}
+
+func (self *tVhdxImage) ReadAt(data []byte, offset int64) (int, error) {
+	return read_blocks(data, offset, self.size, self.block_size, self.read_block)
+}
+
+func (self *tVhdxImage) Size() int64 {
+	return self.size
+}
+
+func (self *tVhdxImage) SectorSize() int64 {
+	return self.sector_size
+}
+
+func (self *tVhdxImage) Close() error {
+	if self.parent != nil {
+		self.parent.Close()
+	}
+
+	return self.file.Close()
+}
+
+func (self *tVhdxImage) open_parent(name string, locator []byte) error {
+	var header tVhdxParentLocatorHeader
+
+	if err := Read(locator, &header); err != nil {
+		return err
+	}
+
+	values := make(map[string]string)
+	position := StructSize(&header)
+
+	// The offsets and the lengths come from the image, they are checked against the size of the locator
+	get_field := func(offset uint32, length uint16) ([]byte, error) {
+		start, end := int64(offset), int64(offset)+int64(length)
+		if end > int64(len(locator)) {
+			return nil, WrapError(fmt.Errorf("Bad VHDX parent locator entry (offset= %d, length= %d)", offset, length))
+		}
+
+		return locator[start:end], nil
+	}
+
+	for i := 0; i < int(header.KeyValueCount); i++ {
+		var entry tVhdxParentLocatorEntry
+
+		if (position + StructSize(&entry)) > len(locator) {
+			return WrapError(fmt.Errorf("Truncated VHDX parent locator (%d entries)", header.KeyValueCount))
+		}
+
+		if err := Read(locator[position:], &entry); err != nil {
+			return err
+		}
+
+		key, err := get_field(entry.KeyOffset, entry.KeyLength)
+		if err != nil {
+			return err
+		}
+
+		value, err := get_field(entry.ValueOffset, entry.ValueLength)
+		if err != nil {
+			return err
+		}
+
+		values[DecodeString(key, 0)] = DecodeString(value, 0)
+		position += StructSize(&entry)
+	}
+
+	for _, key := range []string{"relative_path", "absolute_win32_path", "volume_path"} {
+		path, ok := values[key]
+		if !ok {
+			continue
+		}
+
+		path = resolve_image_path(name, strings.TrimRight(path, "\x00"))
+		if _, err := os.Stat(path); err != nil {
+			continue
+		}
+
+		parent, err := open_image(path)
+		if err != nil {
+			return err
+		}
+
+		self.parent = parent
+
+		return nil
+	}
+
+	return WrapError(fmt.Errorf("Parent image of VHDX `%s` not found", name))
+}
+
+func vhdx_read_header(file *os.File) (*tVhdxHeader, error) {
+	var res *tVhdxHeader
+
+	for _, position := range []int64{0x10000, 0x20000} {
+		block := make([]byte, 0x1000)
+		if _, err := file.ReadAt(block, position); err != nil {
+			return nil, WrapError(err)
+		}
+
+		header := new(tVhdxHeader)
+		if err := Read(block, header); err != nil {
+			return nil, err
+		}
+
+		if string(header.Signature[:]) != "head" {
+			continue
+		}
+
+		copy(block[4:8], []byte{0, 0, 0, 0})
+		if crc32.Checksum(block, crc32.MakeTable(crc32.Castagnoli)) != header.Checksum {
+			continue
+		}
+
+		if (res == nil) || (header.SequenceNumber > res.SequenceNumber) {
+			res = header
+		}
+	}
+
+	if res == nil {
+		return nil, WrapError(errors.New("No valid VHDX header"))
+	}
+
+	return res, nil
+}
+
+func vhdx_read_regions(file *os.File) (map[[16]byte]*tVhdxRegionTableEntry, error) {
+	for _, position := range []int64{0x30000, 0x40000} {
+		var header tVhdxRegionTableHeader
+
+		block := make([]byte, 0x10000)
+		if _, err := file.ReadAt(block, position); err != nil {
+			return nil, WrapError(err)
+		}
+
+		if err := Read(block, &header); err != nil {
+			return nil, err
+		}
+
+		if string(header.Signature[:]) != "regi" {
+			continue
+		}
+
+		copy(block[4:8], []byte{0, 0, 0, 0})
+		if crc32.Checksum(block, crc32.MakeTable(crc32.Castagnoli)) != header.Checksum {
+			continue
+		}
+
+		res := make(map[[16]byte]*tVhdxRegionTableEntry)
+		offset := StructSize(&header)
+
+		for i := uint32(0); i < header.EntryCount; i++ {
+			entry := new(tVhdxRegionTableEntry)
+			if err := Read(block[offset:], entry); err != nil {
+				return nil, err
+			}
+
+			res[entry.Guid] = entry
+			offset += StructSize(entry)
+		}
+
+		return res, nil
+	}
+
+	return nil, WrapError(errors.New("No valid VHDX region table"))
+}
+
+func vhdx_read_metadata(file *os.File, region *tVhdxRegionTableEntry) (map[[16]byte][]byte, error) {
+	var header tVhdxMetadataTableHeader
+
+	if err := read_image_struct(file, int64(region.FileOffset), binary.LittleEndian, &header); err != nil {
+		return nil, err
+	}
+
+	if string(header.Signature[:]) != "metadata" {
+		return nil, WrapError(errors.New("Bad VHDX metadata table"))
+	}
+
+	res := make(map[[16]byte][]byte)
+	position := int64(region.FileOffset) + int64(StructSize(&header))
+
+	for i := uint16(0); i < header.EntryCount; i++ {
+		var entry tVhdxMetadataTableEntry
+
+		if err := read_image_struct(file, position, binary.LittleEndian, &entry); err != nil {
+			return nil, err
+		}
+
+		value := make([]byte, entry.Length)
+		if _, err := file.ReadAt(value, int64(region.FileOffset)+int64(entry.Offset)); err != nil {
+			return nil, WrapError(err)
+		}
+
+		res[entry.ItemId] = value
+		position += int64(StructSize(&entry))
+	}
+
+	return res, nil
+}
+
+func open_vhdx_image(name string) (BlockSource, error) {
+	file, _, err := open_raw_file(name)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := func() (*tVhdxImage, error) {
+		if _, err := vhdx_read_header(file); err != nil {
+			return nil, err
+		}
+
+		regions, err := vhdx_read_regions(file)
+		if err != nil {
+			return nil, err
+		}
+
+		bat_region, metadata_region := regions[vhdx_bat_region], regions[vhdx_metadata_region]
+		if (bat_region == nil) || (metadata_region == nil) {
+			return nil, WrapError(errors.New("Missing VHDX region"))
+		}
+
+		metadata, err := vhdx_read_metadata(file, metadata_region)
+		if err != nil {
+			return nil, err
+		}
+
+		parameters, disk_size, sector_size := metadata[vhdx_file_parameters], metadata[vhdx_disk_size], metadata[vhdx_sector_size]
+		if (len(parameters) < 8) || (len(disk_size) < 8) || (len(sector_size) < 4) {
+			return nil, WrapError(errors.New("Missing VHDX metadata"))
+		}
+
+		res := &tVhdxImage{
+			file:        file,
+			size:        int64(binary.LittleEndian.Uint64(disk_size)),
+			block_size:  int64(binary.LittleEndian.Uint32(parameters)),
+			sector_size: int64(binary.LittleEndian.Uint32(sector_size)),
+		}
+
+		if (res.block_size == 0) || (res.sector_size == 0) {
+			return nil, WrapError(errors.New("Bad VHDX metadata"))
+		}
+
+		res.chunk_ratio = ((int64(1) << 23) * res.sector_size) / res.block_size
+		res.bat = make([]uint64, bat_region.Length/8)
+
+		if err := read_image_struct(file, int64(bat_region.FileOffset), binary.LittleEndian, res.bat); err != nil {
+			return nil, err
+		}
+
+		if (binary.LittleEndian.Uint32(parameters[4:]) & _VHDX_HAS_PARENT) != 0 {
+			locator := metadata[vhdx_parent_locator]
+			if locator == nil {
+				return nil, WrapError(errors.New("Missing VHDX parent locator"))
+			}
+
+			if err := res.open_parent(name, locator); err != nil {
+				return nil, err
+			}
+		}
+
+		return res, nil
+	}()
+
+	if err != nil {
+		file.Close()
+
+		return nil, err
+	}
+
+	return res, nil
+}
@@ -0,0 +1,521 @@
+package core
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+var (
+	vmdk_magic      = []byte("KDMV")
+	vmdk_descriptor = []byte("# Disk DescriptorFile")
+)
+
+const (
+	_VMDK_GD_AT_END       uint64 = 0xFFFFFFFFFFFFFFFF
+	_VMDK_FLAG_ZERO_GTE   uint32 = 0x4
+	_VMDK_FLAG_COMPRESSED uint32 = 0x10000
+	_VMDK_GTE_ZERO        uint32 = 1
+
+	_VMDK_NO_PARENT_CID = "ffffffff"
+)
+
+type tVmdkSparseHeader struct {
+	MagicNumber        [4]byte
+	Version            uint32
+	Flags              uint32
+	Capacity           uint64
+	GrainSize          uint64
+	DescriptorOffset   uint64
+	DescriptorSize     uint64
+	NumGTEsPerGT       uint32
+	RgdOffset          uint64
+	GdOffset           uint64
+	Overhead           uint64
+	UncleanShutdown    uint8
+	SingleEndLineChar  uint8
+	NonEndLineChar     uint8
+	DoubleEndLineChar1 uint8
+	DoubleEndLineChar2 uint8
+	CompressAlgorithm  uint16
+	Pad                [433]byte
+}
+
+type tVmdkGrainMarker struct {
+	Lba  uint64
+	Size uint32
+}
+
+// An extent reads a part of the virtual disk, `parent` is used for data which are not in the extent.
+type tVmdkExtent interface {
+	read(buffer []byte, offset int64, parent func([]byte, int64) error) error
+	close() error
+}
+
+type tVmdkFlatExtent struct {
+	file   *os.File
+	offset int64
+}
+
+func (self *tVmdkFlatExtent) read(buffer []byte, offset int64, parent func([]byte, int64) error) error {
+	_, err := self.file.ReadAt(buffer, self.offset+offset)
+
+	return WrapError(err)
+}
+
+func (self *tVmdkFlatExtent) close() error {
+	return self.file.Close()
+}
+
+type tVmdkZeroExtent struct{}
+
+func (tVmdkZeroExtent) read(buffer []byte, offset int64, parent func([]byte, int64) error) error {
+	ClearBuffer(buffer)
+
+	return nil
+}
+
+func (tVmdkZeroExtent) close() error {
+	return nil
+}
+
+type tVmdkSparseExtent struct {
+	file       *os.File
+	header     tVmdkSparseHeader
+	grain_size int64
+	gd         []uint32
+	tables     *tTableCache
+}
+
+func (self *tVmdkSparseExtent) get_table(index int64) ([]uint32, error) {
+	if index >= int64(len(self.gd)) {
+		return nil, nil
+	}
+
+	sector := self.gd[index]
+	if sector == 0 {
+		return nil, nil
+	}
+
+	if table, ok := self.tables.get(uint64(sector)); ok {
+		return table.([]uint32), nil
+	}
+
+	res := make([]uint32, self.header.NumGTEsPerGT)
+	if err := read_image_struct(self.file, int64(sector)*512, binary.LittleEndian, res); err != nil {
+		return nil, err
+	}
+
+	self.tables.add(uint64(sector), res)
+
+	return res, nil
+}
+
+func (self *tVmdkSparseExtent) read_grain(buffer []byte, sector uint32, start int64) error {
+	if (self.header.Flags & _VMDK_FLAG_COMPRESSED) == 0 {
+		_, err := self.file.ReadAt(buffer, (int64(sector)*512)+start)
+
+		return WrapError(err)
+	}
+
+	var marker tVmdkGrainMarker
+
+	position := int64(sector) * 512
+	if err := read_image_struct(self.file, position, binary.LittleEndian, &marker); err != nil {
+		return err
+	}
+
+	compressed := make([]byte, marker.Size)
+	if _, err := self.file.ReadAt(compressed, position+int64(StructSize(&marker))); err != nil {
+		return WrapError(err)
+	}
+
+	reader, err := zlib.NewReader(bytes.NewReader(compressed))
+	if err != nil {
+		return WrapError(err)
+	}
+
+	grain := make([]byte, self.grain_size)
+	if _, err := io.ReadFull(reader, grain); (err != nil) && (err != io.ErrUnexpectedEOF) {
+		return WrapError(err)
+	}
+
+	copy(buffer, grain[start:])
+
+	return nil
+}
+
+func (self *tVmdkSparseExtent) read(buffer []byte, offset int64, parent func([]byte, int64) error) error {
+	size := int64(self.header.Capacity) * 512
+
+	_, err := read_blocks(buffer, offset, size, self.grain_size, func(part []byte, grain, start int64) error {
+		per_table := int64(self.header.NumGTEsPerGT)
+
+		table, err := self.get_table(grain / per_table)
+		if err != nil {
+			return err
+		}
+
+		entry := uint32(0)
+		if table != nil {
+			entry = table[grain%per_table]
+		}
+
+		switch {
+		case entry == 0:
+			return parent(part, (grain*self.grain_size)+start)
+
+		case (entry == _VMDK_GTE_ZERO) && ((self.header.Flags & _VMDK_FLAG_ZERO_GTE) != 0):
+			ClearBuffer(part)
+
+			return nil
+		}
+
+		return self.read_grain(part, entry, start)
+	})
+
+	return err
+}
+
+func (self *tVmdkSparseExtent) close() error {
+	return self.file.Close()
+}
+
+func (self *tVmdkSparseExtent) get_descriptor() (string, error) {
+	if self.header.DescriptorOffset == 0 {
+		return "", nil
+	}
+
+	res := make([]byte, self.header.DescriptorSize*512)
+	if _, err := self.file.ReadAt(res, int64(self.header.DescriptorOffset)*512); err != nil {
+		return "", WrapError(err)
+	}
+
+	return string(bytes.TrimRight(res, "\x00")), nil
+}
+
+func open_vmdk_sparse_extent(name string) (*tVmdkSparseExtent, error) {
+	file, size, err := open_raw_file(name)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &tVmdkSparseExtent{
+		file:   file,
+		tables: new_table_cache(IMAGE_TABLE_CACHE_SIZE),
+	}
+
+	err = func() error {
+		if err := read_image_struct(file, 0, binary.LittleEndian, &res.header); err != nil {
+			return err
+		}
+
+		if !bytes.Equal(res.header.MagicNumber[:], vmdk_magic) {
+			return WrapError(fmt.Errorf("File `%s` is not a sparse VMDK extent", name))
+		}
+
+		// Stream optimized extents have their header copied in a footer, before the end of stream marker
+		if res.header.GdOffset == _VMDK_GD_AT_END {
+			if err := read_image_struct(file, size-1024, binary.LittleEndian, &res.header); err != nil {
+				return err
+			}
+		}
+
+		if (res.header.GrainSize == 0) || (res.header.NumGTEsPerGT == 0) {
+			return WrapError(fmt.Errorf("Bad sparse VMDK extent `%s`", name))
+		}
+
+		res.grain_size = int64(res.header.GrainSize) * 512
+
+		table_coverage := int64(res.header.GrainSize) * int64(res.header.NumGTEsPerGT)
+		count := (int64(res.header.Capacity) + table_coverage - 1) / table_coverage
+
+		res.gd = make([]uint32, count)
+
+		return read_image_struct(file, int64(res.header.GdOffset)*512, binary.LittleEndian, res.gd)
+	}()
+
+	if err != nil {
+		file.Close()
+
+		return nil, err
+	}
+
+	return res, nil
+}
+
+type tVmdkExtentDesc struct {
+	extent tVmdkExtent
+	start  int64
+	size   int64
+}
+
+type tVmdkImage struct {
+	extents []*tVmdkExtentDesc
+	size    int64
+	parent  BlockSource
+}
+
+func (self *tVmdkImage) ReadAt(data []byte, offset int64) (int, error) {
+	res := 0
+
+	for _, desc := range self.extents {
+		if res >= len(data) {
+			break
+		}
+
+		pos := offset + int64(res)
+		if (pos < desc.start) || (pos >= (desc.start + desc.size)) {
+			continue
+		}
+
+		buffer := data[res:]
+		if remain := desc.start + desc.size - pos; int64(len(buffer)) > remain {
+			buffer = buffer[:remain]
+		}
+
+		parent := func(part []byte, extent_offset int64) error {
+			return read_parent(self.parent, part, desc.start+extent_offset)
+		}
+
+		if err := desc.extent.read(buffer, pos-desc.start, parent); err != nil {
+			return res, err
+		}
+
+		res += len(buffer)
+	}
+
+	if res < len(data) {
+		return res, io.EOF
+	}
+
+	return res, nil
+}
+
+func (self *tVmdkImage) Size() int64 {
+	return self.size
+}
+
+func (self *tVmdkImage) SectorSize() int64 {
+	return DEFAULT_SECTOR_SIZE
+}
+
+func (self *tVmdkImage) Close() error {
+	var res error
+
+	for _, desc := range self.extents {
+		if err := desc.extent.close(); (err != nil) && (res == nil) {
+			res = err
+		}
+	}
+
+	if self.parent != nil {
+		self.parent.Close()
+	}
+
+	return res
+}
+
+func (self *tVmdkImage) add_extent(extent tVmdkExtent, size int64) {
+	self.extents = append(self.extents, &tVmdkExtentDesc{
+		extent: extent,
+		start:  self.size,
+		size:   size,
+	})
+
+	self.size += size
+}
+
+func (self *tVmdkImage) has_extent(extent tVmdkExtent) bool {
+	for _, desc := range self.extents {
+		if desc.extent == extent {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Reads extent lines (`RW 4192256 SPARSE "disk-s001.vmdk"`) and the parent of a descriptor.
+func (self *tVmdkImage) load_descriptor(name, descriptor string, embedded *tVmdkSparseExtent) error {
+	parent_name := ""
+	has_parent := false
+
+	scanner := bufio.NewScanner(strings.NewReader(descriptor))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if (line == "") || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		if idx := strings.Index(line, "="); idx > 0 {
+			key, value := strings.TrimSpace(line[:idx]), strings.Trim(strings.TrimSpace(line[(idx+1):]), "\"")
+
+			switch key {
+			case "parentCID":
+				has_parent = strings.ToLower(value) != _VMDK_NO_PARENT_CID
+
+			case "parentFileNameHint":
+				parent_name = value
+			}
+
+			continue
+		}
+
+		fields := strings.Fields(line)
+		if (len(fields) < 3) || ((fields[0] != "RW") && (fields[0] != "RDONLY") && (fields[0] != "NOACCESS")) {
+			continue
+		}
+
+		sectors, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil {
+			return WrapError(err)
+		}
+
+		size := sectors * 512
+		kind := fields[2]
+
+		if kind == "ZERO" {
+			self.add_extent(tVmdkZeroExtent{}, size)
+
+			continue
+		}
+
+		if len(fields) < 4 {
+			return WrapError(fmt.Errorf("Bad VMDK extent line: %s", line))
+		}
+
+		path := resolve_image_path(name, strings.Trim(fields[3], "\""))
+
+		switch kind {
+		case "FLAT", "VMFS":
+			offset := int64(0)
+			if len(fields) > 4 {
+				offset, err = strconv.ParseInt(fields[4], 10, 64)
+				if err != nil {
+					return WrapError(err)
+				}
+			}
+
+			file, _, err := open_raw_file(path)
+			if err != nil {
+				return err
+			}
+
+			self.add_extent(&tVmdkFlatExtent{file: file, offset: offset * 512}, size)
+
+		case "SPARSE", "VMFSSPARSE":
+			extent := embedded
+			if (extent == nil) || (filepath.Base(path) != filepath.Base(name)) {
+				extent, err = open_vmdk_sparse_extent(path)
+				if err != nil {
+					return err
+				}
+			}
+
+			self.add_extent(extent, size)
+
+		default:
+			return WrapError(fmt.Errorf("Unsupported VMDK extent type: %s", kind))
+		}
+	}
+
+	if has_parent {
+		if parent_name == "" {
+			return WrapError(fmt.Errorf("Parent image of VMDK `%s` not found", name))
+		}
+
+		parent, err := open_image(resolve_image_path(name, parent_name))
+		if err != nil {
+			return err
+		}
+
+		self.parent = parent
+	}
+
+	return nil
+}
+
+func open_vmdk_image(name string) (BlockSource, error) {
+	signature := make([]byte, len(vmdk_magic))
+
+	file, _, err := open_raw_file(name)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = file.ReadAt(signature, 0)
+	file.Close()
+
+	if err != nil {
+		return nil, WrapError(err)
+	}
+
+	res := new(tVmdkImage)
+
+	if bytes.Equal(signature, vmdk_magic) {
+		extent, err := open_vmdk_sparse_extent(name)
+		if err != nil {
+			return nil, err
+		}
+
+		descriptor, err := extent.get_descriptor()
+		if err != nil {
+			extent.close()
+
+			return nil, err
+		}
+
+		if descriptor == "" {
+			res.add_extent(extent, int64(extent.header.Capacity)*512)
+
+			return res, nil
+		}
+
+		// The embedded extent is closed with the image only when the descriptor uses it
+		err = res.load_descriptor(name, descriptor, extent)
+		if (err != nil) || (len(res.extents) > 0) {
+			if !res.has_extent(extent) {
+				extent.close()
+			}
+		}
+
+		if err != nil {
+			res.Close()
+
+			return nil, err
+		}
+
+		if len(res.extents) == 0 {
+			res.add_extent(extent, int64(extent.header.Capacity)*512)
+		}
+
+		return res, nil
+	}
+
+	descriptor, err := ioutil.ReadFile(name)
+	if err != nil {
+		return nil, WrapError(err)
+	}
+
+	if err := res.load_descriptor(name, string(descriptor), nil); err != nil {
+		res.Close()
+
+		return nil, err
+	}
+
+	if len(res.extents) == 0 {
+		return nil, WrapError(errors.New("No extent in VMDK descriptor"))
+	}
+
+	return res, nil
+}
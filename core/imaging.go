@@ -0,0 +1,343 @@
+package core
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	DEFAULT_IMAGE_BLOCK_SIZE = 64 * 1024
+
+	_IMAGE_SAVE_DELAY = 5 * time.Second
+)
+
+// Passes of the imaging, as in the rescue map.
+const (
+	IMAGE_PASS_COPY = iota + 1
+	IMAGE_PASS_SCRAPE
+	IMAGE_PASS_RETRY
+)
+
+type ImageOptions struct {
+	BlockSize int64
+	Retries   int
+	Sparse    bool
+}
+
+type ImageResult struct {
+	Size    int64
+	Rescued int64
+	Bad     int64
+	Hash    string
+}
+
+func (self *ImageResult) String() string {
+	const msg = "size=%d rescued=%d bad=%d sha256=%s"
+
+	return fmt.Sprintf(msg, self.Size, self.Rescued, self.Bad, self.Hash)
+}
+
+type tImager struct {
+	disk        *DiskIO
+	dest        *os.File
+	rescue      *RescueMap
+	options     ImageOptions
+	size        int64
+	sector_size int64
+	last_save   time.Time
+}
+
+// Tells if all the bytes are zero, the zero blocks can be left as holes in the sparse files.
+func IsZeroBlock(data []byte) bool {
+	for _, b := range data {
+		if b != 0 {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (self *tImager) write(data []byte, position int64) error {
+	// The image is truncated to its full size, so the holes are read as zeros
+	if self.options.Sparse && IsZeroBlock(data) {
+		return nil
+	}
+
+	_, err := self.dest.WriteAt(data, position)
+
+	return WrapError(err)
+}
+
+func (self *tImager) checkpoint(position int64, pass int, force bool) error {
+	self.rescue.SetCurrent(position, pass)
+
+	if (!force) && (time.Since(self.last_save) < _IMAGE_SAVE_DELAY) {
+		return nil
+	}
+
+	self.last_save = time.Now()
+
+	if err := self.dest.Sync(); err != nil {
+		return WrapError(err)
+	}
+
+	pos := position * 10000 / self.size
+	rescued := self.rescue.Count(RESCUE_FINISHED)
+	bad := self.rescue.Count(RESCUE_BAD)
+
+	fmt.Printf("\rPass %d: %d.%02d%% (rescued: %d, bad: %d)   ", pass, pos/100, pos%100, rescued, bad)
+
+	return self.rescue.Save()
+}
+
+func (self *tImager) read(buffer []byte, position int64) (int, error) {
+	n, err := self.disk.ReadAt(buffer, position)
+	if IsEof(err) && (n == len(buffer)) {
+		err = nil
+	}
+
+	return n, err
+}
+
+// Copy of the areas not tried, by big blocks, a failed block is left to the next pass.
+func (self *tImager) copy_pass() error {
+	buffer := make([]byte, self.options.BlockSize)
+
+	for _, area := range self.rescue.Find(0, self.size, RESCUE_NON_TRIED) {
+		for pos := area.Position; pos < area.GetEnd(); {
+			size := self.options.BlockSize - (pos % self.options.BlockSize)
+			if remain := area.GetEnd() - pos; size > remain {
+				size = remain
+			}
+
+			n, err := self.read(buffer[:size], pos)
+			switch {
+			case err == nil:
+				if err := self.write(buffer[:size], pos); err != nil {
+					return err
+				}
+
+				self.rescue.Mark(pos, size, RESCUE_FINISHED)
+
+			case IsEof(err):
+				if err := self.write(buffer[:n], pos); err != nil {
+					return err
+				}
+
+				self.rescue.Mark(pos, int64(n), RESCUE_FINISHED)
+				self.rescue.Mark(pos+int64(n), size-int64(n), RESCUE_BAD)
+
+			default:
+				self.rescue.Mark(pos, size, RESCUE_NON_TRIMMED)
+			}
+
+			pos += size
+
+			if err := self.checkpoint(pos, IMAGE_PASS_COPY, false); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// Reads sector by sector the areas having the status `from`, the unreadable sectors are marked as bad.
+func (self *tImager) sector_pass(pass int, from byte) error {
+	buffer := make([]byte, self.sector_size)
+
+	for _, area := range self.rescue.Find(0, self.size, from) {
+		for pos := area.Position; pos < area.GetEnd(); {
+			size := self.sector_size - (pos % self.sector_size)
+			if remain := area.GetEnd() - pos; size > remain {
+				size = remain
+			}
+
+			if _, err := self.read(buffer[:size], pos); err == nil {
+				if err := self.write(buffer[:size], pos); err != nil {
+					return err
+				}
+
+				self.rescue.Mark(pos, size, RESCUE_FINISHED)
+			} else {
+				if !self.options.Sparse {
+					ClearBuffer(buffer)
+
+					if err := self.write(buffer[:size], pos); err != nil {
+						return err
+					}
+				}
+
+				self.rescue.Mark(pos, size, RESCUE_BAD)
+			}
+
+			pos += size
+
+			if err := self.checkpoint(pos, pass, false); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func (self *tImager) end_pass(pass, next int) error {
+	if err := self.checkpoint(self.size, pass, true); err != nil {
+		return err
+	}
+
+	fmt.Println()
+	self.rescue.SetCurrent(0, next)
+
+	return self.rescue.Save()
+}
+
+func (self *tImager) run() error {
+	_, pass := self.rescue.GetCurrent()
+
+	if pass <= IMAGE_PASS_COPY {
+		fmt.Println("Pass 1: copy")
+		if err := self.copy_pass(); err != nil {
+			return err
+		}
+
+		if err := self.end_pass(IMAGE_PASS_COPY, IMAGE_PASS_SCRAPE); err != nil {
+			return err
+		}
+	}
+
+	fmt.Println("Pass 2: sector by sector reading of the skipped areas")
+	if err := self.sector_pass(IMAGE_PASS_SCRAPE, RESCUE_NON_TRIMMED); err != nil {
+		return err
+	}
+
+	if err := self.end_pass(IMAGE_PASS_SCRAPE, IMAGE_PASS_RETRY); err != nil {
+		return err
+	}
+
+	for try := 1; try <= self.options.Retries; try++ {
+		if !self.rescue.Contains(0, self.size, RESCUE_BAD) {
+			break
+		}
+
+		fmt.Println(fmt.Sprintf("Pass 3: retry %d of the bad sectors", try))
+		if err := self.sector_pass(IMAGE_PASS_RETRY, RESCUE_BAD); err != nil {
+			return err
+		}
+
+		if err := self.end_pass(IMAGE_PASS_RETRY, IMAGE_PASS_RETRY); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func HashFile(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", WrapError(err)
+	}
+
+	defer DeferedCall(file.Close)
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", WrapError(err)
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// Copies the disk into an image file in several passes, the progress is kept in the rescue map,
+// so an interrupted imaging can be resumed with the same map.
+func CreateImage(disk *DiskIO, dest string, rescue *RescueMap, options ImageOptions) (*ImageResult, error) {
+	if options.BlockSize <= 0 {
+		options.BlockSize = DEFAULT_IMAGE_BLOCK_SIZE
+	}
+
+	if options.Retries < 0 {
+		options.Retries = 0
+	}
+
+	size := disk.GetSize()
+	if size <= 0 {
+		return nil, WrapError(fmt.Errorf("Nothing to copy, the source is empty"))
+	}
+
+	if (rescue.GetSize() != 0) && (rescue.GetSize() != size) {
+		const msg = "The map file %s is for a source of %d bytes, not %d"
+
+		return nil, WrapError(fmt.Errorf(msg, rescue.GetPath(), rescue.GetSize(), size))
+	}
+
+	rescue.SetSize(size)
+
+	file, err := os.OpenFile(dest, os.O_RDWR|os.O_CREATE, 0664)
+	if err != nil {
+		return nil, WrapError(err)
+	}
+
+	defer DeferedCall(file.Close)
+
+	// Without any progress, a previous content of the image must not be kept in its holes
+	if len(rescue.GetRanges()) == 0 {
+		if err := file.Truncate(0); err != nil {
+			return nil, WrapError(err)
+		}
+	}
+
+	if err := file.Truncate(size); err != nil {
+		return nil, WrapError(err)
+	}
+
+	sector_size := disk.GetSource().SectorSize()
+	if sector_size <= 0 {
+		sector_size = DEFAULT_SECTOR_SIZE
+	}
+
+	imager := &tImager{
+		disk:        disk,
+		dest:        file,
+		rescue:      rescue,
+		options:     options,
+		size:        size,
+		sector_size: sector_size,
+	}
+
+	if err := imager.run(); err != nil {
+		return nil, err
+	}
+
+	if err := file.Sync(); err != nil {
+		return nil, WrapError(err)
+	}
+
+	fmt.Println("Hashing the image")
+	hash, err := HashFile(dest)
+	if err != nil {
+		return nil, err
+	}
+
+	hash_line := fmt.Sprintf("%s  %s\n", hash, filepath.Base(dest))
+	if err := ioutil.WriteFile(dest+".sha256", []byte(hash_line), 0664); err != nil {
+		return nil, WrapError(err)
+	}
+
+	res := &ImageResult{
+		Size:    size,
+		Rescued: rescue.Count(RESCUE_FINISHED),
+		Bad:     rescue.Count(RESCUE_BAD),
+		Hash:    hash,
+	}
+
+	return res, nil
+}
@@ -88,16 +88,13 @@ func (*IndexBlockHeader) IndexType() IndexType {
 	return INDEX_TYPE_BLOCK
 }
 
-func (self *IndexBlockHeader) PrefixSize() int {
-	return 4096 - StructSize(self)
+func (self *IndexBlockHeader) PrefixSize(block_size int) int {
+	return block_size - StructSize(self)
 }
 
 func (self *IndexBlockHeader) Entries(data []byte) (map[int]*DirectoryEntryExtendedHeader, error) {
 	pos := StructSize(self) - StructSize(self.DirectoryIndex) + int(self.DirectoryIndex.EntriesOffset)
 	sz := len(data)
-	if sz > 4096 {
-		sz = 4096
-	}
 
 	res := make(map[int]*DirectoryEntryExtendedHeader)
 
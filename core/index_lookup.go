@@ -0,0 +1,191 @@
+package core
+
+import (
+	"fmt"
+)
+
+// Name of the index of the file names of a directory.
+const DIRECTORY_INDEX_NAME = "$I30"
+
+// Maximum depth of an index B-tree, a deeper descent is a loop in a damaged index.
+const _INDEX_MAX_DEPTH = 32
+
+// Index of a directory read by descents of its B-tree, the index blocks are read only when they are visited.
+type tIndexLookup struct {
+	root       []byte
+	root_start int
+	allocation *AttributeReader
+	block_size int64
+	vcn_size   int64
+	upcase     UpCase
+}
+
+// Searches the entries of a node, it returns the entry of the name, or else the VCN of the sub-node to visit (-1 for none).
+func (self *tIndexLookup) search_node(data []byte, pos int, name string) (*DirectoryEntry, int64, error) {
+	var header DirectoryEntryHeader
+
+	// The last entry has only the fields before the file name
+	const header_size = 16
+
+	for (pos + header_size) <= len(data) {
+		if err := Read(data[pos:], &header); err != nil {
+			return nil, -1, err
+		}
+
+		if (header.Length < uint16(header_size)) || ((pos + int(header.Length)) > len(data)) {
+			return nil, -1, WrapError(fmt.Errorf("Bad index entry at %d", pos))
+		}
+
+		entry := data[pos:(pos + int(header.Length))]
+
+		vcn := int64(-1)
+		if (header.Flags & DEFLAG_HAS_TRAILING) != DEFLAG_NONE {
+			var sub_node ClusterNumber
+
+			if err := Read(entry[(len(entry)-StructSize(sub_node)):], &sub_node); err != nil {
+				return nil, -1, err
+			}
+
+			vcn = int64(sub_node)
+		}
+
+		// The last entry has no name, the names after the others are in its sub-node
+		if (header.Flags & DEFLAG_LAST_ENTRY) != DEFLAG_NONE {
+			return nil, vcn, nil
+		}
+
+		if len(entry) < StructSize(header) {
+			return nil, -1, WrapError(fmt.Errorf("Bad index entry at %d", pos))
+		}
+
+		entry_name := header.DecodeFilename(entry)
+
+		switch cmp := self.upcase.Compare(name, entry_name); {
+		case cmp == 0:
+			res := header.MakeEntry(0, uint(pos))
+			res.Name = entry_name
+			if vcn >= 0 {
+				res.Vcn = ClusterNumber(vcn)
+			}
+
+			return res, -1, nil
+
+		case cmp < 0:
+			return nil, vcn, nil
+		}
+
+		pos += int(header.Length)
+	}
+
+	return nil, -1, nil
+}
+
+func (self *tIndexLookup) read_block(vcn int64) ([]byte, int, error) {
+	if self.allocation == nil {
+		return nil, 0, WrapError(fmt.Errorf("Index sub-node %d without $INDEX_ALLOCATION", vcn))
+	}
+
+	block := make([]byte, self.block_size)
+	if _, err := self.allocation.ReadAt(block, vcn*self.vcn_size); err != nil {
+		return nil, 0, err
+	}
+
+	if status := ApplyFixups(block, true); status.IsBroken() {
+		return nil, 0, WrapError(fmt.Errorf("Broken index block at the VCN %d", vcn))
+	}
+
+	var header IndexBlockHeader
+
+	if err := Read(block, &header); err != nil {
+		return nil, 0, err
+	}
+
+	if header.Type != RECTYP_INDX {
+		return nil, 0, WrapError(fmt.Errorf("No index block at the VCN %d", vcn))
+	}
+
+	start := StructSize(header) - StructSize(header.DirectoryIndex)
+
+	return block, start + int(header.DirectoryIndex.EntriesOffset), nil
+}
+
+func (self *tIndexLookup) Find(name string) (*DirectoryEntry, error) {
+	data, pos := self.root, self.root_start
+
+	for depth := 0; depth < _INDEX_MAX_DEPTH; depth++ {
+		res, vcn, err := self.search_node(data, pos, name)
+		if (err != nil) || (res != nil) || (vcn < 0) {
+			return res, err
+		}
+
+		if data, pos, err = self.read_block(vcn); err != nil {
+			return nil, err
+		}
+	}
+
+	return nil, WrapError(fmt.Errorf("The index is too deep, it has a loop"))
+}
+
+// Finds the entry of a name in the index $I30 of a directory, from its $INDEX_ROOT and $INDEX_ALLOCATION attributes,
+// by a descent of the B-tree with the NTFS collation of the file names, the entry is nil if the name is not found.
+func FindIndexEntry(io *DiskIO, attrs []*AttributeDesc, name string, upcase UpCase) (*DirectoryEntry, error) {
+	if upcase == nil {
+		upcase = DefaultUpCase()
+	}
+
+	geometry := io.GetGeometry()
+	lookup := &tIndexLookup{
+		block_size: geometry.IndexSize,
+		upcase:     upcase,
+	}
+
+	for _, attr := range attrs {
+		if attr.Name != DIRECTORY_INDEX_NAME {
+			continue
+		}
+
+		switch attr.Header.AttributeType {
+		case ATTR_INDEX_ROOT:
+			value, err := attr.GetValue(nil)
+			if err != nil {
+				return nil, err
+			}
+
+			if value == nil {
+				return nil, WrapError(fmt.Errorf("Bad $INDEX_ROOT"))
+			}
+
+			root, ok := value.Value.(*IndexRootAttribute)
+			if !ok {
+				return nil, WrapError(fmt.Errorf("Bad $INDEX_ROOT"))
+			}
+
+			if root.BytesPerIndexBlock > 0 {
+				lookup.block_size = int64(root.BytesPerIndexBlock)
+			}
+
+			lookup.root = value.Content
+			lookup.root_start = StructSize(root) - StructSize(root.DirectoryIndex) + int(root.DirectoryIndex.EntriesOffset)
+
+		case ATTR_INDEX_ALLOCATION:
+			reader, err := attr.GetReader(io)
+			if err != nil {
+				return nil, err
+			}
+
+			lookup.allocation = reader
+		}
+	}
+
+	if lookup.root == nil {
+		return nil, WrapError(fmt.Errorf("No index %s", DIRECTORY_INDEX_NAME))
+	}
+
+	// The VCNs of the index blocks smaller than a cluster are counted in sectors of 512 bytes
+	lookup.vcn_size = geometry.ClusterSize
+	if lookup.block_size < geometry.ClusterSize {
+		lookup.vcn_size = 512
+	}
+
+	return lookup.Find(name)
+}
@@ -0,0 +1,229 @@
+package core
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// Size of the data of a chunk of an LZNT1 stream, once decompressed.
+const LZNT1_CHUNK_SIZE = 4096
+
+const (
+	_LZNT1_COMPRESSED = 0x8000
+	_LZNT1_SIZE_MASK  = 0x0FFF
+)
+
+func decompress_lznt1_chunk(chunk []byte) ([]byte, error) {
+	res := make([]byte, 0, LZNT1_CHUNK_SIZE)
+
+	for pos := 0; pos < len(chunk); {
+		flags := chunk[pos]
+		pos++
+
+		for bit := uint(0); (bit < 8) && (pos < len(chunk)); bit++ {
+			if (flags & (1 << bit)) == 0 {
+				res = append(res, chunk[pos])
+				pos++
+
+				continue
+			}
+
+			if (pos + 2) > len(chunk) {
+				return nil, WrapError(fmt.Errorf("LZNT1: truncated back reference at %d", pos))
+			}
+
+			token := int(binary.LittleEndian.Uint16(chunk[pos:]))
+			pos += 2
+
+			// The more data is decompressed, the more bits are used for the offset
+			length_bits := uint(12)
+			for i := len(res) - 1; i >= 0x10; i >>= 1 {
+				length_bits--
+			}
+
+			offset := (token >> length_bits) + 1
+			length := (token & ((1 << length_bits) - 1)) + 3
+
+			if offset > len(res) {
+				return nil, WrapError(fmt.Errorf("LZNT1: back reference before the start of the chunk"))
+			}
+
+			if (len(res) + length) > LZNT1_CHUNK_SIZE {
+				return nil, WrapError(fmt.Errorf("LZNT1: chunk bigger than %d bytes", LZNT1_CHUNK_SIZE))
+			}
+
+			// The copy can overlap the bytes it produces
+			for i := 0; i < length; i++ {
+				res = append(res, res[len(res)-offset])
+			}
+		}
+	}
+
+	return res, nil
+}
+
+// Decompresses an LZNT1 stream (a compression unit of NTFS) into `size` bytes at most,
+// the chunks shorter than 4K are padded with zeros.
+func DecompressLZNT1(src []byte, size int) ([]byte, error) {
+	res := make([]byte, 0, size)
+
+	for pos := 0; ((pos + 2) <= len(src)) && (len(res) < size); {
+		header := binary.LittleEndian.Uint16(src[pos:])
+		if header == 0 {
+			break
+		}
+
+		start := pos + 2
+		end := start + int(header&_LZNT1_SIZE_MASK) + 1
+		if end > len(src) {
+			return nil, WrapError(fmt.Errorf("LZNT1: truncated chunk at %d", pos))
+		}
+
+		chunk := src[start:end]
+		if (header & _LZNT1_COMPRESSED) != 0 {
+			data, err := decompress_lznt1_chunk(chunk)
+			if err != nil {
+				return nil, err
+			}
+
+			chunk = data
+		}
+
+		res = append(res, chunk...)
+		if pad := LZNT1_CHUNK_SIZE - len(chunk); pad > 0 {
+			res = append(res, make([]byte, pad)...)
+		}
+
+		pos = end
+	}
+
+	if len(res) > size {
+		res = res[:size]
+	}
+
+	return res, nil
+}
+
+// Part of the run list which covers `count` clusters from the VCN `vcn`, the runs are cut at the bounds.
+func (self RunList) Slice(vcn, count int64) RunList {
+	res := make(RunList, 0)
+	end := vcn + count
+	pos := int64(0)
+
+	for _, run := range self {
+		next := pos + run.Count
+		if next <= vcn {
+			pos = next
+
+			continue
+		}
+
+		if pos >= end {
+			break
+		}
+
+		skip, cnt := int64(0), run.Count
+		if pos < vcn {
+			skip = vcn - pos
+			cnt -= skip
+		}
+
+		if next > end {
+			cnt -= next - end
+		}
+
+		entry := &RunEntry{Count: cnt, Zero: run.Zero}
+		if !run.Zero {
+			entry.Start = run.Start + ClusterNumber(skip)
+		}
+
+		res = append(res, entry)
+		pos = next
+	}
+
+	return res
+}
+
+// Number of clusters of a compression unit, zero if the attribute is not compressed.
+func (self *AttributeDesc) GetCompressionUnit() int64 {
+	desc := self.NonResidentDesc()
+	if (desc == nil) || (desc.CompressionUnit == 0) || ((self.Header.Flags & AFLAG_COMPRESSED) == AFLAG_NONE) {
+		return 0
+	}
+
+	return int64(1) << desc.CompressionUnit
+}
+
+// Reads the compression unit at the VCN `vcn` into `buffer` (of the size of a unit).
+// A unit without cluster is a hole, a unit with all its clusters is stored uncompressed,
+// and a unit ending with a sparse run is an LZNT1 stream. It returns false after the end of the run list.
+func read_compression_unit(io *DiskIO, runlist RunList, unit, vcn int64, buffer []byte) (bool, error) {
+	cluster_size := io.GetGeometry().ClusterSize
+
+	parts := runlist.Slice(vcn, unit)
+	if len(parts) == 0 {
+		return false, nil
+	}
+
+	allocated, sparse := int64(0), int64(0)
+	for _, part := range parts {
+		if part.Zero {
+			sparse += part.Count
+		} else {
+			allocated += part.Count
+		}
+	}
+
+	ClearBuffer(buffer)
+
+	read := buffer[:(allocated * cluster_size)]
+	for offset, i := int64(0), 0; i < len(parts); i++ {
+		part := parts[i]
+		if part.Zero {
+			continue
+		}
+
+		if err := io.ReadClusters(int64(part.Start), part.Count, read[offset:]); (err != nil) && (!IsEof(err)) {
+			return false, err
+		}
+
+		offset += part.Count * cluster_size
+	}
+
+	if (allocated > 0) && (sparse > 0) {
+		decompressed, err := DecompressLZNT1(read, len(buffer))
+		if err != nil {
+			return false, WrapError(fmt.Errorf("Compression unit at VCN %d: %v", vcn, err))
+		}
+
+		copy(buffer, decompressed)
+		ClearBuffer(buffer[len(decompressed):])
+	}
+
+	return true, nil
+}
+
+// Reads `size` bytes of a compressed attribute, compression unit by compression unit, the data are given to `write`.
+func ReadCompressed(io *DiskIO, runlist RunList, unit, size int64, write func([]byte) error) error {
+	buffer := make([]byte, unit*io.GetGeometry().ClusterSize)
+
+	for vcn := int64(0); size > 0; vcn += unit {
+		ok, err := read_compression_unit(io, runlist, unit, vcn, buffer)
+		if (err != nil) || !ok {
+			return err
+		}
+
+		data := buffer
+		if int64(len(data)) > size {
+			data = data[:size]
+		}
+
+		if err := write(data); err != nil {
+			return err
+		}
+
+		size -= int64(len(data))
+	}
+
+	return nil
+}
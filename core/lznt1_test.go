@@ -0,0 +1,215 @@
+package core
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// Stream of one chunk, with a header of its size and of its compression flag.
+func make_lznt1_chunk(compressed bool, data ...byte) []byte {
+	header := 0x3000 | (len(data) - 1)
+	if compressed {
+		header |= _LZNT1_COMPRESSED
+	}
+
+	return append([]byte{byte(header), byte(header >> 8)}, data...)
+}
+
+func padded(data string, size int) []byte {
+	res := make([]byte, size)
+	copy(res, data)
+
+	return res
+}
+
+func TestLznt1LiteralChunk(t *testing.T) {
+	// Flags at zero: 8 literals
+	src := make_lznt1_chunk(true, 0x00, 'a', 'b', 'c', 'd', 'e', 'f', 'g', 'h')
+
+	res, err := DecompressLZNT1(src, 8)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(res) != "abcdefgh" {
+		t.Errorf("Bad data: %q", res)
+	}
+}
+
+func TestLznt1OverlappingBackReference(t *testing.T) {
+	// 2 literals, then a reference (offset= 2, length= 6) which copies the bytes it produces
+	src := make_lznt1_chunk(true, 0x04, 'a', 'b', 0x03, 0x10)
+
+	res, err := DecompressLZNT1(src, 8)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(res) != "abababab" {
+		t.Errorf("Bad data: %q", res)
+	}
+}
+
+func TestLznt1OffsetLengthSplit(t *testing.T) {
+	cases := []struct {
+		name     string
+		literals string
+		token    uint16
+		expected string
+	}{
+		// Up to 16 bytes, 4 bits for the offset and 12 for the length: offset= 1, length= 4
+		{"12 bits", "ABCDEFGHIJKLMNOP", 0x0001, "ABCDEFGHIJKLMNOPPPPP"},
+
+		// From 17 bytes, 11 bits for the length: offset= 17, length= 5
+		{"11 bits", "ABCDEFGHIJKLMNOPQ", 0x8002, "ABCDEFGHIJKLMNOPQABCDE"},
+
+		// From 33 bytes, 10 bits for the length: offset= 33, length= 3
+		{"10 bits", "ABCDEFGHIJKLMNOPQRSTUVWXYZ0123456", 0x8000, "ABCDEFGHIJKLMNOPQRSTUVWXYZ0123456ABC"},
+	}
+
+	for _, c := range cases {
+		var chunk []byte
+
+		// A flag byte before each group of 8 tokens, the reference is the token after the literals
+		literals := []byte(c.literals)
+		for len(literals) >= 8 {
+			chunk = append(append(chunk, 0x00), literals[:8]...)
+			literals = literals[8:]
+		}
+
+		chunk = append(append(chunk, byte(1<<uint(len(literals)))), literals...)
+		chunk = append(chunk, byte(c.token), byte(c.token>>8))
+
+		res, err := DecompressLZNT1(make_lznt1_chunk(true, chunk...), len(c.expected))
+		if err != nil {
+			t.Fatalf("%s: %v", c.name, err)
+		}
+
+		if string(res) != c.expected {
+			t.Errorf("%s: bad data: %q", c.name, res)
+		}
+	}
+}
+
+func TestLznt1UncompressedChunk(t *testing.T) {
+	src := make_lznt1_chunk(false, 'x', 'y', 'z')
+
+	res, err := DecompressLZNT1(src, LZNT1_CHUNK_SIZE)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(res, padded("xyz", LZNT1_CHUNK_SIZE)) {
+		t.Errorf("Bad data: %q", res[:8])
+	}
+}
+
+func TestLznt1ShortChunksArePadded(t *testing.T) {
+	// The data of a chunk shorter than 4K are followed by zeros, up to the next chunk
+	src := append(make_lznt1_chunk(true, 0x00, 'a', 'b', 'c'), make_lznt1_chunk(false, 'd', 'e', 'f')...)
+
+	res, err := DecompressLZNT1(src, 2*LZNT1_CHUNK_SIZE)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := append(padded("abc", LZNT1_CHUNK_SIZE), padded("def", LZNT1_CHUNK_SIZE)...)
+	if !bytes.Equal(res, expected) {
+		t.Errorf("Bad data (size= %d)", len(res))
+	}
+}
+
+func TestLznt1NullHeaderEndsStream(t *testing.T) {
+	src := make_lznt1_chunk(true, 0x00, 'a', 'b', 'c')
+	src = append(src, 0x00, 0x00)
+	src = append(src, make_lznt1_chunk(false, 'd', 'e', 'f')...)
+
+	res, err := DecompressLZNT1(src, 2*LZNT1_CHUNK_SIZE)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(res, padded("abc", LZNT1_CHUNK_SIZE)) {
+		t.Errorf("Bad data (size= %d)", len(res))
+	}
+}
+
+func TestLznt1Errors(t *testing.T) {
+	cases := []struct {
+		name  string
+		src   []byte
+		error string
+	}{
+		// The header announces 10 bytes, only 4 are in the stream
+		{"truncated chunk", []byte{0x09, 0xB0, 0x00, 'a', 'b', 'c'}, "truncated chunk"},
+
+		// A reference with only one byte of its token
+		{"truncated reference", make_lznt1_chunk(true, 0x02, 'a', 0x03), "truncated back reference"},
+
+		// A reference at the start of the chunk: offset= 1, length= 3
+		{"reference before start", make_lznt1_chunk(true, 0x01, 0x00, 0x00), "before the start of the chunk"},
+	}
+
+	for _, c := range cases {
+		_, err := DecompressLZNT1(c.src, LZNT1_CHUNK_SIZE)
+		if err == nil {
+			t.Errorf("%s: no error", c.name)
+
+			continue
+		}
+
+		if msg := GetSource(err).Error(); !strings.Contains(msg, c.error) {
+			t.Errorf("%s: bad error: %s", c.name, msg)
+		}
+	}
+}
+
+func TestReadCompressionUnit(t *testing.T) {
+	geometry := DefaultGeometry()
+	cluster_size := int(geometry.ClusterSize)
+
+	// Clusters 1 and 2 have raw data, the cluster 3 has an LZNT1 stream of two chunks
+	content := make([]byte, 4*cluster_size)
+	for i := cluster_size; i < (3 * cluster_size); i++ {
+		content[i] = byte(i / 7)
+	}
+
+	stream := append(make_lznt1_chunk(true, 0x04, 'a', 'b', 0x03, 0x10), make_lznt1_chunk(false, 'x', 'y', 'z')...)
+	copy(content[(3*cluster_size):], stream)
+
+	disk := NewDisk(NewMemorySource(content, geometry.SectorSize))
+	expected_mixed := append(padded("abababab", LZNT1_CHUNK_SIZE), padded("xyz", LZNT1_CHUNK_SIZE)...)
+
+	cases := []struct {
+		name     string
+		runlist  RunList
+		expected []byte
+	}{
+		{"sparse", RunList{{Count: 2, Zero: true}}, make([]byte, 2*cluster_size)},
+		{"allocated", RunList{{Start: 1, Count: 2}}, content[cluster_size:(3 * cluster_size)]},
+		{"mixed", RunList{{Start: 3, Count: 1}, {Count: 1, Zero: true}}, expected_mixed},
+	}
+
+	for _, c := range cases {
+		buffer := bytes.Repeat([]byte{0xFF}, 2*cluster_size)
+
+		ok, err := read_compression_unit(disk, c.runlist, 2, 0, buffer)
+		if err != nil {
+			t.Fatalf("%s: %v", c.name, err)
+		}
+
+		if !ok {
+			t.Fatalf("%s: no compression unit", c.name)
+		}
+
+		if !bytes.Equal(buffer, c.expected) {
+			t.Errorf("%s: bad data", c.name)
+		}
+
+		// After the end of the run list
+		if ok, err := read_compression_unit(disk, c.runlist, 2, 2, buffer); ok || (err != nil) {
+			t.Errorf("%s: a unit is read after the end of the run list (err= %v)", c.name, err)
+		}
+	}
+}
@@ -0,0 +1,362 @@
+package core
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// LZX as used by WIM archives and WOF compressed files: 32K window, fixed E8 translation size.
+const (
+	_LZX_NUM_CHARS          = 256
+	_LZX_MIN_MATCH          = 2
+	_LZX_NUM_LEN_HEADERS    = 8
+	_LZX_NUM_OFFSET_SLOTS   = 30
+	_LZX_MAIN_SYMBOLS       = _LZX_NUM_CHARS + (_LZX_NUM_LEN_HEADERS * _LZX_NUM_OFFSET_SLOTS)
+	_LZX_LEN_SYMBOLS        = 249
+	_LZX_PRE_SYMBOLS        = 20
+	_LZX_ALIGNED_SYMBOLS    = 8
+	_LZX_MAX_LENGTH         = 16
+	_LZX_OFFSET_ADJUSTMENT  = 2
+	_LZX_DEFAULT_BLOCK_SIZE = 32768
+	_LZX_E8_FILE_SIZE       = 12000000
+)
+
+const (
+	_LZX_BLOCK_VERBATIM     = 1
+	_LZX_BLOCK_ALIGNED      = 2
+	_LZX_BLOCK_UNCOMPRESSED = 3
+)
+
+var lzx_extra_bits = [_LZX_NUM_OFFSET_SLOTS]uint{
+	0, 0, 0, 0, 1, 1, 2, 2, 3, 3, 4, 4, 5, 5, 6, 6, 7, 7, 8, 8, 9, 9, 10, 10, 11, 11, 12, 12, 13, 13,
+}
+
+var lzx_slot_base = func() [_LZX_NUM_OFFSET_SLOTS]int {
+	var res [_LZX_NUM_OFFSET_SLOTS]int
+
+	for i := 1; i < _LZX_NUM_OFFSET_SLOTS; i++ {
+		res[i] = res[i-1] + (1 << lzx_extra_bits[i-1])
+	}
+
+	return res
+}()
+
+// Bit stream of LZX: 16-bit little-endian words, read from their most significant bit.
+// The words are only read when they are needed, so the bits left are always those of the current word.
+type tLzxBits struct {
+	data []byte
+	pos  int
+	buf  uint32
+	left uint
+}
+
+func (self *tLzxBits) load() {
+	var word uint32
+
+	if (self.pos + 2) <= len(self.data) {
+		word = uint32(binary.LittleEndian.Uint16(self.data[self.pos:]))
+	}
+
+	self.pos += 2
+	self.buf |= word << (16 - self.left)
+	self.left += 16
+}
+
+func (self *tLzxBits) bit() uint32 {
+	return self.bits(1)
+}
+
+func (self *tLzxBits) bits(count uint) uint32 {
+	if count == 0 {
+		return 0
+	}
+
+	for self.left < count {
+		self.load()
+	}
+
+	res := self.buf >> (32 - count)
+	self.buf <<= count
+	self.left -= count
+
+	return res
+}
+
+// Skips to the next word, a whole word is skipped if the stream is already aligned.
+func (self *tLzxBits) align() {
+	if self.left == 0 {
+		self.load()
+	}
+
+	self.buf, self.left = 0, 0
+}
+
+func (self *tLzxBits) overrun() bool {
+	return self.pos > len(self.data)
+}
+
+// Reads code lengths with a pretree, they are coded as differences with the previous lengths.
+func (self *tLzxBits) read_lengths(lengths []uint8) error {
+	pre_lengths := make([]uint8, _LZX_PRE_SYMBOLS)
+	for i := range pre_lengths {
+		pre_lengths[i] = uint8(self.bits(4))
+	}
+
+	pretree, err := make_huffman(pre_lengths, _LZX_MAX_LENGTH)
+	if err != nil {
+		return err
+	}
+
+	delta := func(length uint8, symbol int) uint8 {
+		return uint8((int(length) - symbol + 17) % 17)
+	}
+
+	for i := 0; i < len(lengths); {
+		symbol, _, err := pretree.decode(self.bit)
+		if err != nil {
+			return err
+		}
+
+		switch symbol {
+		case 17, 18:
+			var run int
+
+			if symbol == 17 {
+				run = 4 + int(self.bits(4))
+			} else {
+				run = 20 + int(self.bits(5))
+			}
+
+			for ; (run > 0) && (i < len(lengths)); run-- {
+				lengths[i] = 0
+				i++
+			}
+
+		case 19:
+			run := 4 + int(self.bits(1))
+
+			symbol, _, err := pretree.decode(self.bit)
+			if err != nil {
+				return err
+			}
+
+			if symbol > 16 {
+				return WrapError(fmt.Errorf("LZX: bad pretree symbol %d in a run", symbol))
+			}
+
+			length := delta(lengths[i], symbol)
+			for ; (run > 0) && (i < len(lengths)); run-- {
+				lengths[i] = length
+				i++
+			}
+
+		default:
+			lengths[i] = delta(lengths[i], symbol)
+			i++
+		}
+	}
+
+	return nil
+}
+
+// Undoes the translation of the targets of the x86 CALL instructions (0xE8).
+func lzx_undo_e8(data []byte) {
+	if len(data) <= 10 {
+		return
+	}
+
+	for pos := 0; pos < (len(data) - 10); pos++ {
+		if data[pos] != 0xE8 {
+			continue
+		}
+
+		target := int32(binary.LittleEndian.Uint32(data[(pos + 1):]))
+		switch {
+		case (target >= 0) && (target < _LZX_E8_FILE_SIZE):
+			binary.LittleEndian.PutUint32(data[(pos+1):], uint32(target-int32(pos)))
+
+		case (target < 0) && (target >= -int32(pos)):
+			binary.LittleEndian.PutUint32(data[(pos+1):], uint32(target+_LZX_E8_FILE_SIZE))
+		}
+
+		pos += 4
+	}
+}
+
+// Decompresses an LZX chunk (WIM variant) into `size` bytes.
+func DecompressLZX(src []byte, size int) ([]byte, error) {
+	res := make([]byte, 0, size)
+	stream := &tLzxBits{data: src}
+	main_lengths := make([]uint8, _LZX_MAIN_SYMBOLS)
+	len_lengths := make([]uint8, _LZX_LEN_SYMBOLS)
+	recent := [3]int{1, 1, 1}
+
+	for len(res) < size {
+		block_type := stream.bits(3)
+		block_size := _LZX_DEFAULT_BLOCK_SIZE
+		if stream.bit() == 0 {
+			block_size = int(stream.bits(16))
+		}
+
+		if stream.overrun() {
+			return nil, WrapError(fmt.Errorf("LZX: truncated stream"))
+		}
+
+		if block_size == 0 {
+			return nil, WrapError(fmt.Errorf("LZX: empty block"))
+		}
+
+		block_end := len(res) + block_size
+		if block_end > size {
+			block_end = size
+		}
+
+		switch block_type {
+		case _LZX_BLOCK_UNCOMPRESSED:
+			stream.align()
+
+			if (stream.pos + 12) > len(src) {
+				return nil, WrapError(fmt.Errorf("LZX: truncated uncompressed block"))
+			}
+
+			for i := range recent {
+				recent[i] = int(binary.LittleEndian.Uint32(src[stream.pos:]))
+				stream.pos += 4
+
+				if recent[i] == 0 {
+					return nil, WrapError(fmt.Errorf("LZX: null recent offset"))
+				}
+			}
+
+			count := block_end - len(res)
+			if (stream.pos + count) > len(src) {
+				return nil, WrapError(fmt.Errorf("LZX: truncated uncompressed block"))
+			}
+
+			res = append(res, src[stream.pos:(stream.pos+count)]...)
+			stream.pos += count
+
+			// The uncompressed blocks are padded to an even size
+			if (block_size & 1) != 0 {
+				stream.pos++
+			}
+
+		case _LZX_BLOCK_VERBATIM, _LZX_BLOCK_ALIGNED:
+			var aligned *tHuffman
+
+			if block_type == _LZX_BLOCK_ALIGNED {
+				aligned_lengths := make([]uint8, _LZX_ALIGNED_SYMBOLS)
+				for i := range aligned_lengths {
+					aligned_lengths[i] = uint8(stream.bits(3))
+				}
+
+				tree, err := make_huffman(aligned_lengths, _LZX_MAX_LENGTH)
+				if err != nil {
+					return nil, err
+				}
+
+				aligned = tree
+			}
+
+			if err := stream.read_lengths(main_lengths[:_LZX_NUM_CHARS]); err != nil {
+				return nil, err
+			}
+
+			if err := stream.read_lengths(main_lengths[_LZX_NUM_CHARS:]); err != nil {
+				return nil, err
+			}
+
+			if err := stream.read_lengths(len_lengths); err != nil {
+				return nil, err
+			}
+
+			main_tree, err := make_huffman(main_lengths, _LZX_MAX_LENGTH)
+			if err != nil {
+				return nil, err
+			}
+
+			len_tree, err := make_huffman(len_lengths, _LZX_MAX_LENGTH)
+			if err != nil {
+				return nil, err
+			}
+
+			for len(res) < block_end {
+				if stream.overrun() {
+					return nil, WrapError(fmt.Errorf("LZX: truncated stream"))
+				}
+
+				symbol, _, err := main_tree.decode(stream.bit)
+				if err != nil {
+					return nil, err
+				}
+
+				if symbol < _LZX_NUM_CHARS {
+					res = append(res, byte(symbol))
+
+					continue
+				}
+
+				symbol -= _LZX_NUM_CHARS
+				slot, length := symbol/_LZX_NUM_LEN_HEADERS, symbol%_LZX_NUM_LEN_HEADERS
+
+				if length == (_LZX_NUM_LEN_HEADERS - 1) {
+					len_symbol, _, err := len_tree.decode(stream.bit)
+					if err != nil {
+						return nil, err
+					}
+
+					length += len_symbol
+				}
+
+				length += _LZX_MIN_MATCH
+
+				var offset int
+
+				if slot < len(recent) {
+					offset = recent[slot]
+					recent[slot] = recent[0]
+					recent[0] = offset
+				} else {
+					extra := lzx_extra_bits[slot]
+					offset = lzx_slot_base[slot]
+
+					if (aligned != nil) && (extra >= 3) {
+						offset += int(stream.bits(extra-3)) << 3
+
+						aligned_symbol, _, err := aligned.decode(stream.bit)
+						if err != nil {
+							return nil, err
+						}
+
+						offset += aligned_symbol
+					} else {
+						offset += int(stream.bits(extra))
+					}
+
+					offset -= _LZX_OFFSET_ADJUSTMENT
+					recent[2], recent[1], recent[0] = recent[1], recent[0], offset
+				}
+
+				if (offset <= 0) || (offset > len(res)) {
+					return nil, WrapError(fmt.Errorf("LZX: match before the start of the data"))
+				}
+
+				if (len(res) + length) > block_end {
+					return nil, WrapError(fmt.Errorf("LZX: match beyond the end of the block"))
+				}
+
+				// The copy can overlap the bytes it produces
+				for i := 0; i < length; i++ {
+					res = append(res, res[len(res)-offset])
+				}
+			}
+
+		default:
+			return nil, WrapError(fmt.Errorf("LZX: bad block type %d", block_type))
+		}
+	}
+
+	lzx_undo_e8(res)
+
+	return res, nil
+}
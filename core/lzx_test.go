@@ -0,0 +1,306 @@
+package core
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strings"
+	"testing"
+)
+
+// Writer of an LZX stream: 16-bit little-endian words, filled from their most significant bit.
+type tLzxWriter struct {
+	out   []byte
+	acc   uint32
+	count uint
+}
+
+func (self *tLzxWriter) bits(value uint32, count uint) {
+	for count > 0 {
+		count--
+
+		self.acc = (self.acc << 1) | ((value >> count) & 1)
+		self.count++
+
+		if self.count == 16 {
+			self.out = append(self.out, byte(self.acc), byte(self.acc>>8))
+			self.acc, self.count = 0, 0
+		}
+	}
+}
+
+func (self *tLzxWriter) symbol(code *tTestCode, symbol int) {
+	self.bits(code.codes[symbol], uint(code.lengths[symbol]))
+}
+
+// Pads to the next word, a whole word is written if the stream is already aligned.
+func (self *tLzxWriter) align() {
+	if self.count == 0 {
+		self.bits(0, 16)
+	} else {
+		self.bits(0, 16-self.count)
+	}
+}
+
+func (self *tLzxWriter) raw(data ...byte) {
+	self.out = append(self.out, data...)
+}
+
+func (self *tLzxWriter) data() []byte {
+	if self.count > 0 {
+		self.bits(0, 16-self.count)
+	}
+
+	return self.out
+}
+
+// Header of a block, with its size on 16 bits.
+func (self *tLzxWriter) header(block_type uint32, size int) {
+	self.bits(block_type, 3)
+	self.bits(0, 1)
+	self.bits(uint32(size), 16)
+}
+
+func (self *tLzxWriter) uncompressed(data ...byte) {
+	self.header(_LZX_BLOCK_UNCOMPRESSED, len(data))
+	self.align()
+
+	// The recent offsets
+	for i := 0; i < 3; i++ {
+		self.raw(1, 0, 0, 0)
+	}
+
+	self.raw(data...)
+	if (len(data) & 1) != 0 {
+		self.raw(0)
+	}
+}
+
+// Pretree of 8 codes of 3 bits: the null lengths, the runs of zeros and the lengths 1 to 5.
+var lzx_test_pretree = func() *tTestCode {
+	lengths := make([]uint8, _LZX_PRE_SYMBOLS)
+	for _, symbol := range []int{0, 12, 13, 14, 15, 16, 17, 18} {
+		lengths[symbol] = 3
+	}
+
+	return make_test_code(lengths)
+}()
+
+// Code lengths after null lengths, a length is coded as its difference with the previous one.
+func (self *tLzxWriter) lengths(lengths []uint8) {
+	for _, length := range lzx_test_pretree.lengths {
+		self.bits(uint32(length), 4)
+	}
+
+	for i := 0; i < len(lengths); {
+		if lengths[i] != 0 {
+			self.symbol(lzx_test_pretree, 17-int(lengths[i]))
+			i++
+
+			continue
+		}
+
+		run := 0
+		for ((i + run) < len(lengths)) && (lengths[i+run] == 0) {
+			run++
+		}
+
+		switch {
+		case run >= 20:
+			if run > 51 {
+				run = 51
+			}
+
+			self.symbol(lzx_test_pretree, 18)
+			self.bits(uint32(run-20), 5)
+
+		case run >= 4:
+			if run > 19 {
+				run = 19
+			}
+
+			self.symbol(lzx_test_pretree, 17)
+			self.bits(uint32(run-4), 4)
+
+		default:
+			run = 1
+			self.symbol(lzx_test_pretree, 0)
+		}
+
+		i += run
+	}
+}
+
+func (self *tLzxWriter) trees(main_lengths, len_lengths []uint8) {
+	self.lengths(main_lengths[:_LZX_NUM_CHARS])
+	self.lengths(main_lengths[_LZX_NUM_CHARS:])
+	self.lengths(len_lengths)
+}
+
+// Symbol of a match: the offset slot and the length less 2, 7 for a longer length.
+func lzx_match_symbol(slot, length int) int {
+	return _LZX_NUM_CHARS + (slot * _LZX_NUM_LEN_HEADERS) + length
+}
+
+func TestLzxUncompressedBlocks(t *testing.T) {
+	// The first block has an odd size, it is padded
+	writer := &tLzxWriter{}
+	writer.uncompressed([]byte("abcdefg")...)
+	writer.uncompressed([]byte("hij")...)
+
+	res, err := DecompressLZX(writer.data(), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(res) != "abcdefghij" {
+		t.Errorf("Bad data: %q", res)
+	}
+}
+
+func TestLzxVerbatimBlock(t *testing.T) {
+	// Offset= 3 in the slot 4 (base= 4, 1 bit) with the adjustment of 2,
+	// then the same offset from the recent ones with a length in the length tree
+	match := lzx_match_symbol(4, 6-_LZX_MIN_MATCH)
+	repeat := lzx_match_symbol(0, _LZX_NUM_LEN_HEADERS-1)
+
+	main_lengths := make([]uint8, _LZX_MAIN_SYMBOLS)
+	main_lengths['a'], main_lengths['b'], main_lengths['c'], main_lengths[match], main_lengths[repeat] = 2, 2, 2, 3, 3
+	main_code := make_test_code(main_lengths)
+
+	len_lengths := make([]uint8, _LZX_LEN_SYMBOLS)
+	len_lengths[5] = 1
+	len_code := make_test_code(len_lengths)
+
+	writer := &tLzxWriter{}
+	writer.header(_LZX_BLOCK_VERBATIM, 23)
+	writer.trees(main_lengths, len_lengths)
+	writer.symbol(main_code, 'a')
+	writer.symbol(main_code, 'b')
+	writer.symbol(main_code, 'c')
+	writer.symbol(main_code, match)
+	writer.bits(1, 1)
+
+	// Length= 2+7+5
+	writer.symbol(main_code, repeat)
+	writer.symbol(len_code, 5)
+
+	res, err := DecompressLZX(writer.data(), 23)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(res) != "abcabcabcabcabcabcabcab" {
+		t.Errorf("Bad data: %q", res)
+	}
+}
+
+func TestLzxAlignedBlock(t *testing.T) {
+	// Offset= 19 in the slot 8 (base= 16, 3 bits), the 3 low bits come from the aligned tree
+	match := lzx_match_symbol(8, 4-_LZX_MIN_MATCH)
+	literals := "abcabcabcabcabcabca"
+
+	main_lengths := make([]uint8, _LZX_MAIN_SYMBOLS)
+	main_lengths['a'], main_lengths['b'], main_lengths['c'], main_lengths[match] = 2, 2, 2, 2
+	main_code := make_test_code(main_lengths)
+
+	aligned_lengths := make([]uint8, _LZX_ALIGNED_SYMBOLS)
+	aligned_lengths[0], aligned_lengths[5] = 1, 1
+	aligned_code := make_test_code(aligned_lengths)
+
+	writer := &tLzxWriter{}
+	writer.header(_LZX_BLOCK_ALIGNED, len(literals)+4)
+	for _, length := range aligned_lengths {
+		writer.bits(uint32(length), 3)
+	}
+
+	writer.trees(main_lengths, make([]uint8, _LZX_LEN_SYMBOLS))
+	for _, c := range []byte(literals) {
+		writer.symbol(main_code, int(c))
+	}
+
+	writer.symbol(main_code, match)
+	writer.symbol(aligned_code, 5)
+
+	res, err := DecompressLZX(writer.data(), len(literals)+4)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if expected := literals + literals[:4]; string(res) != expected {
+		t.Errorf("Bad data: %q", res)
+	}
+}
+
+func TestLzxE8Translation(t *testing.T) {
+	data := make([]byte, 24)
+	expected := make([]byte, len(data))
+
+	// An absolute target, it becomes relative to the position of the instruction
+	data[3] = 0xE8
+	binary.LittleEndian.PutUint32(data[4:], 0x13)
+	expected[3] = 0xE8
+	binary.LittleEndian.PutUint32(expected[4:], 0x10)
+
+	// A negative target, after the instruction
+	data[10] = 0xE8
+	binary.LittleEndian.PutUint32(data[11:], uint32(0xFFFFFFFE))
+	expected[10] = 0xE8
+	binary.LittleEndian.PutUint32(expected[11:], _LZX_E8_FILE_SIZE-2)
+
+	// The last 10 bytes are not translated
+	data[16], data[17] = 0xE8, 0x20
+	expected[16], expected[17] = 0xE8, 0x20
+
+	writer := &tLzxWriter{}
+	writer.uncompressed(data...)
+
+	res, err := DecompressLZX(writer.data(), len(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(res, expected) {
+		t.Errorf("Bad data: %x", res)
+	}
+}
+
+func TestLzxErrors(t *testing.T) {
+	main_lengths := make([]uint8, _LZX_MAIN_SYMBOLS)
+	main_lengths['a'], main_lengths['b'] = 1, 1
+
+	// A verbatim block of 1000 bytes without its symbols
+	verbatim := &tLzxWriter{}
+	verbatim.header(_LZX_BLOCK_VERBATIM, 1000)
+	verbatim.trees(main_lengths, make([]uint8, _LZX_LEN_SYMBOLS))
+
+	uncompressed := &tLzxWriter{}
+	uncompressed.uncompressed(make([]byte, 100)...)
+
+	bad_type := &tLzxWriter{}
+	bad_type.header(5, 100)
+
+	cases := []struct {
+		name  string
+		src   []byte
+		error string
+	}{
+		{"empty", nil, "truncated stream"},
+		{"truncated verbatim block", verbatim.data(), "truncated stream"},
+		{"truncated uncompressed block", uncompressed.data()[:30], "truncated uncompressed block"},
+		{"truncated recent offsets", uncompressed.data()[:10], "truncated uncompressed block"},
+		{"bad block type", bad_type.data(), "bad block type 5"},
+	}
+
+	for _, c := range cases {
+		_, err := DecompressLZX(c.src, 1000)
+		if err == nil {
+			t.Errorf("%s: no error", c.name)
+
+			continue
+		}
+
+		if msg := GetSource(err).Error(); !strings.Contains(msg, c.error) {
+			t.Errorf("%s: bad error: %s", c.name, msg)
+		}
+	}
+}
@@ -0,0 +1,253 @@
+package core
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"sync"
+)
+
+// Modified area of the source, with the bytes read from the source and the ones written in the overlay.
+type OverlayChange struct {
+	Position int64
+	Source   []byte
+	Overlay  []byte
+}
+
+func (self *OverlayChange) String() string {
+	return fmt.Sprintf("%d - %d [ Size= %d ]", self.Position, self.Position+int64(len(self.Overlay))-1, len(self.Overlay))
+}
+
+// Copy-on-write source: the writes go into a sparse delta file, the written areas are recorded in a map file
+// (ddrescue format, written areas are marked as finished) and the reads merge the delta over the source.
+// The wrapped source is never modified.
+type OverlaySource struct {
+	source  BlockSource
+	delta   *os.File
+	written *RescueMap
+	mutex   sync.Mutex
+}
+
+func (self *OverlaySource) read_delta(data []byte, offset int64) error {
+	for _, area := range self.written.Find(offset, int64(len(data)), RESCUE_FINISHED) {
+		start := area.Position - offset
+
+		if _, err := self.delta.ReadAt(data[start:(start+area.Size)], area.Position); err != nil {
+			return WrapError(err)
+		}
+	}
+
+	return nil
+}
+
+func (self *OverlaySource) ReadAt(data []byte, offset int64) (int, error) {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	res, err := self.source.ReadAt(data, offset)
+	if (err != nil) && (!IsEof(err)) {
+		return res, err
+	}
+
+	if delta_err := self.read_delta(data[:res], offset); delta_err != nil {
+		return res, delta_err
+	}
+
+	return res, err
+}
+
+func (self *OverlaySource) WriteAt(data []byte, offset int64) (int, error) {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	size := int64(len(data))
+	if (offset < 0) || ((offset + size) > self.source.Size()) {
+		return 0, WrapError(fmt.Errorf("Write of %d bytes at %d outside of the source", size, offset))
+	}
+
+	res, err := self.delta.WriteAt(data, offset)
+	if err != nil {
+		return res, WrapError(err)
+	}
+
+	self.written.Mark(offset, size, RESCUE_FINISHED)
+
+	return res, self.written.Save()
+}
+
+func (self *OverlaySource) Size() int64 {
+	return self.source.Size()
+}
+
+func (self *OverlaySource) SectorSize() int64 {
+	return self.source.SectorSize()
+}
+
+func (self *OverlaySource) Inner() BlockSource {
+	return self.source
+}
+
+// The map is saved on each write, so an overlay opened twice does not lose the writes of the other one.
+func (self *OverlaySource) Close() error {
+	err := WrapError(self.delta.Close())
+	if close_err := self.source.Close(); err == nil {
+		err = close_err
+	}
+
+	return err
+}
+
+func (self *OverlaySource) GetMap() *RescueMap {
+	return self.written
+}
+
+func (self *OverlaySource) GetDeltaPath() string {
+	return self.delta.Name()
+}
+
+// Areas written in the overlay, with their offsets in the source.
+func (self *OverlaySource) GetWritten() []RescueRange {
+	return self.written.Find(0, self.source.Size(), RESCUE_FINISHED)
+}
+
+// Compares the written areas with the source, only the bytes which really differ are returned.
+func (self *OverlaySource) Diff() ([]*OverlayChange, error) {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	res := make([]*OverlayChange, 0)
+
+	var current *OverlayChange
+
+	for _, area := range self.written.Find(0, self.source.Size(), RESCUE_FINISHED) {
+		for pos := area.Position; pos < area.GetEnd(); {
+			size := int64(DEFAULT_IMAGE_BLOCK_SIZE)
+			if remain := area.GetEnd() - pos; size > remain {
+				size = remain
+			}
+
+			source := make([]byte, size)
+			if _, err := self.source.ReadAt(source, pos); (err != nil) && (!IsEof(err)) {
+				return nil, err
+			}
+
+			overlay := make([]byte, size)
+			if _, err := self.delta.ReadAt(overlay, pos); err != nil {
+				return nil, WrapError(err)
+			}
+
+			if !bytes.Equal(source, overlay) {
+				for i := int64(0); i < size; i++ {
+					if source[i] == overlay[i] {
+						continue
+					}
+
+					at := pos + i
+					if (current == nil) || ((current.Position + int64(len(current.Overlay))) != at) {
+						current = &OverlayChange{Position: at}
+						res = append(res, current)
+					}
+
+					current.Source = append(current.Source, source[i])
+					current.Overlay = append(current.Overlay, overlay[i])
+				}
+			}
+
+			pos += size
+		}
+	}
+
+	return res, nil
+}
+
+// Writes the whole source, patched with the overlay, into an image file, the zero blocks are left as holes.
+func (self *OverlaySource) Export(dest string) error {
+	file, err := os.OpenFile(dest, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0664)
+	if err != nil {
+		return WrapError(err)
+	}
+
+	defer DeferedCall(file.Close)
+
+	size := self.Size()
+	if err := file.Truncate(size); err != nil {
+		return WrapError(err)
+	}
+
+	buffer := make([]byte, DEFAULT_IMAGE_BLOCK_SIZE)
+
+	for pos := int64(0); pos < size; {
+		block := buffer
+		if remain := size - pos; int64(len(block)) > remain {
+			block = block[:remain]
+		}
+
+		n, err := self.ReadAt(block, pos)
+		if (err != nil) && !(IsEof(err) && (n == len(block))) {
+			return err
+		}
+
+		if !IsZeroBlock(block) {
+			if _, err := file.WriteAt(block, pos); err != nil {
+				return WrapError(err)
+			}
+		}
+
+		pos += int64(len(block))
+
+		progress := pos * 10000 / size
+		fmt.Printf("\r%d.%02d%%", progress/100, progress%100)
+	}
+
+	fmt.Println()
+
+	return WrapError(file.Sync())
+}
+
+// Opens the overlay with the delta file `path` and the map file `path.map`, they are created if needed.
+func OverlayTransform(path string) SourceTransform {
+	return func(source BlockSource) (BlockSource, error) {
+		written, err := LoadRescueMap(path + ".map")
+		if err != nil {
+			return nil, err
+		}
+
+		size := source.Size()
+		if (written.GetSize() != 0) && (written.GetSize() != size) {
+			const msg = "The overlay %s is for a source of %d bytes, not %d"
+
+			return nil, WrapError(fmt.Errorf(msg, path, written.GetSize(), size))
+		}
+
+		written.SetSize(size)
+
+		delta, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0664)
+		if err != nil {
+			return nil, WrapError(err)
+		}
+
+		if err := delta.Truncate(size); err != nil {
+			delta.Close()
+
+			return nil, WrapError(err)
+		}
+
+		res := &OverlaySource{
+			source:  source,
+			delta:   delta,
+			written: written,
+		}
+
+		return res, nil
+	}
+}
+
+func FindOverlay(source BlockSource) *OverlaySource {
+	res, _ := find_source(source, func(source BlockSource) bool {
+		_, ok := source.(*OverlaySource)
+
+		return ok
+	}).(*OverlaySource)
+
+	return res
+}
@@ -0,0 +1,452 @@
+package core
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"strings"
+	"unicode/utf16"
+
+	"github.com/pborman/uuid"
+)
+
+const (
+	PART_SCHEME_MBR = "MBR"
+	PART_SCHEME_GPT = "GPT"
+
+	_MBR_PROTECTIVE byte = 0xEE
+
+	_GPT_MAX_ENTRY_COUNT = 1024
+	_GPT_MAX_ENTRY_SIZE  = 4096
+)
+
+var (
+	gpt_signature = []byte("EFI PART")
+
+	mbr_types = map[byte]string{
+		0x01: "FAT12",
+		0x04: "FAT16 <32M",
+		0x05: "Extended",
+		0x06: "FAT16",
+		0x07: "NTFS/exFAT",
+		0x0B: "FAT32",
+		0x0C: "FAT32 (LBA)",
+		0x0E: "FAT16 (LBA)",
+		0x0F: "Extended (LBA)",
+		0x11: "Hidden FAT12",
+		0x17: "Hidden NTFS",
+		0x27: "Windows recovery",
+		0x42: "Windows dynamic",
+		0x82: "Linux swap",
+		0x83: "Linux",
+		0x85: "Linux extended",
+		0x8E: "Linux LVM",
+		0xA5: "FreeBSD",
+		0xAF: "HFS+",
+		0xEE: "GPT protective",
+		0xEF: "EFI system",
+		0xFD: "Linux RAID",
+	}
+
+	gpt_types = map[string]string{
+		"c12a7328-f81f-11d2-ba4b-00a0c93ec93b": "EFI system",
+		"e3c9e316-0b5c-4db8-817d-f92df00215ae": "Microsoft reserved",
+		"ebd0a0a2-b9e5-4433-87c0-68b6b72699c7": "Microsoft basic data",
+		"de94bba4-06d1-4d40-a16a-bfd50179d6ac": "Windows recovery",
+		"5808c8aa-7e8f-42e0-85d2-e1e90434cfb3": "LDM metadata",
+		"af9b60a0-1431-4f62-bc68-3311714a69ad": "LDM data",
+		"0fc63daf-8483-4772-8e79-3d69d8477de4": "Linux filesystem",
+		"0657fd6d-a4ab-43c4-84e5-0933c84b4f4f": "Linux swap",
+		"e6d6d379-f507-44c2-a23c-238f2a3df928": "Linux LVM",
+		"48465300-0000-11aa-aa11-00306543ecac": "HFS+",
+	}
+)
+
+type tMbrEntry struct {
+	Status   uint8
+	FirstChs [3]byte
+	Type     uint8
+	LastChs  [3]byte
+	FirstLba uint32
+	CountLba uint32
+}
+
+type tMbr struct {
+	Code      [446]byte
+	Entries   [4]tMbrEntry
+	Signature uint16
+}
+
+type tGptHeader struct {
+	Signature      [8]byte
+	Revision       uint32
+	HeaderSize     uint32
+	HeaderCrc      uint32
+	Reserved       uint32
+	CurrentLba     uint64
+	BackupLba      uint64
+	FirstUsableLba uint64
+	LastUsableLba  uint64
+	DiskGuid       [16]byte
+	EntriesLba     uint64
+	EntryCount     uint32
+	EntrySize      uint32
+	EntriesCrc     uint32
+}
+
+type tGptEntry struct {
+	TypeGuid   [16]byte
+	UniqueGuid [16]byte
+	FirstLba   uint64
+	LastLba    uint64
+	Attributes uint64
+	Name       [36]uint16
+}
+
+type Partition struct {
+	Number     int
+	Scheme     string
+	Type       string
+	Name       string
+	Start      int64
+	Size       int64
+	Filesystem string
+
+	// The primary GPT header is damaged, the partition is read from the backup header
+	Backup bool
+}
+
+func (self *Partition) String() string {
+	const msg = "{#%d %s [%s] at %d, size %d, fs=%s}"
+
+	return fmt.Sprintf(msg, self.Number, self.Scheme, self.Type, self.Start, self.Size, self.Filesystem)
+}
+
+func is_extended_partition(ptype byte) bool {
+	return (ptype == 0x05) || (ptype == 0x0F) || (ptype == 0x85)
+}
+
+// GUIDs are stored with their 3 first fields in little endian.
+func decode_guid(guid [16]byte) string {
+	res := make([]byte, 16)
+	copy(res, guid[:])
+
+	res[0], res[1], res[2], res[3] = res[3], res[2], res[1], res[0]
+	res[4], res[5] = res[5], res[4]
+	res[6], res[7] = res[7], res[6]
+
+	return uuid.UUID(res).String()
+}
+
+func detect_filesystem(disk *DiskIO, start int64) string {
+	buffer := make([]byte, 2048)
+	if _, err := disk.ReadAt(buffer, start); (err != nil) && (!IsEof(err)) {
+		return ""
+	}
+
+	switch {
+	case bytes.Equal(buffer[3:11], []byte("NTFS    ")):
+		return "NTFS"
+
+	case bytes.Equal(buffer[3:11], []byte("EXFAT   ")):
+		return "exFAT"
+
+	case bytes.Equal(buffer[82:87], []byte("FAT32")):
+		return "FAT32"
+
+	case bytes.Equal(buffer[54:59], []byte("FAT16")), bytes.Equal(buffer[54:59], []byte("FAT12")):
+		return string(buffer[54:59])
+
+	case bytes.Equal(buffer[0:4], []byte("XFSB")):
+		return "XFS"
+
+	case binary.LittleEndian.Uint16(buffer[1080:]) == 0xEF53:
+		return "ext2/3/4"
+
+	case bytes.Equal(buffer[1024:1026], []byte("H+")), bytes.Equal(buffer[1024:1026], []byte("HX")):
+		return "HFS+"
+
+	case bytes.Equal(buffer[0:4], []byte("LUKS")):
+		return "LUKS"
+
+	case bytes.Equal(buffer[0:4], []byte{0x33, 0xC0, 0x8E, 0xD0}), binary.LittleEndian.Uint16(buffer[510:]) == 0xAA55:
+		return "Unknown (boot sector)"
+	}
+
+	return ""
+}
+
+func read_gpt_header(disk *DiskIO, position, sector_size int64) (*tGptHeader, []tGptEntry, error) {
+	var header tGptHeader
+
+	block := make([]byte, sector_size)
+	if _, err := disk.ReadAt(block, position*sector_size); err != nil {
+		return nil, nil, err
+	}
+
+	if err := Read(block, &header); err != nil {
+		return nil, nil, err
+	}
+
+	if !bytes.Equal(header.Signature[:], gpt_signature) {
+		return nil, nil, nil
+	}
+
+	if (header.HeaderSize < uint32(StructSize(&header))) || (int64(header.HeaderSize) > sector_size) {
+		return nil, nil, nil
+	}
+
+	checked := make([]byte, header.HeaderSize)
+	copy(checked, block)
+	copy(checked[16:20], []byte{0, 0, 0, 0})
+
+	if crc32.ChecksumIEEE(checked) != header.HeaderCrc {
+		return nil, nil, nil
+	}
+
+	if (header.EntrySize < uint32(StructSize(new(tGptEntry)))) || (header.EntrySize > _GPT_MAX_ENTRY_SIZE) {
+		return nil, nil, nil
+	}
+
+	if header.EntryCount > _GPT_MAX_ENTRY_COUNT {
+		return nil, nil, nil
+	}
+
+	data := make([]byte, int64(header.EntryCount)*int64(header.EntrySize))
+	if _, err := disk.ReadAt(data, int64(header.EntriesLba)*sector_size); err != nil {
+		return nil, nil, err
+	}
+
+	if crc32.ChecksumIEEE(data) != header.EntriesCrc {
+		return nil, nil, nil
+	}
+
+	entries := make([]tGptEntry, header.EntryCount)
+	for i := range entries {
+		if err := Read(data[(uint32(i)*header.EntrySize):], &entries[i]); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	return &header, entries, nil
+}
+
+func read_gpt(disk *DiskIO) ([]*Partition, error) {
+	for _, sector_size := range []int64{512, 4096} {
+		header, entries, err := read_gpt_header(disk, 1, sector_size)
+		if err != nil {
+			return nil, err
+		}
+
+		// When the primary header is damaged, the backup header is at the end of the disk
+		backup := header == nil
+		if backup {
+			last := (disk.GetSize() / sector_size) - 1
+			if last <= 1 {
+				continue
+			}
+
+			header, entries, err = read_gpt_header(disk, last, sector_size)
+			if err != nil {
+				return nil, err
+			}
+
+			if header == nil {
+				continue
+			}
+		}
+
+		res := make([]*Partition, 0)
+
+		for i, entry := range entries {
+			if entry.TypeGuid == [16]byte{} {
+				continue
+			}
+
+			type_guid := decode_guid(entry.TypeGuid)
+			type_name, ok := gpt_types[type_guid]
+			if !ok {
+				type_name = type_guid
+			}
+
+			start := int64(entry.FirstLba) * sector_size
+			name := string(utf16.Decode(entry.Name[:]))
+
+			res = append(res, &Partition{
+				Number:     i + 1,
+				Scheme:     PART_SCHEME_GPT,
+				Type:       type_name,
+				Name:       strings.TrimRight(name, "\x00"),
+				Start:      start,
+				Size:       int64(entry.LastLba-entry.FirstLba+1) * sector_size,
+				Filesystem: detect_filesystem(disk, start),
+				Backup:     backup,
+			})
+		}
+
+		return res, nil
+	}
+
+	return nil, nil
+}
+
+// Size of the LBAs of the MBR and of the EBRs, the sector size of the source (4096 bytes on a 4Kn disk).
+func get_lba_size(disk *DiskIO) int64 {
+	if res := disk.GetSource().SectorSize(); res > 0 {
+		return res
+	}
+
+	return DEFAULT_SECTOR_SIZE
+}
+
+func make_mbr_partition(disk *DiskIO, number int, entry *tMbrEntry, base, lba_size int64) *Partition {
+	type_name, ok := mbr_types[entry.Type]
+	if !ok {
+		type_name = fmt.Sprintf("0x%02X", entry.Type)
+	}
+
+	start := (base + int64(entry.FirstLba)) * lba_size
+
+	return &Partition{
+		Number:     number,
+		Scheme:     PART_SCHEME_MBR,
+		Type:       type_name,
+		Start:      start,
+		Size:       int64(entry.CountLba) * lba_size,
+		Filesystem: detect_filesystem(disk, start),
+	}
+}
+
+func read_mbr(disk *DiskIO, sector, lba_size int64) (*tMbr, error) {
+	mbr := new(tMbr)
+
+	if err := disk.ReadStructAt(sector*lba_size, mbr); err != nil {
+		return nil, err
+	}
+
+	if mbr.Signature != 0xAA55 {
+		return nil, nil
+	}
+
+	return mbr, nil
+}
+
+func ReadPartitions(disk *DiskIO) ([]*Partition, error) {
+	switch detect_filesystem(disk, 0) {
+	case "NTFS", "exFAT":
+		return nil, nil
+	}
+
+	lba_size := get_lba_size(disk)
+
+	mbr, err := read_mbr(disk, 0, lba_size)
+	if (err != nil) || (mbr == nil) {
+		return nil, err
+	}
+
+	for _, entry := range mbr.Entries {
+		if entry.Type == _MBR_PROTECTIVE {
+			res, err := read_gpt(disk)
+			if (err != nil) || (res != nil) {
+				return res, err
+			}
+
+			break
+		}
+	}
+
+	res := make([]*Partition, 0)
+
+	for i, entry := range mbr.Entries {
+		// A NTFS boot sector also ends with the 0xAA55 signature, so entries must be consistent
+		if (entry.Type == 0) || (entry.CountLba == 0) || ((entry.Status != 0) && (entry.Status != 0x80)) {
+			continue
+		}
+
+		res = append(res, make_mbr_partition(disk, i+1, &entry, 0, lba_size))
+
+		if !is_extended_partition(entry.Type) {
+			continue
+		}
+
+		// Logical partitions are chained with EBRs, their numbers start at 5
+		number := 5
+		extended := int64(entry.FirstLba)
+		visited := make(map[int64]bool)
+
+		for ebr_sector := extended; !visited[ebr_sector]; {
+			visited[ebr_sector] = true
+
+			ebr, err := read_mbr(disk, ebr_sector, lba_size)
+			if err != nil {
+				return nil, err
+			}
+
+			if ebr == nil {
+				break
+			}
+
+			logical := &ebr.Entries[0]
+			if (logical.Type != 0) && (logical.CountLba != 0) {
+				res = append(res, make_mbr_partition(disk, number, logical, ebr_sector, lba_size))
+				number++
+			}
+
+			next := &ebr.Entries[1]
+			if (next.Type == 0) || (!is_extended_partition(next.Type)) {
+				break
+			}
+
+			ebr_sector = extended + int64(next.FirstLba)
+		}
+	}
+
+	if len(res) == 0 {
+		return nil, nil
+	}
+
+	return res, nil
+}
+
+func FindPartition(disk *DiskIO, number int) (*Partition, error) {
+	partitions, err := ReadPartitions(disk)
+	if err != nil {
+		return nil, err
+	}
+
+	if partitions == nil {
+		return nil, WrapError(errors.New("No partition table found"))
+	}
+
+	for _, partition := range partitions {
+		if partition.Number == number {
+			return partition, nil
+		}
+	}
+
+	return nil, WrapError(fmt.Errorf("Partition %d not found", number))
+}
+
+func PrintPartitions(partitions []*Partition) {
+	if len(partitions) == 0 {
+		fmt.Println("No partition found")
+
+		return
+	}
+
+	if partitions[0].Backup {
+		fmt.Println("Warning: primary GPT header is damaged, the backup header is used")
+	}
+
+	fmt.Println(fmt.Sprintf("Partitions (%s):", partitions[0].Scheme))
+	for _, partition := range partitions {
+		fmt.Printf("  %3d. %-22s offset=%-14d size=%-14d fs=%s", partition.Number, partition.Type, partition.Start, partition.Size, partition.Filesystem)
+		if partition.Name != "" {
+			fmt.Printf(" name=%s", partition.Name)
+		}
+
+		fmt.Println()
+	}
+}
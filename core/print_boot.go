@@ -2,9 +2,7 @@ package core
 
 import (
 	"bytes"
-	"encoding/binary"
 	"fmt"
-	"os"
 )
 
 type BootFormat [8]byte
@@ -49,20 +47,107 @@ type BootBlock struct {
 	BootSignature         uint16
 }
 
+const BOOT_SIGNATURE uint16 = 0xAA55
+
+var ntfs_format = BootFormat{'N', 'T', 'F', 'S', ' ', ' ', ' ', ' '}
+
+func (self *BootBlock) IsValid() bool {
+	if (self.Format != ntfs_format) || (self.BootSignature != BOOT_SIGNATURE) || (self.TotalSectors == 0) {
+		return false
+	}
+
+	geometry, err := self.GetGeometry()
+	if err != nil {
+		return false
+	}
+
+	clusters := int64(self.TotalSectors) * geometry.SectorSize / geometry.ClusterSize
+
+	return (int64(self.MftStartLcn) < clusters) && (int64(self.Mft2StartLcn) < clusters)
+}
+
+// Reads the boot sector, the backup in the last sector of the volume is used when the primary one is invalid.
+// The returned position is the one of the boot sector used, the primary one is returned when both are invalid.
+func FindBootBlock(disk *DiskIO) (*BootBlock, int64, error) {
+	res := new(BootBlock)
+
+	if err := disk.ReadStructAt(0, res); err != nil {
+		return nil, 0, err
+	}
+
+	if res.IsValid() {
+		return res, 0, nil
+	}
+
+	size := disk.GetSize()
+	for _, sector_size := range []int64{DEFAULT_SECTOR_SIZE, 4096} {
+		position := ((size / sector_size) - 1) * sector_size
+		if position <= 0 {
+			continue
+		}
+
+		backup := new(BootBlock)
+		if err := disk.ReadStructAt(position, backup); err != nil {
+			continue
+		}
+
+		if backup.IsValid() && (int64(backup.BytesPerSector) == sector_size) {
+			return backup, position, nil
+		}
+	}
+
+	return res, 0, nil
+}
+
+func ReadBootBlock(disk *DiskIO) (*BootBlock, error) {
+	res, _, err := FindBootBlock(disk)
+
+	return res, err
+}
+
 func PrintBoot(disk_name string) {
-	f, err := os.Open(disk_name)
+	disk, err := OpenDisk(disk_name)
 	if err != nil {
 		Abort(err)
 	}
 
-	defer DeferedCall(f.Close)
+	defer DeferedCall(disk.Close)
 
-	res := new(BootBlock)
+	partitions, err := ReadPartitions(disk)
+	if err != nil {
+		Abort(err)
+	}
+
+	if partitions != nil {
+		PrintPartitions(partitions)
+
+		return
+	}
 
-	err = binary.Read(f, binary.LittleEndian, res)
+	res, position, err := FindBootBlock(disk)
 	if err != nil {
 		Abort(err)
 	}
 
 	PrintStruct(res)
+
+	switch {
+	case !res.IsValid():
+		fmt.Println("Boot sector: invalid, the primary and the backup boot sectors are both damaged")
+
+	case position != 0:
+		fmt.Println(fmt.Sprintf("Boot sector: backup at offset %d (the primary boot sector is invalid)", position))
+
+	default:
+		fmt.Println("Boot sector: primary")
+	}
+
+	geometry, err := res.GetGeometry()
+	if err != nil {
+		fmt.Println("Geometry:", err)
+
+		return
+	}
+
+	fmt.Println("Geometry:", geometry)
 }
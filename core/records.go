@@ -19,6 +19,25 @@ const (
 	RECTYP_CHKD RecordType = 0x444B4843 // 'CHKD'
 )
 
+// Indexes of the metafiles in the MFT.
+const (
+	FILEIDX_MFT     int64 = 0
+	FILEIDX_MFTMIRR int64 = 1
+	FILEIDX_LOGFILE int64 = 2
+	FILEIDX_VOLUME  int64 = 3
+	FILEIDX_ATTRDEF int64 = 4
+	FILEIDX_ROOT    int64 = 5
+	FILEIDX_BITMAP  int64 = 6
+	FILEIDX_BOOT    int64 = 7
+	FILEIDX_BADCLUS int64 = 8
+	FILEIDX_SECURE  int64 = 9
+	FILEIDX_UPCASE  int64 = 10
+	FILEIDX_EXTEND  int64 = 11
+
+	// First record which is not reserved for the metafiles, the reserved records are in the first extent of $MFT
+	FILEIDX_FIRST_USER int64 = 16
+)
+
 func (self RecordType) IsGood() bool {
 	return record_types[self]
 }
@@ -115,7 +134,7 @@ type RecordHeader struct {
 	Usn       Usn
 }
 
-type FileRecord struct {
+type FileRecordHeader struct {
 	RecordHeader
 
 	SequenceNumber      uint16
@@ -128,7 +147,12 @@ type FileRecord struct {
 	NextAttributeNumber uint16
 	Reserved            uint16
 	MftRecordNumber     uint32
-	Data                FileRecordData
+}
+
+type FileRecord struct {
+	FileRecordHeader
+
+	Data FileRecordData
 }
 
 func (self *FileRecord) IsDir() bool {
@@ -136,7 +160,28 @@ func (self *FileRecord) IsDir() bool {
 }
 
 func (self *FileRecord) PrefixSize() int {
-	return StructSize(self) - len(self.Data)
+	return StructSize(&self.FileRecordHeader)
+}
+
+// Decodes the whole record read by DiskIO.ReadRecordAt, the data have the size of the record.
+func (self *FileRecord) decode_record(buffer []byte) error {
+	if err := Read(buffer, &self.FileRecordHeader); err != nil {
+		return err
+	}
+
+	prefix_size := self.PrefixSize()
+
+	size := len(buffer)
+	if size < int(DEFAULT_RECORD_SIZE) {
+		size = int(DEFAULT_RECORD_SIZE)
+	}
+
+	self.Data = make(FileRecordData, size-prefix_size)
+	if len(buffer) > prefix_size {
+		copy(self.Data, buffer[prefix_size:])
+	}
+
+	return nil
 }
 
 func (self *FileRecord) FileRef() data.FileRef {
@@ -185,8 +230,14 @@ func (self *FileRecord) make_attribute(offset int, header *AttributeHeader) (*At
 func (self *FileRecord) MakeAttributeFromHeader(header *AttributeHeader) (*AttributeDesc, error) {
 	offset := int(self.AttributesOffset) - self.PrefixSize()
 
+	// The given header can have only the type and the number (ie: from an attribute list),
+	// the attribute is decoded with its header in the record
+	var attr AttributeHeader
+
 	for {
-		var attr AttributeHeader
+		if (0 > offset) || (offset >= len(self.Data)) {
+			return nil, WrapError(fmt.Errorf("Attribute doesn't exists (type= %08x)", uint32(header.AttributeType)))
+		}
 
 		if err := Read(self.Data[offset:], &attr); err != nil {
 			return nil, err
@@ -200,10 +251,14 @@ func (self *FileRecord) MakeAttributeFromHeader(header *AttributeHeader) (*Attri
 			break
 		}
 
+		if attr.Length == 0 {
+			return nil, WrapError(fmt.Errorf("Attribute with a null length at %d", offset))
+		}
+
 		offset += int(attr.Length)
 	}
 
-	return self.make_attribute(offset, header)
+	return self.make_attribute(offset, &attr)
 }
 
 func (self *FileRecord) MakeAttributeFromOffset(offset int) (*AttributeDesc, error) {
@@ -221,24 +276,37 @@ func (self *FileRecord) MakeAttributeFromOffset(offset int) (*AttributeDesc, err
 }
 
 func (self *FileRecord) GetAttributes(filter bool) (map[int]*AttributeHeader, error) {
+	attributes, _, err := self.get_attributes(filter, nil)
+
+	return attributes, err
+}
+
+// Attributes filtered with the definitions of the volume, the attributes which do not follow them are returned apart,
+// with their error.
+func (self *FileRecord) GetCheckedAttributes(defs AttrDefs) (map[int]*AttributeHeader, map[int]error, error) {
+	return self.get_attributes(true, defs)
+}
+
+func (self *FileRecord) get_attributes(filter bool, defs AttrDefs) (map[int]*AttributeHeader, map[int]error, error) {
 	attributes := make(map[int]*AttributeHeader)
+	rejected := make(map[int]error)
 
 	idx := int(self.AttributesOffset) - self.PrefixSize()
 	for {
 		attr := new(AttributeHeader)
 
-		if (0 > idx) || (idx >= 1024) {
-			return nil, nil
+		if (0 > idx) || (idx >= len(self.Data)) {
+			return nil, nil, nil
 		}
 
 		err := Read(self.Data[idx:], attr)
 		if err != nil {
 			if GetSource(err) == io.ErrUnexpectedEOF {
 				if err := Read(self.Data[idx:], &attr.AttributeType); err != nil {
-					return nil, err
+					return nil, nil, err
 				}
 			} else {
-				return nil, err
+				return nil, nil, err
 			}
 		}
 
@@ -247,19 +315,41 @@ func (self *FileRecord) GetAttributes(filter bool) (map[int]*AttributeHeader, er
 		}
 
 		if err != nil {
-			return nil, err
+			return nil, nil, err
 		}
 
-		if filter && ((!attr.AttributeType.IsGood()) || (attr.NameOffset >= 1024)) {
-			return nil, nil
+		// The custom types are the ones defined by the volume
+		is_good := attr.AttributeType.IsGood() || (defs.Get(attr.AttributeType) != nil)
+		if filter && ((!is_good) || ((idx + int(attr.NameOffset)) >= len(self.Data))) {
+			return nil, nil, nil
 		}
 
-		attributes[idx] = attr
+		// A null length is found in the zero-filled sectors of a torn record
+		if attr.Length == 0 {
+			break
+		}
 
+		pos := idx
 		idx += int(attr.Length)
+
+		// With the definitions of the volume, the attributes which do not follow them are rejected
+		if filter && (defs != nil) {
+			desc, err := self.make_attribute(pos, attr)
+			if err == nil {
+				err = defs.CheckAttribute(desc)
+			}
+
+			if err != nil {
+				rejected[pos] = err
+
+				continue
+			}
+		}
+
+		attributes[pos] = attr
 	}
 
-	return attributes, nil
+	return attributes, rejected, nil
 }
 
 func (self *FileRecord) GetAttributeFilteredList(attr_type AttributeType, other_types ...AttributeType) []int {
@@ -269,11 +359,13 @@ func (self *FileRecord) GetAttributeFilteredList(attr_type AttributeType, other_
 	var res []int
 
 	idx := int(self.AttributesOffset) - self.PrefixSize()
-	for {
-		Read(self.Data[idx:], &attr)
+	for (0 <= idx) && (idx < len(self.Data)) {
+		if err := Read(self.Data[idx:], &attr); err != nil {
+			break
+		}
 
 		t := attr.AttributeType
-		if t == ATTR_END_OF_ATTRIBUTES {
+		if (t == ATTR_END_OF_ATTRIBUTES) || (attr.Length == 0) {
 			break
 		}
 
@@ -304,6 +396,10 @@ attr_loop:
 			return "", err
 		}
 
+		if attr.Length == 0 {
+			break
+		}
+
 		pos := idx
 		idx += int(attr.Length)
 
@@ -0,0 +1,180 @@
+package core
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strings"
+	"unicode/utf16"
+)
+
+type ReparseTag uint32
+
+const (
+	IO_REPARSE_TAG_MOUNT_POINT ReparseTag = 0xA0000003
+	IO_REPARSE_TAG_SYMLINK     ReparseTag = 0xA000000C
+	IO_REPARSE_TAG_DEDUP       ReparseTag = 0x80000013
+	IO_REPARSE_TAG_WOF         ReparseTag = 0x80000017
+	IO_REPARSE_TAG_APPEXECLINK ReparseTag = 0x8000001B
+)
+
+// Flag of the symbolic links whose target is relative to the directory of the link.
+const SYMLINK_FLAG_RELATIVE = 0x00000001
+
+var reparse_tags = map[ReparseTag]string{
+	IO_REPARSE_TAG_MOUNT_POINT: "MOUNT_POINT",
+	IO_REPARSE_TAG_SYMLINK:     "SYMLINK",
+	IO_REPARSE_TAG_DEDUP:       "DEDUP",
+	IO_REPARSE_TAG_WOF:         "WOF",
+	IO_REPARSE_TAG_APPEXECLINK: "APPEXECLINK",
+}
+
+func (self ReparseTag) String() string {
+	res, ok := reparse_tags[self]
+	if !ok {
+		return fmt.Sprintf("UNKNOWN: %08X", uint32(self))
+	}
+
+	return res
+}
+
+// The tags of Microsoft have the bit 31 set.
+func (self ReparseTag) IsMicrosoft() bool {
+	return (self & 0x80000000) != 0
+}
+
+// Decoded $REPARSE_POINT attribute, the names are only set for the links.
+type ReparsePoint struct {
+	Tag            ReparseTag
+	SubstituteName string
+	PrintName      string
+	Relative       bool
+	Data           []byte
+}
+
+// True for the symbolic links, the junctions (mount points) and the application execution aliases.
+func (self *ReparsePoint) IsLink() bool {
+	switch self.Tag {
+	case IO_REPARSE_TAG_MOUNT_POINT, IO_REPARSE_TAG_SYMLINK, IO_REPARSE_TAG_APPEXECLINK:
+		return true
+	}
+
+	return false
+}
+
+// Target of a link as shown by Windows, the print name if it's set, or else the substitute name without its NT prefix.
+// The target of an application execution alias is its executable, its print name is the application ID.
+func (self *ReparsePoint) GetTarget() string {
+	if (len(self.PrintName) > 0) && (self.Tag != IO_REPARSE_TAG_APPEXECLINK) {
+		return self.PrintName
+	}
+
+	return strings.TrimPrefix(self.SubstituteName, `\??\`)
+}
+
+func (self *ReparsePoint) String() string {
+	if !self.IsLink() {
+		return fmt.Sprintf("%s (%d bytes)", self.Tag, len(self.Data))
+	}
+
+	relative := ""
+	if self.Relative {
+		relative = " (relative)"
+	}
+
+	return fmt.Sprintf("%s -> %s%s", self.Tag, self.GetTarget(), relative)
+}
+
+func decode_reparse_name(buffer []byte, offset, length uint16) (string, error) {
+	start, end := int(offset), int(offset)+int(length)
+	if end > len(buffer) {
+		return "", WrapError(fmt.Errorf("Reparse point name outside of the data (%d > %d)", end, len(buffer)))
+	}
+
+	return DecodeString(buffer[start:end], int(length)/2), nil
+}
+
+// Splits the null-terminated UTF-16 strings of an application execution alias.
+func decode_reparse_strings(buffer []byte) []string {
+	res := make([]string, 0)
+	str := make([]uint16, 0)
+
+	for i := 0; (i + 1) < len(buffer); i += 2 {
+		c := binary.LittleEndian.Uint16(buffer[i:])
+		if c == 0 {
+			res = append(res, string(utf16.Decode(str)))
+			str = str[:0]
+
+			continue
+		}
+
+		str = append(str, c)
+	}
+
+	return res
+}
+
+// Decodes the content of a $REPARSE_POINT attribute.
+func ParseReparsePoint(content []byte) (*ReparsePoint, error) {
+	const header_size = 8
+
+	if len(content) < header_size {
+		return nil, WrapError(fmt.Errorf("Reparse point too short (%d bytes)", len(content)))
+	}
+
+	size := header_size + int(binary.LittleEndian.Uint16(content[4:]))
+	if size > len(content) {
+		size = len(content)
+	}
+
+	res := &ReparsePoint{
+		Tag:  ReparseTag(binary.LittleEndian.Uint32(content)),
+		Data: content[header_size:size],
+	}
+
+	data := res.Data
+
+	switch res.Tag {
+	case IO_REPARSE_TAG_MOUNT_POINT, IO_REPARSE_TAG_SYMLINK:
+		path_offset := 8
+		if res.Tag == IO_REPARSE_TAG_SYMLINK {
+			path_offset = 12
+		}
+
+		if len(data) < path_offset {
+			return nil, WrapError(fmt.Errorf("Reparse point %s too short (%d bytes)", res.Tag, len(data)))
+		}
+
+		if res.Tag == IO_REPARSE_TAG_SYMLINK {
+			res.Relative = (binary.LittleEndian.Uint32(data[8:]) & SYMLINK_FLAG_RELATIVE) != 0
+		}
+
+		buffer := data[path_offset:]
+		substitute_offset, substitute_length := binary.LittleEndian.Uint16(data), binary.LittleEndian.Uint16(data[2:])
+		print_offset, print_length := binary.LittleEndian.Uint16(data[4:]), binary.LittleEndian.Uint16(data[6:])
+
+		var err error
+
+		if res.SubstituteName, err = decode_reparse_name(buffer, substitute_offset, substitute_length); err != nil {
+			return nil, err
+		}
+
+		if res.PrintName, err = decode_reparse_name(buffer, print_offset, print_length); err != nil {
+			return nil, err
+		}
+
+	case IO_REPARSE_TAG_APPEXECLINK:
+		// Version, then the package ID, the application user model ID and the target executable
+		if len(data) < 4 {
+			return nil, WrapError(fmt.Errorf("Reparse point %s too short (%d bytes)", res.Tag, len(data)))
+		}
+
+		strs := decode_reparse_strings(data[4:])
+		if len(strs) < 3 {
+			return nil, WrapError(fmt.Errorf("Reparse point %s with %d strings instead of 3", res.Tag, len(strs)))
+		}
+
+		res.SubstituteName, res.PrintName = strs[2], strs[1]
+	}
+
+	return res, nil
+}
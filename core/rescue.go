@@ -0,0 +1,166 @@
+package core
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	DEFAULT_RETRIES = 3
+
+	_RESCUE_SAVE_DELAY = 5 * time.Second
+)
+
+// Handler called for each zero-filled sector, with its position and its size.
+type BadSectorHandler func(position, size int64)
+
+// Source which never fails on bad sectors: they are retried, then zero-filled and recorded in the rescue map.
+type RescueSource struct {
+	source    BlockSource
+	rescue    *RescueMap
+	retries   int
+	filled    int64
+	on_bad    BadSectorHandler
+	last_save time.Time
+	mutex     sync.Mutex
+}
+
+func (self *RescueSource) read(data []byte, offset int64) (int, error) {
+	var res int
+	var err error
+
+	for try := 0; try <= self.retries; try++ {
+		res, err = self.source.ReadAt(data, offset)
+		if (err == nil) || IsEof(err) {
+			break
+		}
+	}
+
+	return res, err
+}
+
+func (self *RescueSource) read_sectors(data []byte, offset int64) (int, error) {
+	sector_size := self.source.SectorSize()
+	res, bad := 0, 0
+
+	for res < len(data) {
+		pos := offset + int64(res)
+
+		buffer := data[res:]
+		if remain := sector_size - (pos % sector_size); int64(len(buffer)) > remain {
+			buffer = buffer[:remain]
+		}
+
+		if self.rescue.Contains(pos, int64(len(buffer)), RESCUE_BAD) {
+			ClearBuffer(buffer)
+			res += len(buffer)
+
+			continue
+		}
+
+		n, err := self.read(buffer, pos)
+		if err != nil {
+			if IsEof(err) {
+				return res + n, err
+			}
+
+			ClearBuffer(buffer)
+			self.rescue.Mark(pos, int64(len(buffer)), RESCUE_BAD)
+			self.filled += int64(len(buffer))
+			bad++
+
+			if self.on_bad != nil {
+				self.on_bad(pos, int64(len(buffer)))
+			}
+		}
+
+		res += len(buffer)
+	}
+
+	// The map is saved at most once per delay, it's saved again when the source is closed (and the error is returned then)
+	if (bad > 0) && (time.Since(self.last_save) >= _RESCUE_SAVE_DELAY) {
+		self.last_save = time.Now()
+		self.rescue.Save()
+	}
+
+	return res, nil
+}
+
+func (self *RescueSource) ReadAt(data []byte, offset int64) (int, error) {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	// Known bad ranges are never read again
+	if !self.rescue.Contains(offset, int64(len(data)), RESCUE_BAD) {
+		res, err := self.read(data, offset)
+		if (err == nil) || IsEof(err) {
+			return res, err
+		}
+	}
+
+	return self.read_sectors(data, offset)
+}
+
+func (self *RescueSource) Size() int64 {
+	return self.source.Size()
+}
+
+func (self *RescueSource) SectorSize() int64 {
+	return self.source.SectorSize()
+}
+
+func (self *RescueSource) Inner() BlockSource {
+	return self.source
+}
+
+func (self *RescueSource) Close() error {
+	err := self.rescue.Save()
+	if close_err := self.source.Close(); err == nil {
+		err = close_err
+	}
+
+	return err
+}
+
+func (self *RescueSource) GetMap() *RescueMap {
+	return self.rescue
+}
+
+// Count of bytes zero-filled since the source was opened.
+func (self *RescueSource) GetFilled() int64 {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	return self.filled
+}
+
+// The handler `on_bad` can be nil, the zero-filled sectors are always recorded in the rescue map.
+func RescueTransform(rescue *RescueMap, retries int, on_bad BadSectorHandler) SourceTransform {
+	return func(source BlockSource) (BlockSource, error) {
+		if retries < 0 {
+			retries = 0
+		}
+
+		rescue.SetSize(source.Size())
+
+		res := &RescueSource{
+			source:    source,
+			rescue:    rescue,
+			retries:   retries,
+			on_bad:    on_bad,
+			last_save: time.Now(),
+		}
+
+		return res, nil
+	}
+}
+
+func FindRescue(source BlockSource) *RescueSource {
+	res, _ := find_source(source, func(source BlockSource) bool {
+		_, ok := source.(*RescueSource)
+
+		return ok
+	}).(*RescueSource)
+
+	return res
+}
@@ -0,0 +1,356 @@
+package core
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Status codes of the GNU ddrescue map files.
+const (
+	RESCUE_NON_TRIED   byte = '?'
+	RESCUE_NON_TRIMMED byte = '*'
+	RESCUE_NON_SCRAPED byte = '/'
+	RESCUE_BAD         byte = '-'
+	RESCUE_FINISHED    byte = '+'
+)
+
+type RescueRange struct {
+	Position int64
+	Size     int64
+	Status   byte
+}
+
+func (self *RescueRange) GetEnd() int64 {
+	return self.Position + self.Size
+}
+
+func (self *RescueRange) String() string {
+	return fmt.Sprintf("0x%08X  0x%08X  %c", self.Position, self.Size, self.Status)
+}
+
+// Map of the state of each area of a disk, the areas not listed are not tried.
+type RescueMap struct {
+	path    string
+	size    int64
+	current int64
+	pass    int
+	ranges  []*RescueRange
+	mutex   sync.Mutex
+}
+
+func (self *RescueMap) GetPath() string {
+	return self.path
+}
+
+func (self *RescueMap) GetSize() int64 {
+	return self.size
+}
+
+func (self *RescueMap) SetSize(size int64) {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	self.size = size
+}
+
+func (self *RescueMap) GetCurrent() (int64, int) {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	return self.current, self.pass
+}
+
+func (self *RescueMap) SetCurrent(position int64, pass int) {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	self.current, self.pass = position, pass
+}
+
+func (self *RescueMap) Mark(position, size int64, status byte) {
+	if size <= 0 {
+		return
+	}
+
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	end := position + size
+	res := make([]*RescueRange, 0, len(self.ranges)+2)
+
+	for _, rng := range self.ranges {
+		if (rng.GetEnd() <= position) || (rng.Position >= end) {
+			res = append(res, rng)
+
+			continue
+		}
+
+		if rng.Position < position {
+			res = append(res, &RescueRange{Position: rng.Position, Size: position - rng.Position, Status: rng.Status})
+		}
+
+		if rng.GetEnd() > end {
+			res = append(res, &RescueRange{Position: end, Size: rng.GetEnd() - end, Status: rng.Status})
+		}
+	}
+
+	if status != RESCUE_NON_TRIED {
+		res = append(res, &RescueRange{Position: position, Size: size, Status: status})
+	}
+
+	sort.Slice(res, func(i, j int) bool { return res[i].Position < res[j].Position })
+
+	self.ranges = res[:0]
+	for _, rng := range res {
+		if count := len(self.ranges); count > 0 {
+			last := self.ranges[count-1]
+			if (last.Status == rng.Status) && (last.GetEnd() == rng.Position) {
+				last.Size += rng.Size
+
+				continue
+			}
+		}
+
+		self.ranges = append(self.ranges, rng)
+	}
+}
+
+// Returns the parts of the given area which have the given status.
+func (self *RescueMap) Find(position, size int64, status byte) []RescueRange {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	end := position + size
+	res := make([]RescueRange, 0)
+
+	if status == RESCUE_NON_TRIED {
+		cur := position
+		for _, rng := range self.ranges {
+			if (rng.GetEnd() <= cur) || (rng.Position >= end) {
+				continue
+			}
+
+			if rng.Position > cur {
+				res = append(res, RescueRange{Position: cur, Size: rng.Position - cur, Status: status})
+			}
+
+			cur = rng.GetEnd()
+		}
+
+		if cur < end {
+			res = append(res, RescueRange{Position: cur, Size: end - cur, Status: status})
+		}
+
+		return res
+	}
+
+	idx := sort.Search(len(self.ranges), func(i int) bool {
+		return self.ranges[i].GetEnd() > position
+	})
+
+	for ; (idx < len(self.ranges)) && (self.ranges[idx].Position < end); idx++ {
+		rng := *self.ranges[idx]
+		if rng.Status != status {
+			continue
+		}
+
+		if rng.Position < position {
+			rng.Size -= position - rng.Position
+			rng.Position = position
+		}
+
+		if rng.GetEnd() > end {
+			rng.Size = end - rng.Position
+		}
+
+		res = append(res, rng)
+	}
+
+	return res
+}
+
+func (self *RescueMap) Contains(position, size int64, status byte) bool {
+	return len(self.Find(position, size, status)) > 0
+}
+
+// Total size of the areas which have the given status.
+func (self *RescueMap) Count(status byte) int64 {
+	self.mutex.Lock()
+	size := self.size
+	if size == 0 {
+		for _, rng := range self.ranges {
+			if rng.GetEnd() > size {
+				size = rng.GetEnd()
+			}
+		}
+	}
+	self.mutex.Unlock()
+
+	res := int64(0)
+	for _, rng := range self.Find(0, size, status) {
+		res += rng.Size
+	}
+
+	return res
+}
+
+func (self *RescueMap) GetRanges() []RescueRange {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	res := make([]RescueRange, len(self.ranges))
+	for i, rng := range self.ranges {
+		res[i] = *rng
+	}
+
+	return res
+}
+
+func (self *RescueMap) Save() error {
+	if len(self.path) == 0 {
+		return nil
+	}
+
+	return self.SaveAs(self.path)
+}
+
+// The file is written aside then renamed, so an interruption never leaves a truncated map.
+func (self *RescueMap) SaveAs(path string) error {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	tmp := path + ".tmp"
+
+	file, err := os.Create(tmp)
+	if err != nil {
+		return WrapError(err)
+	}
+
+	writer := bufio.NewWriter(file)
+
+	fmt.Fprintln(writer, "# Rescue map file, created by ntfstool")
+	fmt.Fprintln(writer, "# current_pos  current_status  current_pass")
+	fmt.Fprintf(writer, "0x%08X     %c               %d\n", self.current, RESCUE_NON_TRIED, self.pass)
+	fmt.Fprintln(writer, "#      pos        size  status")
+
+	cur := int64(0)
+	for _, rng := range self.ranges {
+		if rng.Position > cur {
+			fmt.Fprintln(writer, &RescueRange{Position: cur, Size: rng.Position - cur, Status: RESCUE_NON_TRIED})
+		}
+
+		fmt.Fprintln(writer, rng)
+		cur = rng.GetEnd()
+	}
+
+	if cur < self.size {
+		fmt.Fprintln(writer, &RescueRange{Position: cur, Size: self.size - cur, Status: RESCUE_NON_TRIED})
+	}
+
+	if err := writer.Flush(); err != nil {
+		file.Close()
+
+		return WrapError(err)
+	}
+
+	if err := file.Close(); err != nil {
+		return WrapError(err)
+	}
+
+	return WrapError(os.Rename(tmp, path))
+}
+
+func parse_rescue_number(value string) (int64, error) {
+	res, err := strconv.ParseInt(value, 0, 64)
+
+	return res, WrapError(err)
+}
+
+func NewRescueMap(path string) *RescueMap {
+	return &RescueMap{
+		path:   path,
+		pass:   1,
+		ranges: make([]*RescueRange, 0),
+	}
+}
+
+// Loads a map file, a missing file gives an empty map which will be saved at the given path.
+func LoadRescueMap(path string) (*RescueMap, error) {
+	res := NewRescueMap(path)
+
+	file, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return res, nil
+		}
+
+		return nil, WrapError(err)
+	}
+
+	defer DeferedCall(file.Close)
+
+	status_line := true
+	scanner := bufio.NewScanner(file)
+
+	for line_num := 1; scanner.Scan(); line_num++ {
+		line := strings.TrimSpace(scanner.Text())
+		if (len(line) == 0) || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Fields(line)
+
+		if status_line {
+			status_line = false
+
+			if len(fields) < 2 {
+				return nil, WrapError(fmt.Errorf("Bad status line in map file %s at line %d", path, line_num))
+			}
+
+			current, err := parse_rescue_number(fields[0])
+			if err != nil {
+				return nil, err
+			}
+
+			res.current = current
+			if len(fields) > 2 {
+				if pass, err := strconv.Atoi(fields[2]); err == nil {
+					res.pass = pass
+				}
+			}
+
+			continue
+		}
+
+		if (len(fields) < 3) || (len(fields[2]) != 1) {
+			return nil, WrapError(fmt.Errorf("Bad line in map file %s at line %d", path, line_num))
+		}
+
+		position, err := parse_rescue_number(fields[0])
+		if err != nil {
+			return nil, err
+		}
+
+		size, err := parse_rescue_number(fields[1])
+		if err != nil {
+			return nil, err
+		}
+
+		if end := position + size; end > res.size {
+			res.size = end
+		}
+
+		res.Mark(position, size, fields[2][0])
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, WrapError(err)
+	}
+
+	return res, nil
+}
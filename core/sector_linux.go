@@ -0,0 +1,29 @@
+//+build linux
+
+package core
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// Request of the logical sector size of a block device.
+const _BLKSSZGET = 0x1268
+
+// Logical sector size of a block device, the default size for the regular files.
+func get_sector_size(file *os.File) int64 {
+	infos, err := file.Stat()
+	if (err != nil) || ((infos.Mode() & os.ModeDevice) == 0) {
+		return DEFAULT_SECTOR_SIZE
+	}
+
+	var size int32
+
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, file.Fd(), _BLKSSZGET, uintptr(unsafe.Pointer(&size)))
+	if (errno != 0) || (size <= 0) {
+		return DEFAULT_SECTOR_SIZE
+	}
+
+	return int64(size)
+}
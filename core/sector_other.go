@@ -0,0 +1,10 @@
+//+build !linux
+
+package core
+
+import "os"
+
+// Sector size of a file, the size of the sectors of a device is not read on this system.
+func get_sector_size(file *os.File) int64 {
+	return DEFAULT_SECTOR_SIZE
+}
@@ -0,0 +1,298 @@
+package core
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// The security descriptors shared by the files are stored in the metafile $Secure, the files refer to them
+// with the security ID of their $STANDARD_INFORMATION.
+const (
+	SECURE_FILE_NUMBER = 9
+	SECURE_SDS_NAME    = "$SDS"
+	SECURE_SII_NAME    = "$SII"
+	SECURE_SDH_NAME    = "$SDH"
+)
+
+// The $SDS stream is made of blocks of 256K, each block is followed by its mirror.
+const _SECURE_SDS_BLOCK_SIZE = 0x40000
+
+// Header of the entries of $SDS, it's also the data of the entries of the indexes $SII and $SDH.
+type SecureEntryHeader struct {
+	Hash       uint32
+	SecurityId uint32
+	Offset     uint64
+	Length     uint32
+}
+
+// Security descriptors of $Secure, they are found by their security ID with the index $SII,
+// or else by a scan of $SDS (when the index is damaged).
+type Secure struct {
+	sds         *AttributeReader
+	entries     map[uint32]*SecureEntryHeader
+	descriptors map[uint32]*SecurityDescriptor
+	scanned     bool
+}
+
+func (self *Secure) read_entry(header *SecureEntryHeader) (*SecurityDescriptor, error) {
+	header_size := uint64(StructSize(header))
+	end := header.Offset + uint64(header.Length)
+	if (header.Length < uint32(header_size)) || (end > uint64(self.sds.Size())) {
+		return nil, WrapError(fmt.Errorf("$SDS entry of the security ID %d outside of the stream", header.SecurityId))
+	}
+
+	entry := make([]byte, header.Length)
+	if _, err := self.sds.ReadAt(entry, int64(header.Offset)); err != nil {
+		return nil, err
+	}
+
+	// The index entry is checked against the header in $SDS
+	var check SecureEntryHeader
+
+	if err := Read(entry, &check); err != nil {
+		return nil, err
+	}
+
+	if check.SecurityId != header.SecurityId {
+		return nil, WrapError(fmt.Errorf("$SDS entry of the security ID %d has the ID %d", header.SecurityId, check.SecurityId))
+	}
+
+	return ParseSecurityDescriptor(entry[header_size:])
+}
+
+// Finds the entries of $SDS without index, only the first copy of each block is read.
+func (self *Secure) scan() {
+	self.scanned = true
+
+	var header SecureEntryHeader
+
+	header_size := StructSize(header)
+
+	buffer := make([]byte, _SECURE_SDS_BLOCK_SIZE)
+	size := self.sds.Size()
+
+	for block := int64(0); block < size; block += 2 * _SECURE_SDS_BLOCK_SIZE {
+		end, err := self.sds.ReadAt(buffer, block)
+		if (err != nil) && !IsEof(err) {
+			break
+		}
+
+		for pos := 0; (pos + header_size) <= end; {
+			if err := Read(buffer[pos:end], &header); err != nil {
+				break
+			}
+
+			if (header.Offset != uint64(block)+uint64(pos)) || (int(header.Length) <= header_size) || ((pos + int(header.Length)) > end) {
+				pos += 16
+
+				continue
+			}
+
+			if _, exists := self.entries[header.SecurityId]; !exists {
+				entry := header
+				self.entries[header.SecurityId] = &entry
+			}
+
+			// The entries are aligned on 16 bytes
+			pos += (int(header.Length) + 15) &^ 15
+		}
+	}
+}
+
+// Adds the entries of a node of the index $SII or $SDH, the node is the content of the $INDEX_ROOT
+// or an index block of $INDEX_ALLOCATION, with its fixups applied.
+func (self *Secure) add_index_entries(data []byte, entries_start int) {
+	var header SecureEntryHeader
+
+	for pos := entries_start; (pos + 16) <= len(data); {
+		data_offset, data_length := int(binary.LittleEndian.Uint16(data[pos:])), int(binary.LittleEndian.Uint16(data[(pos+2):]))
+		length, flags := int(binary.LittleEndian.Uint16(data[(pos+8):])), DirEntryFlag(binary.LittleEndian.Uint16(data[(pos+12):]))
+
+		if (flags & DEFLAG_LAST_ENTRY) != DEFLAG_NONE {
+			break
+		}
+
+		if (length < 16) || ((pos + length) > len(data)) {
+			break
+		}
+
+		if (data_length >= StructSize(header)) && ((data_offset + data_length) <= length) {
+			if err := Read(data[(pos+data_offset):], &header); err == nil {
+				entry := header
+				self.entries[header.SecurityId] = &entry
+			}
+		}
+
+		pos += length
+	}
+}
+
+// Adds the entries of the root of an index of $Secure (the value of its $INDEX_ROOT attribute).
+func (self *Secure) AddIndexRoot(content []byte) {
+	var root IndexRootAttribute
+
+	if err := Read(content, &root); err != nil {
+		return
+	}
+
+	start := StructSize(root) - StructSize(root.DirectoryIndex)
+	self.add_index_entries(content, start+int(root.DirectoryIndex.EntriesOffset))
+}
+
+// Adds the entries of the blocks of an index of $Secure (read from its $INDEX_ALLOCATION attribute).
+func (self *Secure) AddIndexAllocation(reader *AttributeReader, block_size int) {
+	if block_size <= 0 {
+		block_size = int(DEFAULT_INDEX_SIZE)
+	}
+
+	block := make([]byte, block_size)
+
+	for pos := int64(0); (pos + int64(block_size)) <= reader.Size(); pos += int64(block_size) {
+		if _, err := reader.ReadAt(block, pos); (err != nil) && !IsEof(err) {
+			break
+		}
+
+		if status := ApplyFixups(block, true); status.IsBroken() {
+			continue
+		}
+
+		var header IndexBlockHeader
+
+		if err := Read(block, &header); (err != nil) || (header.Type != RECTYP_INDX) {
+			continue
+		}
+
+		start := StructSize(header) - StructSize(header.DirectoryIndex)
+		self.add_index_entries(block, start+int(header.DirectoryIndex.EntriesOffset))
+	}
+}
+
+// Security descriptor of a security ID, nil if the ID is unknown.
+func (self *Secure) Get(id uint32) (*SecurityDescriptor, error) {
+	if res, ok := self.descriptors[id]; ok {
+		return res, nil
+	}
+
+	header, ok := self.entries[id]
+	if !ok && !self.scanned {
+		self.scan()
+
+		header, ok = self.entries[id]
+	}
+
+	if !ok {
+		return nil, nil
+	}
+
+	res, err := self.read_entry(header)
+	if err != nil {
+		return nil, err
+	}
+
+	self.descriptors[id] = res
+
+	return res, nil
+}
+
+func (self *Secure) Count() int {
+	return len(self.entries)
+}
+
+func MakeSecure(sds *AttributeReader) *Secure {
+	return &Secure{
+		sds:         sds,
+		entries:     make(map[uint32]*SecureEntryHeader),
+		descriptors: make(map[uint32]*SecurityDescriptor),
+	}
+}
+
+// Reads $Secure from its attributes, the $SDS stream and the index $SII.
+func LoadSecure(io *DiskIO, attrs []*AttributeDesc) (*Secure, error) {
+	var res *Secure
+
+	block_size := int(io.GetGeometry().IndexSize)
+	indexes := make([]*AttributeDesc, 0)
+
+	for _, attr := range attrs {
+		switch {
+		case (attr.Header.AttributeType == ATTR_DATA) && (attr.Name == SECURE_SDS_NAME):
+			// $SDS can be big, the descriptors are read only when they are requested
+			reader, err := attr.GetReader(io)
+			if err != nil {
+				return nil, err
+			}
+
+			res = MakeSecure(reader)
+
+		case attr.Name == SECURE_SII_NAME:
+			indexes = append(indexes, attr)
+		}
+	}
+
+	if res == nil {
+		return nil, WrapError(fmt.Errorf("The stream %s of $Secure is not found", SECURE_SDS_NAME))
+	}
+
+	// The index is only a shortcut, the descriptors are found by a scan if it can't be read
+	for _, attr := range indexes {
+		switch attr.Header.AttributeType {
+		case ATTR_INDEX_ROOT:
+			value, err := attr.GetValue(io)
+			if (err != nil) || (value == nil) || (value.Content == nil) {
+				continue
+			}
+
+			if root, ok := value.Value.(*IndexRootAttribute); ok && (root.BytesPerIndexBlock > 0) {
+				block_size = int(root.BytesPerIndexBlock)
+			}
+
+			res.AddIndexRoot(value.Content)
+
+		case ATTR_INDEX_ALLOCATION:
+			if reader, err := attr.GetReader(io); err == nil {
+				res.AddIndexAllocation(reader, block_size)
+			}
+		}
+	}
+
+	return res, nil
+}
+
+// Security descriptor of a file, from its $SECURITY_DESCRIPTOR attribute (NTFS 1.x) or else from $Secure
+// with the security ID of its $STANDARD_INFORMATION, the descriptor is nil if the file has none.
+func GetFileSecurity(io *DiskIO, secure *Secure, attrs []*AttributeDesc) (*SecurityDescriptor, uint32, error) {
+	security_id := uint32(0)
+
+	for _, attr := range attrs {
+		switch attr.Header.AttributeType {
+		case ATTR_SECURITY_DESCRIPTOR:
+			value, err := attr.GetValue(io)
+			if (err != nil) || (value == nil) || (value.Content == nil) {
+				return nil, 0, err
+			}
+
+			res, err := ParseSecurityDescriptor(value.Content)
+
+			return res, 0, err
+
+		case ATTR_STANDARD_INFORMATION:
+			value, err := attr.GetValue(nil)
+			if (err != nil) || (value == nil) {
+				continue
+			}
+
+			// The security ID is not in the $STANDARD_INFORMATION of NTFS 1.x
+			if infos, ok := value.Value.(*StandardInformationAttribute); ok {
+				security_id = infos.SecurityId
+			}
+		}
+	}
+
+	if (security_id == 0) || (secure == nil) {
+		return nil, security_id, nil
+	}
+
+	res, err := secure.Get(security_id)
+
+	return res, security_id, err
+}
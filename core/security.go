@@ -0,0 +1,390 @@
+package core
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strings"
+)
+
+type SecurityControl uint16
+
+const (
+	SE_OWNER_DEFAULTED SecurityControl = 0x0001
+	SE_GROUP_DEFAULTED SecurityControl = 0x0002
+	SE_DACL_PRESENT    SecurityControl = 0x0004
+	SE_DACL_DEFAULTED  SecurityControl = 0x0008
+	SE_SACL_PRESENT    SecurityControl = 0x0010
+	SE_DACL_PROTECTED  SecurityControl = 0x1000
+	SE_SELF_RELATIVE   SecurityControl = 0x8000
+)
+
+type AceType uint8
+
+const (
+	ACE_ACCESS_ALLOWED        AceType = 0x00
+	ACE_ACCESS_DENIED         AceType = 0x01
+	ACE_SYSTEM_AUDIT          AceType = 0x02
+	ACE_SYSTEM_ALARM          AceType = 0x03
+	ACE_ACCESS_ALLOWED_OBJECT AceType = 0x05
+	ACE_ACCESS_DENIED_OBJECT  AceType = 0x06
+	ACE_SYSTEM_AUDIT_OBJECT   AceType = 0x07
+	ACE_SYSTEM_ALARM_OBJECT   AceType = 0x08
+)
+
+var ace_types = map[AceType]string{
+	ACE_ACCESS_ALLOWED:        "ALLOW",
+	ACE_ACCESS_DENIED:         "DENY",
+	ACE_SYSTEM_AUDIT:          "AUDIT",
+	ACE_SYSTEM_ALARM:          "ALARM",
+	ACE_ACCESS_ALLOWED_OBJECT: "ALLOW_OBJECT",
+	ACE_ACCESS_DENIED_OBJECT:  "DENY_OBJECT",
+	ACE_SYSTEM_AUDIT_OBJECT:   "AUDIT_OBJECT",
+	ACE_SYSTEM_ALARM_OBJECT:   "ALARM_OBJECT",
+}
+
+func (self AceType) String() string {
+	res, ok := ace_types[self]
+	if !ok {
+		return fmt.Sprintf("UNKNOWN: %02X", uint8(self))
+	}
+
+	return res
+}
+
+func (self AceType) is_object() bool {
+	return (self >= ACE_ACCESS_ALLOWED_OBJECT) && (self <= ACE_SYSTEM_ALARM_OBJECT)
+}
+
+type AceFlag uint8
+
+const (
+	ACE_OBJECT_INHERIT       AceFlag = 0x01
+	ACE_CONTAINER_INHERIT    AceFlag = 0x02
+	ACE_NO_PROPAGATE_INHERIT AceFlag = 0x04
+	ACE_INHERIT_ONLY         AceFlag = 0x08
+	ACE_INHERITED            AceFlag = 0x10
+)
+
+var ace_flags = []struct {
+	flag AceFlag
+	name string
+}{
+	{ACE_OBJECT_INHERIT, "OI"},
+	{ACE_CONTAINER_INHERIT, "CI"},
+	{ACE_NO_PROPAGATE_INHERIT, "NP"},
+	{ACE_INHERIT_ONLY, "IO"},
+	{ACE_INHERITED, "ID"},
+}
+
+// Flags in the notation of SDDL (OI, CI, NP, IO, ID).
+func (self AceFlag) String() string {
+	res := make([]string, 0)
+	for _, flag := range ace_flags {
+		if (self & flag.flag) != 0 {
+			res = append(res, flag.name)
+		}
+	}
+
+	if rest := self & 0xE0; rest != 0 {
+		res = append(res, fmt.Sprintf("%02X", uint8(rest)))
+	}
+
+	return strings.Join(res, "|")
+}
+
+// Usual combinations of the rights on the files, as shown by Windows.
+var access_masks = map[uint32]string{
+	0x001F01FF: "FULL",
+	0x001301BF: "MODIFY",
+	0x001200A9: "READ_EXECUTE",
+	0x00120089: "READ",
+	0x00100116: "WRITE",
+	0x10000000: "GENERIC_ALL",
+	0x80000000: "GENERIC_READ",
+	0x40000000: "GENERIC_WRITE",
+	0x20000000: "GENERIC_EXECUTE",
+	0xA0000000: "GENERIC_READ_EXECUTE",
+	0xE0000000: "GENERIC_READ_WRITE_EXECUTE",
+}
+
+func AccessMaskName(mask uint32) string {
+	if name, ok := access_masks[mask]; ok {
+		return fmt.Sprintf("%s (0x%08X)", name, mask)
+	}
+
+	return fmt.Sprintf("0x%08X", mask)
+}
+
+// Names of the well-known SIDs, the domain SIDs (S-1-5-21-...) have no name without the registry of the domain.
+var sid_names = map[string]string{
+	"S-1-0-0":      "NULL",
+	"S-1-1-0":      "Everyone",
+	"S-1-2-0":      "LOCAL",
+	"S-1-3-0":      "CREATOR OWNER",
+	"S-1-3-1":      "CREATOR GROUP",
+	"S-1-3-4":      "OWNER RIGHTS",
+	"S-1-5-2":      "NETWORK",
+	"S-1-5-4":      "INTERACTIVE",
+	"S-1-5-6":      "SERVICE",
+	"S-1-5-7":      "ANONYMOUS LOGON",
+	"S-1-5-11":     "Authenticated Users",
+	"S-1-5-18":     "SYSTEM",
+	"S-1-5-19":     "LOCAL SERVICE",
+	"S-1-5-20":     "NETWORK SERVICE",
+	"S-1-5-32-544": "Administrators",
+	"S-1-5-32-545": "Users",
+	"S-1-5-32-546": "Guests",
+	"S-1-5-32-547": "Power Users",
+	"S-1-5-32-551": "Backup Operators",
+	"S-1-15-2-1":   "ALL APPLICATION PACKAGES",
+
+	"S-1-5-80-956008885-3418522649-1831038044-1853292631-2271478464": "TrustedInstaller",
+}
+
+// Name of a well-known SID, or an empty string.
+func SidName(sid string) string {
+	if name, ok := sid_names[sid]; ok {
+		return name
+	}
+
+	if strings.HasPrefix(sid, "S-1-5-21-") {
+		switch sid[(strings.LastIndex(sid, "-") + 1):] {
+		case "500":
+			return "Administrator"
+
+		case "501":
+			return "Guest"
+
+		case "512":
+			return "Domain Admins"
+
+		case "513":
+			return "Domain Users"
+		}
+	}
+
+	return ""
+}
+
+// SID followed by its name if it's a well-known one.
+func FormatSid(sid string) string {
+	if name := SidName(sid); len(name) > 0 {
+		return fmt.Sprintf("%s (%s)", sid, name)
+	}
+
+	return sid
+}
+
+// Decodes a binary SID into its string form (S-1-5-21-...), it returns the SID and its size.
+func ParseSid(data []byte) (string, int, error) {
+	if len(data) < 8 {
+		return "", 0, WrapError(fmt.Errorf("SID too short (%d bytes)", len(data)))
+	}
+
+	revision, count := data[0], int(data[1])
+	size := 8 + (4 * count)
+	if (count > 15) || (size > len(data)) {
+		return "", 0, WrapError(fmt.Errorf("Bad SID (%d sub-authorities for %d bytes)", count, len(data)))
+	}
+
+	authority := uint64(0)
+	for _, b := range data[2:8] {
+		authority = (authority << 8) | uint64(b)
+	}
+
+	res := fmt.Sprintf("S-%d-%d", revision, authority)
+	if authority >= (1 << 32) {
+		res = fmt.Sprintf("S-%d-0x%012X", revision, authority)
+	}
+
+	for i := 0; i < count; i++ {
+		res += fmt.Sprintf("-%d", binary.LittleEndian.Uint32(data[(8+(4*i)):]))
+	}
+
+	return res, size, nil
+}
+
+// Access control entry, the SID of the trustee of the object ACEs is also decoded.
+type Ace struct {
+	Type  AceType
+	Flags AceFlag
+	Mask  uint32
+	Sid   string
+}
+
+func (self *Ace) String() string {
+	flags := ""
+	if self.Flags != 0 {
+		flags = fmt.Sprintf(" [%s]", self.Flags)
+	}
+
+	return fmt.Sprintf("%s %s %s%s", self.Type, FormatSid(self.Sid), AccessMaskName(self.Mask), flags)
+}
+
+func parse_ace(data []byte) (*Ace, int, error) {
+	if len(data) < 8 {
+		return nil, 0, WrapError(fmt.Errorf("ACE too short (%d bytes)", len(data)))
+	}
+
+	size := int(binary.LittleEndian.Uint16(data[2:]))
+	if (size < 8) || (size > len(data)) {
+		return nil, 0, WrapError(fmt.Errorf("Bad ACE size %d", size))
+	}
+
+	res := &Ace{
+		Type:  AceType(data[0]),
+		Flags: AceFlag(data[1]),
+		Mask:  binary.LittleEndian.Uint32(data[4:]),
+	}
+
+	// The other ACEs (callbacks, mandatory labels, ...) have the SID at the place of the one of the basic ACEs
+	sid_offset := 8
+	if res.Type.is_object() {
+		if size < 12 {
+			return nil, 0, WrapError(fmt.Errorf("Object ACE too short (%d bytes)", size))
+		}
+
+		// The object types (GUID) are present according to the flags of the object ACE
+		object_flags := binary.LittleEndian.Uint32(data[8:])
+		sid_offset = 12
+
+		if (object_flags & 1) != 0 {
+			sid_offset += 16
+		}
+
+		if (object_flags & 2) != 0 {
+			sid_offset += 16
+		}
+	}
+
+	if sid_offset < size {
+		sid, _, err := ParseSid(data[sid_offset:size])
+		if err != nil {
+			return nil, 0, err
+		}
+
+		res.Sid = sid
+	}
+
+	return res, size, nil
+}
+
+func parse_acl(data []byte) ([]*Ace, error) {
+	if len(data) < 8 {
+		return nil, WrapError(fmt.Errorf("ACL too short (%d bytes)", len(data)))
+	}
+
+	size, count := int(binary.LittleEndian.Uint16(data[2:])), int(binary.LittleEndian.Uint16(data[4:]))
+	if (size < 8) || (size > len(data)) {
+		return nil, WrapError(fmt.Errorf("Bad ACL size %d", size))
+	}
+
+	res := make([]*Ace, 0, count)
+	pos := 8
+
+	for i := 0; i < count; i++ {
+		ace, ace_size, err := parse_ace(data[pos:size])
+		if err != nil {
+			return nil, err
+		}
+
+		res = append(res, ace)
+		pos += ace_size
+	}
+
+	return res, nil
+}
+
+// Self-relative security descriptor (the form of $SECURITY_DESCRIPTOR and of the entries of $Secure:$SDS).
+type SecurityDescriptor struct {
+	Control SecurityControl
+	Owner   string
+	Group   string
+	Dacl    []*Ace
+}
+
+// A descriptor without DACL gives all the rights to everyone, an empty DACL gives no right.
+func (self *SecurityDescriptor) HasDacl() bool {
+	return (self.Control & SE_DACL_PRESENT) != 0
+}
+
+func (self *SecurityDescriptor) String() string {
+	return fmt.Sprintf("Owner= %s, Group= %s, ACEs= %d", FormatSid(self.Owner), FormatSid(self.Group), len(self.Dacl))
+}
+
+// Full description of the descriptor, one line per ACE.
+func (self *SecurityDescriptor) Lines() []string {
+	res := []string{
+		fmt.Sprintf("Owner: %s", FormatSid(self.Owner)),
+		fmt.Sprintf("Group: %s", FormatSid(self.Group)),
+		fmt.Sprintf("Control: 0x%04X", uint16(self.Control)),
+	}
+
+	if !self.HasDacl() {
+		return append(res, "DACL: none (full access for everyone)")
+	}
+
+	res = append(res, fmt.Sprintf("DACL: %d ACEs", len(self.Dacl)))
+	for _, ace := range self.Dacl {
+		res = append(res, fmt.Sprintf("  - %s", ace))
+	}
+
+	return res
+}
+
+func ParseSecurityDescriptor(data []byte) (*SecurityDescriptor, error) {
+	if len(data) < 20 {
+		return nil, WrapError(fmt.Errorf("Security descriptor too short (%d bytes)", len(data)))
+	}
+
+	if data[0] != 1 {
+		return nil, WrapError(fmt.Errorf("Bad security descriptor revision %d", data[0]))
+	}
+
+	res := &SecurityDescriptor{Control: SecurityControl(binary.LittleEndian.Uint16(data[2:]))}
+	if (res.Control & SE_SELF_RELATIVE) == 0 {
+		return nil, WrapError(fmt.Errorf("The security descriptor is not self-relative"))
+	}
+
+	get_part := func(field int) ([]byte, error) {
+		offset := int(binary.LittleEndian.Uint32(data[field:]))
+		if offset == 0 {
+			return nil, nil
+		}
+
+		if offset >= len(data) {
+			return nil, WrapError(fmt.Errorf("Security descriptor part outside of the data (%d >= %d)", offset, len(data)))
+		}
+
+		return data[offset:], nil
+	}
+
+	for field, sid := range map[int]*string{4: &res.Owner, 8: &res.Group} {
+		part, err := get_part(field)
+		if err != nil {
+			return nil, err
+		}
+
+		if part != nil {
+			if *sid, _, err = ParseSid(part); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if res.HasDacl() {
+		part, err := get_part(16)
+		if err != nil {
+			return nil, err
+		}
+
+		// A null DACL gives all the rights to everyone, like an absent DACL
+		if part == nil {
+			res.Control &^= SE_DACL_PRESENT
+		} else if res.Dacl, err = parse_acl(part); err != nil {
+			return nil, err
+		}
+	}
+
+	return res, nil
+}
@@ -0,0 +1,153 @@
+package core
+
+import (
+	"errors"
+	"io"
+)
+
+type BlockSource interface {
+	io.ReaderAt
+
+	Size() int64
+	SectorSize() int64
+	Close() error
+}
+
+// A transform wraps a block source, the returned source owns the wrapped one and closes it.
+type SourceTransform func(BlockSource) (BlockSource, error)
+
+func StackSource(source BlockSource, transforms ...SourceTransform) (BlockSource, error) {
+	for _, transform := range transforms {
+		res, err := transform(source)
+		if err != nil {
+			source.Close()
+
+			return nil, err
+		}
+
+		source = res
+	}
+
+	return source, nil
+}
+
+// Walks down a stack of sources, through the sources which have an `Inner` method.
+func find_source(source BlockSource, match func(BlockSource) bool) BlockSource {
+	for source != nil {
+		if match(source) {
+			return source
+		}
+
+		wrapper, ok := source.(interface{ Inner() BlockSource })
+		if !ok {
+			return nil
+		}
+
+		source = wrapper.Inner()
+	}
+
+	return nil
+}
+
+type tMemorySource struct {
+	data        []byte
+	sector_size int64
+}
+
+func (self *tMemorySource) ReadAt(data []byte, offset int64) (int, error) {
+	if (offset < 0) || (offset >= int64(len(self.data))) {
+		return 0, io.EOF
+	}
+
+	res := copy(data, self.data[offset:])
+	if res < len(data) {
+		return res, io.EOF
+	}
+
+	return res, nil
+}
+
+func (self *tMemorySource) Size() int64 {
+	return int64(len(self.data))
+}
+
+func (self *tMemorySource) SectorSize() int64 {
+	return self.sector_size
+}
+
+func (self *tMemorySource) Close() error {
+	return nil
+}
+
+func NewMemorySource(data []byte, sector_size int64) BlockSource {
+	if sector_size <= 0 {
+		sector_size = DEFAULT_SECTOR_SIZE
+	}
+
+	return &tMemorySource{
+		data:        data,
+		sector_size: sector_size,
+	}
+}
+
+type tWindowSource struct {
+	source BlockSource
+	offset int64
+	size   int64
+}
+
+func (self *tWindowSource) ReadAt(data []byte, offset int64) (int, error) {
+	if (offset < 0) || (offset >= self.size) {
+		return 0, io.EOF
+	}
+
+	buffer := data
+	if remain := self.size - offset; int64(len(buffer)) > remain {
+		buffer = buffer[:remain]
+	}
+
+	res, err := self.source.ReadAt(buffer, self.offset+offset)
+	if (err == nil) && (res < len(data)) {
+		err = io.EOF
+	}
+
+	return res, err
+}
+
+func (self *tWindowSource) Size() int64 {
+	return self.size
+}
+
+func (self *tWindowSource) SectorSize() int64 {
+	return self.source.SectorSize()
+}
+
+func (self *tWindowSource) Inner() BlockSource {
+	return self.source
+}
+
+func (self *tWindowSource) Close() error {
+	return self.source.Close()
+}
+
+// Shows a part of a source, a negative size means up to the end of the source.
+func WindowTransform(offset, size int64) SourceTransform {
+	return func(source BlockSource) (BlockSource, error) {
+		total := source.Size()
+		if (offset < 0) || (offset > total) {
+			return nil, WrapError(errors.New("Window offset is out of the source"))
+		}
+
+		if (size < 0) || ((offset + size) > total) {
+			size = total - offset
+		}
+
+		res := &tWindowSource{
+			source: source,
+			offset: offset,
+			size:   size,
+		}
+
+		return res, nil
+	}
+}
@@ -19,7 +19,8 @@ const (
 	BOOL_TRUE
 )
 
-type FileRecordData [976]byte
+// Attributes of a FILE record, from the end of its header to the end of the record (cf: Geometry.RecordSize).
+type FileRecordData []byte
 
 func (FileRecordData) String() string {
 	return "<Datas>"
@@ -34,7 +35,7 @@ func (self Byte) String() string {
 type ClusterNumber uint64
 
 func (self ClusterNumber) GetPosition(d *DiskIO) int64 {
-	return d.GetOffset() + (int64(self) * 8)
+	return d.GetOffset() + (int64(self) * d.GetGeometry().ClusterSize)
 }
 
 func (self ClusterNumber) String() string {
@@ -0,0 +1,98 @@
+package core
+
+import (
+	"fmt"
+	"unicode"
+	"unicode/utf16"
+)
+
+// Size of the content of $UpCase, an upper case character for each UTF-16 code unit.
+const UPCASE_SIZE = 0x10000
+
+// Table of $UpCase, the names are compared by NTFS with their characters converted by this table.
+type UpCase []Char
+
+// Built-in table, cf: DefaultUpCase
+var default_upcase UpCase
+
+func (self UpCase) to_upper(name string) []uint16 {
+	res := utf16.Encode([]rune(name))
+	for i, c := range res {
+		res[i] = uint16(self[c])
+	}
+
+	return res
+}
+
+func (self UpCase) ToUpper(name string) string {
+	return string(utf16.Decode(self.to_upper(name)))
+}
+
+// Collation of the file names in the directory indexes: the upper case code units are compared, then the lengths.
+func (self UpCase) Compare(a, b string) int {
+	ua, ub := self.to_upper(a), self.to_upper(b)
+
+	for i := 0; (i < len(ua)) && (i < len(ub)); i++ {
+		switch {
+		case ua[i] < ub[i]:
+			return -1
+
+		case ua[i] > ub[i]:
+			return 1
+		}
+	}
+
+	switch {
+	case len(ua) < len(ub):
+		return -1
+
+	case len(ua) > len(ub):
+		return 1
+	}
+
+	return 0
+}
+
+func (self UpCase) Equal(a, b string) bool {
+	return (a == b) || (self.Compare(a, b) == 0)
+}
+
+// Reads the content of $UpCase.
+func ParseUpCase(data []byte) (UpCase, error) {
+	if len(data) < (2 * UPCASE_SIZE) {
+		return nil, WrapError(fmt.Errorf("$UpCase is too small (%d bytes)", len(data)))
+	}
+
+	res := make(UpCase, UPCASE_SIZE)
+	if err := Read(data, res); err != nil {
+		return nil, err
+	}
+
+	// The table of a damaged $UpCase is not used
+	if (res['a'] != 'A') || (res['z'] != 'Z') || (res['A'] != 'A') {
+		return nil, WrapError(fmt.Errorf("$UpCase is damaged"))
+	}
+
+	return res, nil
+}
+
+// Built-in table, it's used when $UpCase is not read.
+func DefaultUpCase() UpCase {
+	if default_upcase == nil {
+		res := make(UpCase, UPCASE_SIZE)
+		for c := range res {
+			res[c] = Char(c)
+
+			// The surrogates are not converted
+			if !utf16.IsSurrogate(rune(c)) {
+				if upper := unicode.ToUpper(rune(c)); upper < UPCASE_SIZE {
+					res[c] = Char(upper)
+				}
+			}
+		}
+
+		default_upcase = res
+	}
+
+	return default_upcase
+}
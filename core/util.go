@@ -41,6 +41,16 @@ func DecodeInt(b []byte) int64 {
 	return res
 }
 
+// Run list offsets are signed, a run can be before the previous one.
+func DecodeSignedInt(b []byte) int64 {
+	res := DecodeInt(b)
+	if (len(b) > 0) && (len(b) < 8) && ((b[len(b)-1] & 0x80) != 0) {
+		res -= int64(1) << uint(len(b)*8)
+	}
+
+	return res
+}
+
 func DecodeString(b []byte, sz int) string {
 	str_sz := (len(b) + 1) / 2
 	if (0 >= sz) || (sz > str_sz) {
@@ -0,0 +1,179 @@
+package core
+
+import (
+	"encoding/binary"
+	"fmt"
+	sysio "io"
+)
+
+// Named $DATA attribute holding the compressed content of a WOF compressed file.
+const WOF_STREAM_NAME = "WofCompressedData"
+
+const (
+	_WOF_CURRENT_VERSION   = 1
+	_WOF_PROVIDER_FILE     = 2
+	_WOF_FILE_INFO_VERSION = 1
+)
+
+type WofFormat uint32
+
+const (
+	WOF_XPRESS4K  WofFormat = 0
+	WOF_LZX       WofFormat = 1
+	WOF_XPRESS8K  WofFormat = 2
+	WOF_XPRESS16K WofFormat = 3
+)
+
+var wof_formats = map[WofFormat]string{
+	WOF_XPRESS4K:  "XPRESS4K",
+	WOF_LZX:       "LZX",
+	WOF_XPRESS8K:  "XPRESS8K",
+	WOF_XPRESS16K: "XPRESS16K",
+}
+
+func (self WofFormat) String() string {
+	res, ok := wof_formats[self]
+	if !ok {
+		return fmt.Sprintf("UNKNOWN: %d", uint32(self))
+	}
+
+	return res
+}
+
+func (self WofFormat) IsGood() bool {
+	_, ok := wof_formats[self]
+
+	return ok
+}
+
+// Size of the data of a chunk, once decompressed.
+func (self WofFormat) GetChunkSize() int {
+	switch self {
+	case WOF_XPRESS8K:
+		return 8192
+
+	case WOF_XPRESS16K:
+		return 16384
+
+	case WOF_LZX:
+		return 32768
+	}
+
+	return 4096
+}
+
+func (self WofFormat) decompress(src []byte, size int) ([]byte, error) {
+	if self == WOF_LZX {
+		return DecompressLZX(src, size)
+	}
+
+	return DecompressXpressHuffman(src, size)
+}
+
+// Compression format of a file compressed by the Windows Overlay Filter, from its reparse point.
+func GetWofFormat(point *ReparsePoint) (WofFormat, error) {
+	if point.Tag != IO_REPARSE_TAG_WOF {
+		return 0, WrapError(fmt.Errorf("The reparse point %s is not a WOF one", point.Tag))
+	}
+
+	data := point.Data
+	if len(data) < 16 {
+		return 0, WrapError(fmt.Errorf("WOF reparse point too short (%d bytes)", len(data)))
+	}
+
+	version, provider := binary.LittleEndian.Uint32(data), binary.LittleEndian.Uint32(data[4:])
+	if (version != _WOF_CURRENT_VERSION) || (provider != _WOF_PROVIDER_FILE) {
+		return 0, WrapError(fmt.Errorf("WOF provider %d (version %d) is not supported", provider, version))
+	}
+
+	if file_version := binary.LittleEndian.Uint32(data[8:]); file_version != _WOF_FILE_INFO_VERSION {
+		return 0, WrapError(fmt.Errorf("WOF file provider version %d is not supported", file_version))
+	}
+
+	res := WofFormat(binary.LittleEndian.Uint32(data[12:]))
+	if !res.IsGood() {
+		return 0, WrapError(fmt.Errorf("Unknown WOF compression format %s", res))
+	}
+
+	return res, nil
+}
+
+// Decompresses the content of a WofCompressedData stream into `size` bytes, chunk by chunk, the data are given to `write`.
+// The stream starts with the table of the ends of the chunks (the first chunk starts after the table),
+// a chunk as big as its decompressed data is stored uncompressed. Only the table and a chunk are read at once.
+func DecompressWof(src sysio.ReaderAt, src_size int64, format WofFormat, size int64, write func([]byte) error) error {
+	chunk_size := int64(format.GetChunkSize())
+	chunk_count := (size + chunk_size - 1) / chunk_size
+	if chunk_count == 0 {
+		return nil
+	}
+
+	entry_size := int64(4)
+	if size > 0xFFFFFFFF {
+		entry_size = 8
+	}
+
+	table_size := (chunk_count - 1) * entry_size
+	if table_size > src_size {
+		return WrapError(fmt.Errorf("WOF: truncated chunk table"))
+	}
+
+	table := make([]byte, table_size)
+	if _, err := src.ReadAt(table, 0); (err != nil) && !IsEof(err) {
+		return WrapError(err)
+	}
+
+	data_size := src_size - table_size
+	get_offset := func(chunk int64) int64 {
+		if chunk == 0 {
+			return 0
+		}
+
+		if chunk == chunk_count {
+			return data_size
+		}
+
+		entry := table[((chunk - 1) * entry_size):]
+		if entry_size == 8 {
+			return int64(binary.LittleEndian.Uint64(entry))
+		}
+
+		return int64(binary.LittleEndian.Uint32(entry))
+	}
+
+	for chunk := int64(0); chunk < chunk_count; chunk++ {
+		start, end := get_offset(chunk), get_offset(chunk+1)
+		if (start > end) || (end > data_size) {
+			return WrapError(fmt.Errorf("WOF: bad bounds of the chunk %d (%d - %d)", chunk, start, end))
+		}
+
+		out_size := chunk_size
+		if remain := size - (chunk * chunk_size); remain < out_size {
+			out_size = remain
+		}
+
+		compressed := make([]byte, end-start)
+		if _, err := src.ReadAt(compressed, table_size+start); (err != nil) && !IsEof(err) {
+			return WrapError(err)
+		}
+
+		if int64(len(compressed)) >= out_size {
+			if err := write(compressed[:out_size]); err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		chunk_data, err := format.decompress(compressed, int(out_size))
+		if err != nil {
+			return WrapError(fmt.Errorf("WOF chunk %d: %v", chunk, err))
+		}
+
+		if err := write(chunk_data); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
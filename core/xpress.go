@@ -0,0 +1,144 @@
+package core
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+const (
+	_XPRESS_SYMBOLS    = 512
+	_XPRESS_MAX_LENGTH = 15
+	_XPRESS_TABLE_SIZE = _XPRESS_SYMBOLS / 2
+	_XPRESS_BLOCK_SIZE = 65536
+)
+
+// Decompresses an XPRESS stream with Huffman coding (LZ77+Huffman of MS-XCA) into `size` bytes.
+func DecompressXpressHuffman(src []byte, size int) ([]byte, error) {
+	res := make([]byte, 0, size)
+	pos := 0
+
+	read16 := func() uint32 {
+		var res uint32
+
+		if (pos + 2) <= len(src) {
+			res = uint32(binary.LittleEndian.Uint16(src[pos:]))
+		}
+
+		pos += 2
+
+		return res
+	}
+
+	for len(res) < size {
+		if (pos + _XPRESS_TABLE_SIZE) > len(src) {
+			return nil, WrapError(fmt.Errorf("XPRESS: truncated Huffman table at %d", pos))
+		}
+
+		// The code lengths are stored on 4 bits, the even symbols in the low bits
+		lengths := make([]uint8, _XPRESS_SYMBOLS)
+		for i, b := range src[pos:(pos + _XPRESS_TABLE_SIZE)] {
+			lengths[2*i], lengths[(2*i)+1] = b&0xF, b>>4
+		}
+
+		pos += _XPRESS_TABLE_SIZE
+
+		huffman, err := make_huffman(lengths, _XPRESS_MAX_LENGTH)
+		if err != nil {
+			return nil, err
+		}
+
+		next_bits := read16() << 16
+		next_bits |= read16()
+		extra_bits := 16
+
+		consume := func(count int) {
+			next_bits <<= uint(count)
+			extra_bits -= count
+
+			if extra_bits < 0 {
+				next_bits |= read16() << uint(-extra_bits)
+				extra_bits += 16
+			}
+		}
+
+		block_end := len(res) + _XPRESS_BLOCK_SIZE
+		if block_end > size {
+			block_end = size
+		}
+
+		for len(res) < block_end {
+			if pos > (len(src) + 4) {
+				return nil, WrapError(fmt.Errorf("XPRESS: truncated stream"))
+			}
+
+			// The symbol is decoded with the next 15 bits
+			peek, bit := next_bits>>(32-_XPRESS_MAX_LENGTH), uint(_XPRESS_MAX_LENGTH)
+			symbol, length, err := huffman.decode(func() uint32 {
+				bit--
+
+				return (peek >> bit) & 1
+			})
+
+			if err != nil {
+				return nil, err
+			}
+
+			consume(length)
+
+			if symbol < 256 {
+				res = append(res, byte(symbol))
+
+				continue
+			}
+
+			symbol -= 256
+			match_length, offset_bits := symbol&0xF, uint(symbol>>4)
+
+			if match_length == 15 {
+				if pos >= len(src) {
+					return nil, WrapError(fmt.Errorf("XPRESS: truncated match length"))
+				}
+
+				match_length = int(src[pos])
+				pos++
+
+				if match_length == 255 {
+					if (pos + 2) > len(src) {
+						return nil, WrapError(fmt.Errorf("XPRESS: truncated match length"))
+					}
+
+					match_length = int(binary.LittleEndian.Uint16(src[pos:]))
+					pos += 2
+
+					if match_length < 15 {
+						return nil, WrapError(fmt.Errorf("XPRESS: bad match length %d", match_length))
+					}
+
+					match_length -= 15
+				}
+
+				match_length += 15
+			}
+
+			match_length += 3
+
+			offset := (1 << offset_bits) + int(uint64(next_bits)>>(32-offset_bits))
+			consume(int(offset_bits))
+
+			if offset > len(res) {
+				return nil, WrapError(fmt.Errorf("XPRESS: match before the start of the data"))
+			}
+
+			// The copy can overlap the bytes it produces
+			for i := 0; i < match_length; i++ {
+				res = append(res, res[len(res)-offset])
+			}
+		}
+	}
+
+	if len(res) > size {
+		res = res[:size]
+	}
+
+	return res, nil
+}
@@ -0,0 +1,181 @@
+package core
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strings"
+	"testing"
+)
+
+// Writer of an XPRESS Huffman stream, as the encoder of MS-XCA: the places of the 16-bit words
+// are reserved two words ahead, the bytes of the long match lengths are written between them.
+type tXpressWriter struct {
+	out   []byte
+	slots []int
+	acc   uint32
+	count uint
+}
+
+func new_xpress_writer(lengths []uint8) *tXpressWriter {
+	table := make([]byte, _XPRESS_TABLE_SIZE)
+	for symbol, length := range lengths {
+		table[symbol/2] |= length << (4 * uint(symbol&1))
+	}
+
+	return &tXpressWriter{
+		out:   append(table, 0, 0, 0, 0),
+		slots: []int{_XPRESS_TABLE_SIZE, _XPRESS_TABLE_SIZE + 2},
+	}
+}
+
+// A word is only written when a bit doesn't fit in it, like the decoder which loads the next word late.
+func (self *tXpressWriter) bits(value uint32, count uint) {
+	for count > 0 {
+		count--
+
+		if self.count == 16 {
+			binary.LittleEndian.PutUint16(self.out[self.slots[0]:], uint16(self.acc))
+			self.slots = append(self.slots[1:], len(self.out))
+			self.out = append(self.out, 0, 0)
+			self.acc, self.count = 0, 0
+		}
+
+		self.acc = (self.acc << 1) | ((value >> count) & 1)
+		self.count++
+	}
+}
+
+func (self *tXpressWriter) symbol(code *tTestCode, symbol int) {
+	self.bits(code.codes[symbol], uint(code.lengths[symbol]))
+}
+
+func (self *tXpressWriter) raw(data ...byte) {
+	self.out = append(self.out, data...)
+}
+
+func (self *tXpressWriter) data() []byte {
+	binary.LittleEndian.PutUint16(self.out[self.slots[0]:], uint16(self.acc<<(16-self.count)))
+
+	return self.out
+}
+
+// Symbol of a match: the high bits of the offset and the length less 3, 15 for a longer length.
+func xpress_match_symbol(offset_bits, length int) int {
+	return 256 + (offset_bits << 4) + length
+}
+
+func TestXpressLiteralsAndMatch(t *testing.T) {
+	// 3 literals, then a match (offset= 2+1, length= 3+3) with one bit of offset
+	match := xpress_match_symbol(1, 3)
+	lengths := make([]uint8, _XPRESS_SYMBOLS)
+	lengths['a'], lengths['b'], lengths['c'], lengths[match] = 2, 2, 2, 2
+	code := make_test_code(lengths)
+
+	writer := new_xpress_writer(lengths)
+	writer.symbol(code, 'a')
+	writer.symbol(code, 'b')
+	writer.symbol(code, 'c')
+	writer.symbol(code, match)
+	writer.bits(1, 1)
+
+	res, err := DecompressXpressHuffman(writer.data(), 9)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(res) != "abcabcabc" {
+		t.Errorf("Bad data: %q", res)
+	}
+}
+
+func TestXpressLongMatchLengths(t *testing.T) {
+	cases := []struct {
+		name     string
+		literals int
+		extra    []byte
+		length   int
+	}{
+		// The length less 18 in a byte
+		{"byte", 1, []byte{10}, 28},
+		{"null byte", 1, []byte{0}, 18},
+
+		// 255, then the length less 3 in a 16-bit word
+		{"word", 1, []byte{255, 0x2C, 0x01}, 303},
+
+		// The literals fill the first word, the bytes of the length are after the second one
+		{"after a word", 17, []byte{255, 0x2C, 0x01}, 303},
+	}
+
+	match := xpress_match_symbol(0, 15)
+	lengths := make([]uint8, _XPRESS_SYMBOLS)
+	lengths['a'], lengths[match] = 1, 1
+	code := make_test_code(lengths)
+
+	for _, c := range cases {
+		writer := new_xpress_writer(lengths)
+		for i := 0; i < c.literals; i++ {
+			writer.symbol(code, 'a')
+		}
+
+		// Offset= 1, without bits
+		writer.symbol(code, match)
+		writer.raw(c.extra...)
+		writer.symbol(code, 'a')
+
+		expected := bytes.Repeat([]byte{'a'}, c.literals+c.length+1)
+
+		res, err := DecompressXpressHuffman(writer.data(), len(expected))
+		if err != nil {
+			t.Fatalf("%s: %v", c.name, err)
+		}
+
+		if !bytes.Equal(res, expected) {
+			t.Errorf("%s: bad data (size= %d)", c.name, len(res))
+		}
+	}
+}
+
+func TestXpressErrors(t *testing.T) {
+	match := xpress_match_symbol(0, 15)
+	lengths := make([]uint8, _XPRESS_SYMBOLS)
+	lengths['a'], lengths[match] = 1, 1
+	code := make_test_code(lengths)
+
+	stream := func(literal bool, extra ...byte) []byte {
+		writer := new_xpress_writer(lengths)
+		if literal {
+			writer.symbol(code, 'a')
+		}
+
+		writer.symbol(code, match)
+		writer.raw(extra...)
+
+		return writer.data()
+	}
+
+	cases := []struct {
+		name  string
+		src   []byte
+		error string
+	}{
+		{"truncated table", make([]byte, _XPRESS_TABLE_SIZE/2), "truncated Huffman table"},
+		{"truncated stream", new_xpress_writer(lengths).data(), "truncated stream"},
+		{"truncated length byte", stream(true), "truncated match length"},
+		{"truncated length word", stream(true, 255, 0x2C), "truncated match length"},
+		{"bad length", stream(true, 255, 10, 0), "bad match length 10"},
+		{"match before start", stream(false, 0), "before the start of the data"},
+	}
+
+	for _, c := range cases {
+		_, err := DecompressXpressHuffman(c.src, 100)
+		if err == nil {
+			t.Errorf("%s: no error", c.name)
+
+			continue
+		}
+
+		if msg := GetSource(err).Error(); !strings.Contains(msg, c.error) {
+			t.Errorf("%s: bad error: %s", c.name, msg)
+		}
+	}
+}
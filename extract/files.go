@@ -23,11 +23,56 @@ type File struct {
 	Size      uint64
 	Name      string
 	RunList   core.RunList
+
+	// Clusters per compression unit, zero if the data are not compressed
+	Compression int64
+
+	// Size of the clusters allocated on the disk, without the sparse runs
+	Allocated uint64
+
+	// Named $DATA attributes (alternate data streams)
+	Streams []*Stream
+
+	// Reparse point, for the links
+	Reparse *Reparse
+
+	// Security descriptor, from $Secure or from the file itself
+	Security *Security
+
+	// Timestamps of $STANDARD_INFORMATION and of the $FILE_NAME of the name of the file, and its DOS attributes (FileAttrFlag)
+	Times      *Times
+	NameTimes  *Times
+	Attributes uint32
+
+	// Content of a small file, stored in its MFT record (resident $DATA attribute) at the position of the file
+	Resident bool
+	Data     StreamData
+
+	// Other hard links of the file, the file has a name in each parent directory of its links
+	Links []*FileLink
+
+	// Size of the data after the initialized size, they are read as zeros
+	Uninitialized uint64
+}
+
+// Hard link of a file, the parent is the ID of the directory of the link.
+type FileLink struct {
+	Name      string
+	Parent    string
+	ParentRef data.FileRef
+}
+
+func (self *FileLink) String() string {
+	return fmt.Sprintf("%s <Parent:%s; REF:%s>", self.Name, self.Parent, self.ParentRef)
 }
 
 func (self *File) IsRoot() bool              { return (len(self.Parent) == 0) || (self.Parent == self.Id) }
-func (self *File) IsFile() bool              { return len(self.RunList) > 0 }
-func (self *File) IsDir() bool               { return len(self.RunList) == 0 }
+func (self *File) IsFile() bool              { return self.HasData() || self.IsFileLink() || self.IsWof() }
+func (self *File) HasData() bool             { return (len(self.RunList) > 0) || self.Resident }
+func (self *File) IsDir() bool               { return !self.IsFile() }
+func (self *File) IsLink() bool              { return (self.Reparse != nil) && self.Reparse.IsLink() }
+func (self *File) IsFileLink() bool          { return self.IsLink() && !self.Reparse.Directory }
+func (self *File) IsWof() bool               { _, _, ok := self.GetWof(); return ok }
 func (self *File) HasName() bool             { return true }
 func (self *File) GetEncodingCode() string   { return "N" }
 func (self *File) GetFile() *File            { return self }
@@ -42,6 +87,37 @@ func (self *File) SetName(name string)       { self.Name = name }
 func (self *File) Print()                    { core.PrintStruct(self) }
 func (self *File) setParentIndex(idx *Index) { self.ParentIdx = idx.IdMap[self.Parent] }
 
+// Compression format and compressed stream of a file compressed by the Windows Overlay Filter.
+func (self *File) GetWof() (core.WofFormat, *Stream, bool) {
+	if (self.Reparse == nil) || (self.Reparse.GetTag() != core.IO_REPARSE_TAG_WOF) {
+		return 0, nil, false
+	}
+
+	format, err := core.GetWofFormat(self.Reparse.GetPoint())
+	if err != nil {
+		return 0, nil, false
+	}
+
+	for _, stream := range self.Streams {
+		if stream.Name == core.WOF_STREAM_NAME {
+			return format, stream, true
+		}
+	}
+
+	return 0, nil, false
+}
+
+// Reader over the content of the file, from its MFT record for a resident file or else from its clusters.
+func (self *File) GetReader(from_disk *core.DiskIO) *core.AttributeReader {
+	if self.Resident {
+		return core.NewResidentReader(self.Data)
+	}
+
+	initialized := int64(self.Size - self.Uninitialized)
+
+	return core.NewAttributeReader(from_disk, self.RunList, int64(self.Size), initialized, self.Compression)
+}
+
 func (self *File) String() string {
 	const msg = "[%s <MFT:%s; REF:%s; Parent:%s; %s>]"
 
@@ -0,0 +1,180 @@
+package extract
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/corebreaker/ntfstool/core"
+
+	"github.com/siddontang/go/ioutil2"
+)
+
+// How the other hard links of the saved files are saved.
+type HardLinkMode int
+
+const (
+	HARDLINKS_LINK HardLinkMode = iota
+	HARDLINKS_COPY
+	HARDLINKS_NONE
+)
+
+func ParseHardLinkMode(mode string) (HardLinkMode, error) {
+	switch mode {
+	case "", "link":
+		return HARDLINKS_LINK, nil
+
+	case "copy":
+		return HARDLINKS_COPY, nil
+
+	case "none":
+		return HARDLINKS_NONE, nil
+	}
+
+	return HARDLINKS_NONE, core.WrapError(fmt.Errorf("Bad hard link mode `%s` (link, copy or none are expected)", mode))
+}
+
+// Saved file or directory, the hard links are made after the save of the tree.
+type tSavedFile struct {
+	file *File
+	path string
+}
+
+func (self *SaveOptions) add_saved(file *File, path string) {
+	if self.HardLinks == HARDLINKS_NONE {
+		return
+	}
+
+	if self.saved == nil {
+		self.saved = make(map[string]*tSavedFile)
+	}
+
+	saved := &tSavedFile{
+		file: file,
+		path: path,
+	}
+
+	self.saved[file.Id] = saved
+
+	if len(file.Links) > 0 {
+		self.linked = append(self.linked, saved)
+	}
+}
+
+// Copies a saved file block by block, so the holes of the sparse and compressed files stay holes in the copy.
+func copy_file(src, dest string, block_size int64) error {
+	from, err := os.Open(src)
+	if err != nil {
+		return core.WrapError(err)
+	}
+
+	defer core.DeferedCall(from.Close)
+
+	to, err := core.OpenFile(dest, core.OPEN_WRONLY)
+	if err != nil {
+		return err
+	}
+
+	defer core.DeferedCall(to.Close)
+
+	buffer := make([]byte, block_size)
+	size := int64(0)
+
+	for {
+		cnt, err := io.ReadFull(from, buffer)
+		if (err != nil) && (err != io.EOF) && (err != io.ErrUnexpectedEOF) {
+			return core.WrapError(err)
+		}
+
+		if cnt == 0 {
+			break
+		}
+
+		if _, err := write_block(to, buffer[:cnt]); err != nil {
+			return err
+		}
+
+		size += int64(cnt)
+	}
+
+	// The trailing holes are not written, they are made by the truncation
+	return core.WrapError(to.Truncate(size))
+}
+
+// Makes the other hard links of the files saved by SaveNode, as hard links or as copies (cf: SaveOptions.HardLinks).
+// A link is not made if its directory has not been saved, or if a file already exists at its path.
+func SaveHardLinks(from_disk *core.DiskIO, options *SaveOptions, report *SaveReport) error {
+	if len(options.linked) == 0 {
+		return nil
+	}
+
+	fmt.Println("Making hard links")
+
+	dirs := make(map[string]*tSavedFile)
+
+	for _, saved := range options.linked {
+		file := saved.file
+
+		for _, link := range file.Links {
+			dir, ok := options.saved[link.Parent]
+			if !ok {
+				continue
+			}
+
+			destname := filepath.Join(dir.path, link.Name)
+			if ioutil2.FileExists(destname) {
+				fmt.Println(fmt.Sprintf("    Warning: the hard link %s already exists", destname))
+
+				continue
+			}
+
+			fmt.Println(fmt.Sprintf("  - %s (link to %s)", destname, saved.path))
+
+			copied := options.HardLinks == HARDLINKS_COPY
+			if !copied {
+				if err := os.Link(saved.path, destname); err != nil {
+					fmt.Println("    Warning: the hard link can not be made, the file is copied:", err)
+
+					copied = true
+				}
+			}
+
+			// A copy has its own streams and its own ACL
+			if copied {
+				if err := copy_file(saved.path, destname, from_disk.GetGeometry().ClusterSize); err != nil {
+					return err
+				}
+
+				if err := save_streams(from_disk, file, destname, options, report); err != nil {
+					return err
+				}
+
+				if options.Acls {
+					if err := save_acl(file, destname, report); err != nil {
+						return err
+					}
+				}
+			}
+
+			if err := options.Manifest.Add(file, destname); err != nil {
+				return err
+			}
+
+			apply_times(file, destname)
+
+			if report != nil {
+				report.HardLinks++
+			}
+
+			dirs[dir.file.Id] = dir
+		}
+	}
+
+	// The times of the directories are set again, as the new links change their modification time
+	for _, dir := range dirs {
+		apply_times(dir.file, dir.path)
+	}
+
+	return nil
+}
@@ -0,0 +1,114 @@
+package extract
+
+import (
+	"encoding/csv"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/corebreaker/ntfstool/core"
+)
+
+// Name of the metadata manifest written into the output directory of `save`.
+const DEFAULT_MANIFEST_NAME = "ntfstool-manifest.csv"
+
+var manifest_header = []string{
+	"path", "id", "type", "size",
+	"created", "modified", "changed", "accessed",
+	"name_created", "name_modified", "name_changed", "name_accessed",
+	"readonly", "hidden", "system", "attributes",
+}
+
+// CSV file with a line per saved file, for the metadata which can not be kept by the saved files
+// (creation and MFT change times, times of $FILE_NAME, DOS attributes).
+type Manifest struct {
+	file   *os.File
+	writer *csv.Writer
+}
+
+func MakeManifest(path string) (*Manifest, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, core.WrapError(err)
+	}
+
+	res := &Manifest{
+		file:   file,
+		writer: csv.NewWriter(file),
+	}
+
+	if err := res.writer.Write(manifest_header); err != nil {
+		file.Close()
+
+		return nil, core.WrapError(err)
+	}
+
+	return res, nil
+}
+
+func (self *Manifest) Add(file *File, path string) error {
+	if self == nil {
+		return nil
+	}
+
+	file_type := "file"
+	switch {
+	case file.IsLink():
+		file_type = "link"
+
+	case file.IsDir():
+		file_type = "dir"
+	}
+
+	times, name_times := file.Times, file.NameTimes
+	if times == nil {
+		times = new(Times)
+	}
+
+	if name_times == nil {
+		name_times = new(Times)
+	}
+
+	flags := core.FileAttrFlag(file.Attributes)
+	has_flag := func(flag core.FileAttrFlag) string {
+		if (flags & flag) != core.FAFLAG_NONE {
+			return "1"
+		}
+
+		return "0"
+	}
+
+	// The names of the flags are sorted, so the manifests can be compared
+	attributes := ""
+	if flags != core.FAFLAG_NONE {
+		names := strings.Split(flags.String(), " | ")
+		sort.Strings(names)
+
+		attributes = strings.Join(names, "|")
+	}
+
+	line := []string{
+		path, file.Id, file_type, fmt.Sprint(file.Size),
+		format_time(times.Creation), format_time(times.Modification), format_time(times.Change), format_time(times.Access),
+		format_time(name_times.Creation), format_time(name_times.Modification), format_time(name_times.Change), format_time(name_times.Access),
+		has_flag(core.FAFLAG_READONLY), has_flag(core.FAFLAG_HIDDEN), has_flag(core.FAFLAG_SYSTEM), attributes,
+	}
+
+	return core.WrapError(self.writer.Write(line))
+}
+
+func (self *Manifest) Close() error {
+	if self == nil {
+		return nil
+	}
+
+	self.writer.Flush()
+	if err := self.writer.Error(); err != nil {
+		self.file.Close()
+
+		return core.WrapError(err)
+	}
+
+	return core.WrapError(self.file.Close())
+}
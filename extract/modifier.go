@@ -130,6 +130,49 @@ func (self *FileModifier) GetRecordWithId(id string) (IFile, error) {
 	return self.GetRecordAt(idx)
 }
 
+// Path of the name `name` in the directory with the ID `parent`, the parents are read from the file.
+func (self *FileModifier) GetPath(parent, name string) (string, error) {
+	res := name
+
+	// A loop in the parents of a damaged tree ends at the count of the records
+	for i := self.GetCount(); (i > 0) && (len(parent) > 0); i-- {
+		rec, err := self.GetRecordWithId(parent)
+		if err != nil {
+			return "", err
+		}
+
+		file := rec.GetFile()
+		if (file == nil) || file.IsRoot() {
+			break
+		}
+
+		res = fmt.Sprintf("%s/%s", file.Name, res)
+		parent = file.Parent
+	}
+
+	return "/" + res, nil
+}
+
+// Paths of all the hard links of a file, the path of its name is the first.
+func (self *FileModifier) GetFilePaths(file *File) ([]string, error) {
+	path, err := self.GetPath(file.Parent, file.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	res := []string{path}
+	for _, link := range file.Links {
+		path, err := self.GetPath(link.Parent, link.Name)
+		if err != nil {
+			return nil, err
+		}
+
+		res = append(res, path)
+	}
+
+	return res, nil
+}
+
 func (self *FileModifier) DelRecordAt(index int) error {
 	old, err := self.GetRecordAt(index)
 	if err != nil {
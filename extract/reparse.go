@@ -0,0 +1,154 @@
+package extract
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/corebreaker/ntfstool/core"
+)
+
+// Drive letter of the volume when it's not given, the one of the system volume.
+const DEFAULT_LINK_DRIVE = "C"
+
+// Reparse point of a file, for the links (symbolic links, junctions and application execution aliases)
+// and for the files compressed by the Windows Overlay Filter.
+type Reparse struct {
+	Tag            uint32
+	SubstituteName string
+	PrintName      string
+	Relative       bool
+	Directory      bool
+	Data           StreamData
+}
+
+func MakeReparse(point *core.ReparsePoint, is_dir bool) *Reparse {
+	return &Reparse{
+		Tag:            uint32(point.Tag),
+		SubstituteName: point.SubstituteName,
+		PrintName:      point.PrintName,
+		Relative:       point.Relative,
+		Directory:      is_dir,
+		Data:           StreamData(point.Data),
+	}
+}
+
+func (self *Reparse) GetPoint() *core.ReparsePoint {
+	return &core.ReparsePoint{
+		Tag:            core.ReparseTag(self.Tag),
+		SubstituteName: self.SubstituteName,
+		PrintName:      self.PrintName,
+		Relative:       self.Relative,
+		Data:           self.Data,
+	}
+}
+
+func (self *Reparse) GetTag() core.ReparseTag { return core.ReparseTag(self.Tag) }
+func (self *Reparse) IsLink() bool            { return self.GetPoint().IsLink() }
+func (self *Reparse) GetTarget() string       { return self.GetPoint().GetTarget() }
+func (self *Reparse) String() string          { return self.GetPoint().String() }
+
+// Target of the Linux symbolic link made in `link_dir`, the absolute targets are moved into `root`, which stands for
+// the directory `prefix` of the volume (the parent of the saved tree), and are made relative, so the recovery directory
+// can be moved. A target outside `root`, or on another drive than `drive` (the letter of the volume) or on another volume,
+// is rejected.
+func (self *Reparse) MakeLinkTarget(root, drive, prefix, link_dir string) (string, error) {
+	target := strings.Replace(self.GetTarget(), `\`, "/", -1)
+	if self.Relative {
+		if !is_in_dir(root, filepath.Join(link_dir, filepath.FromSlash(target))) {
+			return "", core.WrapError(fmt.Errorf("The target `%s` is outside the saved tree", target))
+		}
+
+		return target, nil
+	}
+
+	// The Win32 prefix of the long paths (`\\?\C:\dir`) is removed
+	target = strings.TrimPrefix(target, "//?/")
+
+	switch {
+	// The drive letter of the volume is removed, `C:/dir` is the path `/dir` of the volume
+	case (len(target) >= 2) && (target[1] == ':'):
+		if !strings.EqualFold(target[:1], drive) {
+			return "", core.WrapError(fmt.Errorf("The target `%s` is on another drive than %s:", target, drive))
+		}
+
+		target = target[2:]
+
+	// A network path (`\\server\share`) or a path of a volume (`Volume{GUID}\dir`, `UNC\server\share`)
+	case strings.HasPrefix(target, "//"), !strings.HasPrefix(target, "/"):
+		return "", core.WrapError(fmt.Errorf("The target `%s` is on another volume", target))
+	}
+
+	// A cleaned absolute path has no `..` above the root of the volume
+	target = path.Clean("/" + target)
+	prefix = path.Clean("/" + filepath.ToSlash(prefix))
+
+	// The names of the volume are compared without case
+	rel := target
+	if prefix != "/" {
+		size := len(prefix)
+		if (len(target) < size) || !strings.EqualFold(target[:size], prefix) || ((len(target) > size) && (target[size] != '/')) {
+			return "", core.WrapError(fmt.Errorf("The target `%s` is outside the saved tree", target))
+		}
+
+		rel = target[size:]
+	}
+
+	abs_target := filepath.Join(root, filepath.FromSlash(rel))
+	res, err := filepath.Rel(link_dir, abs_target)
+	if err != nil {
+		return abs_target, nil
+	}
+
+	return res, nil
+}
+
+// The path is `dir` or it is in `dir`, once they are cleaned.
+func is_in_dir(dir, name string) bool {
+	rel, err := filepath.Rel(filepath.Clean(dir), filepath.Clean(name))
+
+	return (err == nil) && (rel != "..") && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// Makes a symbolic link in place of a file or a directory with a reparse point,
+// the result is false if the target is outside the saved tree.
+func save_link(file *File, destname string, options *SaveOptions, report *SaveReport) (bool, error) {
+	root := options.LinkRoot
+	if len(root) == 0 {
+		root = filepath.Dir(destname)
+	}
+
+	drive := options.LinkDrive
+	if len(drive) == 0 {
+		drive = DEFAULT_LINK_DRIVE
+	}
+
+	target, err := file.Reparse.MakeLinkTarget(root, drive, options.LinkPrefix, filepath.Dir(destname))
+	if err != nil {
+		fmt.Println(fmt.Sprintf("  - %s (%s)", destname, file.Reparse.GetTag()))
+		fmt.Println("    Warning: the link is not saved:", core.GetSource(err))
+
+		return false, nil
+	}
+
+	fmt.Println(fmt.Sprintf("  - %s -> %s (%s)", destname, target, file.Reparse.GetTag()))
+
+	// A link saved before is replaced
+	if infos, err := os.Lstat(destname); (err == nil) && ((infos.Mode() & os.ModeSymlink) != 0) {
+		if err := os.Remove(destname); err != nil {
+			return false, core.WrapError(err)
+		}
+	}
+
+	if err := os.Symlink(target, destname); err != nil {
+		return false, core.WrapError(err)
+	}
+
+	if report != nil {
+		report.Links++
+	}
+
+	return true, nil
+}
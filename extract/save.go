@@ -9,15 +9,165 @@ import (
 	"github.com/corebreaker/ntfstool/core"
 )
 
-func SaveNode(from_disk *core.DiskIO, node *Node, to_path string, noempty, nometa bool) (int64, error) {
+type SaveOptions struct {
+	NoEmpty bool
+	NoMeta  bool
+
+	// Saving of the alternate data streams, and the name of the sidecar files (cf: MakeStreamName)
+	Streams    StreamMode
+	StreamName string
+
+	// The links are saved as symbolic links, the absolute targets in the directory `LinkPrefix` of the volume
+	// are moved into the link root (the output directory), the other targets are not saved,
+	// `LinkDrive` is the drive letter of the volume (cf: DEFAULT_LINK_DRIVE)
+	Symlinks   bool
+	LinkRoot   string
+	LinkPrefix string
+	LinkDrive  string
+
+	// The security descriptors are written into sidecar files (cf: save_acl)
+	Acls bool
+
+	// Manifest of the metadata of the saved files, nil for no manifest
+	Manifest *Manifest
+
+	// Saving of the other hard links of the files (cf: SaveHardLinks), and the saved files by ID
+	HardLinks HardLinkMode
+	saved     map[string]*tSavedFile
+	linked    []*tSavedFile
+}
+
+type DamagedFile struct {
+	Path       string
+	ZeroFilled int64
+}
+
+// Summary of a save, with the files saved with zero-filled regions, because of unreadable sectors.
+// The allocated size is the size of the clusters really used on the disk (holes and compression excluded).
+type SaveReport struct {
+	Files     int
+	Size      uint64
+	Allocated uint64
+	Streams   int
+	Links     int
+	HardLinks int
+	Acls      int
+	Damaged   []*DamagedFile
+}
+
+func (self *SaveReport) Print() {
+	fmt.Println(fmt.Sprintf("Saved: %d files, size= %d, allocated= %d", self.Files, self.Size, self.Allocated))
+
+	if self.Streams > 0 {
+		fmt.Println("Saved streams:", self.Streams)
+	}
+
+	if self.Links > 0 {
+		fmt.Println("Saved links:", self.Links)
+	}
+
+	if self.HardLinks > 0 {
+		fmt.Println("Saved hard links:", self.HardLinks)
+	}
+
+	if self.Acls > 0 {
+		fmt.Println("Saved ACLs:", self.Acls)
+	}
+
+	if len(self.Damaged) == 0 {
+		return
+	}
+
+	fmt.Println("Files with zero-filled regions (unreadable sectors):")
+	for _, damaged := range self.Damaged {
+		fmt.Println(fmt.Sprintf("  - %s (%d bytes)", damaged.Path, damaged.ZeroFilled))
+	}
+}
+
+func (self *SaveReport) add_damaged(path string, zero_filled int64) {
+	if zero_filled == 0 {
+		return
+	}
+
+	fmt.Println(fmt.Sprintf("    Warning: %d bytes zero-filled (unreadable sectors)", zero_filled))
+
+	if self != nil {
+		self.Damaged = append(self.Damaged, &DamagedFile{Path: path, ZeroFilled: zero_filled})
+	}
+}
+
+// Destination of the data of a file or of a stream, the holes are made by seeking then truncating.
+type tDataWriter interface {
+	io.Writer
+	io.Seeker
+
+	Truncate(size int64) error
+}
+
+// Writes a block of decompressed data, a zero block is left as a hole.
+func write_block(dest tDataWriter, data []byte) (int, error) {
+	if core.IsZeroBlock(data) {
+		_, err := dest.Seek(int64(len(data)), io.SeekCurrent)
+
+		return len(data), core.WrapError(err)
+	}
+
+	res, err := dest.Write(data)
+
+	return res, core.WrapError(err)
+}
+
+// Writes the data read by `reader` into `dest`, it returns the written size and the size of the zero-filled regions.
+// The blocks of zeros (the sparse runs, the compression units without cluster) are left as holes.
+func write_reader(dest tDataWriter, reader *core.AttributeReader, block_size int64) (int64, int64, error) {
+	buffer := make([]byte, block_size)
+	size := int64(0)
+
+	for size < reader.Size() {
+		cnt, err := reader.ReadAt(buffer, size)
+		if (err != nil) && !core.IsEof(err) {
+			return 0, 0, err
+		}
+
+		if cnt == 0 {
+			break
+		}
+
+		if _, err := write_block(dest, buffer[:cnt]); err != nil {
+			return 0, 0, err
+		}
+
+		size += int64(cnt)
+	}
+
+	// The trailing holes are not written, they are made by the truncation
+	if err := dest.Truncate(size); err != nil {
+		return 0, 0, core.WrapError(err)
+	}
+
+	return size, reader.GetBadSize(), nil
+}
+
+func SaveNode(from_disk *core.DiskIO, node *Node, to_path string, options *SaveOptions, report *SaveReport) (int64, error) {
 	file := node.File
+	noempty, nometa := options.NoEmpty, options.NoMeta
 	if (nometa && IsMetaFile(file)) || (noempty && node.IsEmpty(nometa)) {
 		return 0, nil
 	}
 
+	if options.Symlinks && file.IsLink() {
+		destname := filepath.Join(to_path, file.Name)
+		saved, err := save_link(file, destname, options, report)
+		if (err != nil) || !saved {
+			return 0, err
+		}
+
+		return 0, options.Manifest.Add(file, destname)
+	}
+
 	if node.IsFile() {
 		destname := filepath.Join(to_path, file.Name)
-		fmt.Println("  -", destname)
+		fmt.Println(fmt.Sprintf("  - %s (size= %d, allocated= %d)", destname, file.Size, file.Allocated))
 
 		dest, err := core.OpenFile(destname, core.OPEN_WRONLY)
 		if err != nil {
@@ -26,59 +176,46 @@ func SaveNode(from_disk *core.DiskIO, node *Node, to_path string, noempty, nomet
 
 		defer core.DeferedCall(dest.Close)
 
-		var bytes [4096]byte
+		from_disk.SetOffset(file.Origin)
 
-		buffer := bytes[:]
-		size, file_size, buf_size := 0, file.Size, uint64(len(bytes))
+		var size, zero_filled int64
 
-		from_disk.SetOffset(file.Origin)
-		for _, run := range file.RunList {
-			if file_size == 0 {
-				break
-			}
+		if format, stream, ok := file.GetWof(); ok {
+			size, zero_filled, err = write_wof(from_disk, dest, file, format, stream)
+		} else {
+			size, zero_filled, err = write_reader(dest, file.GetReader(from_disk), from_disk.GetGeometry().ClusterSize)
+		}
+
+		if err != nil {
+			return 0, err
+		}
+
+		if report != nil {
+			report.Files++
+			report.Size += file.Size
+			report.Allocated += file.Allocated
+		}
+
+		report.add_damaged(destname, zero_filled)
 
-			if run.Zero {
-				core.ClearBuffer(buffer)
-				for i := int64(0); (i < run.Count) && (file_size > 0); i++ {
-					cur_size := file_size
-					if cur_size > buf_size {
-						cur_size = buf_size
-					}
-
-					file_size -= cur_size
-
-					cnt, err := dest.Write(buffer[:cur_size])
-					if err != nil {
-						return 0, core.WrapError(err)
-					}
-
-					size += cnt
-				}
-			} else {
-				start, end := run.Start, run.GetNext()
-				for pos := start; (pos < end) && (file_size > 0); pos++ {
-					if err := from_disk.ReadCluster(int64(pos), buffer); (err != nil) && (core.GetSource(err) != io.EOF) {
-						return 0, err
-					}
-
-					cur_size := file_size
-					if cur_size > buf_size {
-						cur_size = buf_size
-					}
-
-					file_size -= cur_size
-
-					cnt, err := dest.Write(buffer[:cur_size])
-					if err != nil {
-						return 0, core.WrapError(err)
-					}
-
-					size += cnt
-				}
+		if err := save_streams(from_disk, file, destname, options, report); err != nil {
+			return 0, err
+		}
+
+		if options.Acls {
+			if err := save_acl(file, destname, report); err != nil {
+				return 0, err
 			}
 		}
 
-		return int64(size), nil
+		if err := options.Manifest.Add(file, destname); err != nil {
+			return 0, err
+		}
+
+		apply_times(file, destname)
+		options.add_saved(file, destname)
+
+		return size, nil
 	} else {
 		if !file.IsDir() {
 			return 0, core.WrapError(fmt.Errorf("Node %s do not represent a directory.", file))
@@ -91,8 +228,18 @@ func SaveNode(from_disk *core.DiskIO, node *Node, to_path string, noempty, nomet
 			return 0, core.WrapError(err)
 		}
 
+		if err := save_streams(from_disk, file, dirname, options, report); err != nil {
+			return 0, err
+		}
+
+		if options.Acls {
+			if err := save_acl(file, dirname, report); err != nil {
+				return 0, err
+			}
+		}
+
 		for _, child := range node.Children {
-			sz, err := SaveNode(from_disk, child, dirname, noempty, nometa)
+			sz, err := SaveNode(from_disk, child, dirname, options, report)
 			if err != nil {
 				return 0, err
 			}
@@ -100,6 +247,14 @@ func SaveNode(from_disk *core.DiskIO, node *Node, to_path string, noempty, nomet
 			size += sz
 		}
 
+		if err := options.Manifest.Add(file, dirname); err != nil {
+			return 0, err
+		}
+
+		// The times of a directory are set after its children, as they change its modification time
+		apply_times(file, dirname)
+		options.add_saved(file, dirname)
+
 		return int64(size), nil
 	}
 }
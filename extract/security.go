@@ -0,0 +1,105 @@
+package extract
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"github.com/corebreaker/ntfstool/core"
+)
+
+type Ace struct {
+	Type  uint32
+	Flags uint32
+	Mask  uint32
+	Sid   string
+}
+
+// Security descriptor of a file, with the security ID which refers to it in $Secure (zero for an inline descriptor).
+type Security struct {
+	Id      uint32
+	Control uint32
+	Owner   string
+	Group   string
+	Dacl    []*Ace
+}
+
+func MakeSecurity(id uint32, desc *core.SecurityDescriptor) *Security {
+	res := &Security{
+		Id:      id,
+		Control: uint32(desc.Control),
+		Owner:   desc.Owner,
+		Group:   desc.Group,
+		Dacl:    make([]*Ace, len(desc.Dacl)),
+	}
+
+	for i, ace := range desc.Dacl {
+		res.Dacl[i] = &Ace{
+			Type:  uint32(ace.Type),
+			Flags: uint32(ace.Flags),
+			Mask:  ace.Mask,
+			Sid:   ace.Sid,
+		}
+	}
+
+	return res
+}
+
+func (self *Security) GetDescriptor() *core.SecurityDescriptor {
+	res := &core.SecurityDescriptor{
+		Control: core.SecurityControl(self.Control),
+		Owner:   self.Owner,
+		Group:   self.Group,
+		Dacl:    make([]*core.Ace, len(self.Dacl)),
+	}
+
+	for i, ace := range self.Dacl {
+		res.Dacl[i] = &core.Ace{
+			Type:  core.AceType(ace.Type),
+			Flags: core.AceFlag(ace.Flags),
+			Mask:  ace.Mask,
+			Sid:   ace.Sid,
+		}
+	}
+
+	return res
+}
+
+func (self *Security) GetOwner() string { return core.FormatSid(self.Owner) }
+func (self *Security) String() string   { return self.GetDescriptor().String() }
+
+// Matches the owner SID, or the name of a well-known owner.
+func (self *Security) MatchOwner(match func(string) bool) bool {
+	if match(self.Owner) {
+		return true
+	}
+
+	name := core.SidName(self.Owner)
+
+	return (len(name) > 0) && match(name)
+}
+
+// Writes the security descriptor of a saved file into the sidecar file `{name}.acl`.
+func save_acl(file *File, destname string, report *SaveReport) error {
+	if file.Security == nil {
+		return nil
+	}
+
+	lines := []string{fmt.Sprintf("File: %s", file.Name)}
+	if file.Security.Id != 0 {
+		lines = append(lines, fmt.Sprintf("Security ID: %d", file.Security.Id))
+	}
+
+	lines = append(lines, file.Security.GetDescriptor().Lines()...)
+	content := strings.Join(lines, "\n") + "\n"
+
+	if err := ioutil.WriteFile(destname+".acl", []byte(content), 0660); err != nil {
+		return core.WrapError(err)
+	}
+
+	if report != nil {
+		report.Acls++
+	}
+
+	return nil
+}
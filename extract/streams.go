@@ -0,0 +1,202 @@
+package extract
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/corebreaker/ntfstool/core"
+)
+
+// How the alternate data streams are saved.
+type StreamMode int
+
+const (
+	STREAMS_SIDECAR StreamMode = iota
+	STREAMS_XATTR
+	STREAMS_NONE
+)
+
+// Default name of the sidecar files, `{file}` is the path of the saved file and `{stream}` the name of the stream.
+const DEFAULT_STREAM_NAME = "{file}:{stream}"
+
+func ParseStreamMode(mode string) (StreamMode, error) {
+	switch mode {
+	case "", "sidecar":
+		return STREAMS_SIDECAR, nil
+
+	case "xattr":
+		return STREAMS_XATTR, nil
+
+	case "none":
+		return STREAMS_NONE, nil
+	}
+
+	return STREAMS_NONE, core.WrapError(fmt.Errorf("Bad stream mode `%s` (sidecar, xattr or none are expected)", mode))
+}
+
+// Name of the sidecar file of the stream `name` of the file saved at `path`.
+func MakeStreamName(format, path, name string) string {
+	if len(format) == 0 {
+		format = DEFAULT_STREAM_NAME
+	}
+
+	name = strings.NewReplacer("/", "_", "\\", "_").Replace(name)
+
+	return strings.NewReplacer("{file}", path, "{stream}", name).Replace(format)
+}
+
+// Content of a resident stream.
+type StreamData []byte
+
+func (self StreamData) String() string {
+	return fmt.Sprintf("%d bytes", len(self))
+}
+
+// Named $DATA attribute of a file, the content of a resident stream is kept in the file node.
+type Stream struct {
+	Name        string
+	Size        uint64
+	Allocated   uint64
+	Compression int64
+	RunList     core.RunList
+	Data        StreamData
+
+	// Size of the data after the initialized size, they are read as zeros
+	Uninitialized uint64
+}
+
+func (self *Stream) IsResident() bool {
+	return len(self.RunList) == 0
+}
+
+func (self *Stream) GetReader(from_disk *core.DiskIO) *core.AttributeReader {
+	if self.IsResident() {
+		return core.NewResidentReader(self.Data)
+	}
+
+	initialized := int64(self.Size - self.Uninitialized)
+
+	return core.NewAttributeReader(from_disk, self.RunList, int64(self.Size), initialized, self.Compression)
+}
+
+func (self *Stream) String() string {
+	return fmt.Sprintf("%s (size= %d, allocated= %d)", self.Name, self.Size, self.Allocated)
+}
+
+// In-memory destination of a stream, for the extended attributes.
+type tMemoryWriter struct {
+	data []byte
+	pos  int64
+}
+
+func (self *tMemoryWriter) Write(data []byte) (int, error) {
+	if end := self.pos + int64(len(data)); end > int64(len(self.data)) {
+		self.Truncate(end)
+	}
+
+	copy(self.data[self.pos:], data)
+	self.pos += int64(len(data))
+
+	return len(data), nil
+}
+
+func (self *tMemoryWriter) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+		self.pos = offset
+
+	case io.SeekCurrent:
+		self.pos += offset
+
+	case io.SeekEnd:
+		self.pos = int64(len(self.data)) + offset
+	}
+
+	return self.pos, nil
+}
+
+func (self *tMemoryWriter) Truncate(size int64) error {
+	if size <= int64(len(self.data)) {
+		self.data = self.data[:size]
+	} else {
+		self.data = append(self.data, make([]byte, size-int64(len(self.data)))...)
+	}
+
+	return nil
+}
+
+func write_stream(from_disk *core.DiskIO, stream *Stream, dest tDataWriter) (int64, error) {
+	_, zero_filled, err := write_reader(dest, stream.GetReader(from_disk), from_disk.GetGeometry().ClusterSize)
+
+	return zero_filled, err
+}
+
+// Saves the alternate data streams of the file saved at `path`, as sidecar files or as extended attributes.
+func save_streams(from_disk *core.DiskIO, file *File, path string, options *SaveOptions, report *SaveReport) error {
+	if options.Streams == STREAMS_NONE {
+		return nil
+	}
+
+	_, wof_stream, _ := file.GetWof()
+
+	for _, stream := range file.Streams {
+		// The compressed stream of a WOF compressed file is saved as the content of the file
+		if stream == wof_stream {
+			continue
+		}
+
+		// A stream too big for an extended attribute is saved as a sidecar file, it's not read in memory
+		as_xattr := options.Streams == STREAMS_XATTR
+		if as_xattr && (stream.Size > XATTR_MAX_SIZE) {
+			const msg = "    Warning: the stream %s is too big for an extended attribute (size= %d), it's saved as a file"
+
+			fmt.Println(fmt.Sprintf(msg, stream.Name, stream.Size))
+			as_xattr = false
+		}
+
+		if as_xattr {
+			fmt.Println(fmt.Sprintf("    + %s%s (size= %d)", XATTR_PREFIX, stream.Name, stream.Size))
+
+			dest := new(tMemoryWriter)
+			zero_filled, err := write_stream(from_disk, stream, dest)
+			if err != nil {
+				return err
+			}
+
+			// The size of the extended attributes can be limited more by the file system, a stream too big is skipped
+			if err := set_xattr(path, XATTR_PREFIX+stream.Name, dest.data); err != nil {
+				fmt.Println(fmt.Sprintf("    Warning: the stream %s is not saved: %v", stream.Name, core.GetSource(err)))
+
+				continue
+			}
+
+			report.add_damaged(path+":"+stream.Name, zero_filled)
+		} else {
+			name := MakeStreamName(options.StreamName, path, stream.Name)
+			fmt.Println(fmt.Sprintf("    + %s (size= %d)", name, stream.Size))
+
+			dest, err := core.OpenFile(name, core.OPEN_WRONLY)
+			if err != nil {
+				return err
+			}
+
+			zero_filled, err := write_stream(from_disk, stream, dest)
+			if close_err := dest.Close(); err == nil {
+				err = core.WrapError(close_err)
+			}
+
+			if err != nil {
+				return err
+			}
+
+			report.add_damaged(name, zero_filled)
+		}
+
+		if report != nil {
+			report.Streams++
+		}
+	}
+
+	return nil
+}
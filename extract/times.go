@@ -0,0 +1,71 @@
+package extract
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/corebreaker/ntfstool/core"
+)
+
+// Timestamps of $STANDARD_INFORMATION or of $FILE_NAME, in the NTFS format (100 ns since 1601).
+type Times struct {
+	Creation     uint64
+	Modification uint64
+	Change       uint64
+	Access       uint64
+}
+
+func MakeTimes(creation, modification, change, access core.Timestamp) *Times {
+	return &Times{
+		Creation:     uint64(creation),
+		Modification: uint64(modification),
+		Change:       uint64(change),
+		Access:       uint64(access),
+	}
+}
+
+func (self *Times) IsZero() bool {
+	return (self == nil) || ((self.Creation | self.Modification | self.Change | self.Access) == 0)
+}
+
+func (self *Times) String() string {
+	const msg = "created= %s, modified= %s, changed= %s, accessed= %s"
+
+	return fmt.Sprintf(msg, format_time(self.Creation), format_time(self.Modification), format_time(self.Change), format_time(self.Access))
+}
+
+func get_time(value uint64) time.Time {
+	return core.Timestamp(value).Time().UTC()
+}
+
+// Time in the RFC 3339 format, or an empty string for a missing time.
+func format_time(value uint64) string {
+	if value == 0 {
+		return ""
+	}
+
+	return get_time(value).Format(time.RFC3339Nano)
+}
+
+// Sets the modification and the access times of a saved file or directory, those of $STANDARD_INFORMATION
+// are used, or else those of $FILE_NAME.
+func apply_times(file *File, path string) {
+	times := file.Times
+	if times.IsZero() {
+		times = file.NameTimes
+	}
+
+	if times.IsZero() {
+		return
+	}
+
+	modification, access := times.Modification, times.Access
+	if access == 0 {
+		access = modification
+	}
+
+	if err := os.Chtimes(path, get_time(access), get_time(modification)); err != nil {
+		fmt.Println(fmt.Sprintf("    Warning: the times of %s can not be set: %v", path, err))
+	}
+}
@@ -17,6 +17,10 @@ type Node struct {
 }
 
 func (self *Node) IsEmpty(nometa bool) bool {
+	if self.File.IsLink() {
+		return false
+	}
+
 	if self.IsFile() {
 		return self.File.Size == 0
 	}
@@ -76,6 +80,26 @@ func (self *Node) AddFile(f *File) *Node {
 	return n
 }
 
+// Child with the name `name`, the names are compared as NTFS does with the upper case table `upcase`
+// (nil to compare them exactly).
+func (self *Node) FindChild(name string, upcase core.UpCase) *Node {
+	if res, ok := self.Children[name]; ok {
+		return res
+	}
+
+	if upcase == nil {
+		return nil
+	}
+
+	for _, n := range self.Children {
+		if upcase.Equal(n.File.Name, name) {
+			return n
+		}
+	}
+
+	return nil
+}
+
 func (self *Node) remove(n *Node) {
 	delete(self.Children, n.File.Name)
 }
@@ -131,6 +155,16 @@ func (self *Tree) GetFilePath(file *File) string {
 	return self.get_node_path(self.Nodes[file.Id], "")
 }
 
+// Paths of all the hard links of a file, the path of its name is the first.
+func (self *Tree) GetFilePaths(file *File) []string {
+	res := []string{self.GetFilePath(file)}
+	for _, link := range file.Links {
+		res = append(res, self.get_node_path(self.Nodes[link.Parent], link.Name))
+	}
+
+	return res
+}
+
 func (self *Tree) GetFilePathFromFile(file IFile) string {
 	return self.get_node_path(self.Nodes[file.GetId()], "")
 }
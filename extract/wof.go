@@ -0,0 +1,29 @@
+package extract
+
+import (
+	"github.com/corebreaker/ntfstool/core"
+)
+
+// Writes the decompressed content of a file compressed by the Windows Overlay Filter,
+// it returns the written size and the size of the zero-filled regions of the compressed stream.
+func write_wof(from_disk *core.DiskIO, dest tDataWriter, file *File, format core.WofFormat, stream *Stream) (int64, int64, error) {
+	compressed := stream.GetReader(from_disk)
+
+	size := int64(0)
+	err := core.DecompressWof(compressed, compressed.Size(), format, int64(file.Size), func(data []byte) error {
+		cnt, err := write_block(dest, data)
+		size += int64(cnt)
+
+		return err
+	})
+
+	if err != nil {
+		return 0, 0, err
+	}
+
+	if err := dest.Truncate(size); err != nil {
+		return 0, 0, core.WrapError(err)
+	}
+
+	return size, compressed.GetBadSize(), nil
+}
@@ -0,0 +1,19 @@
+// +build linux
+
+package extract
+
+import (
+	"syscall"
+
+	"github.com/corebreaker/ntfstool/core"
+)
+
+// Namespace of the extended attributes made from the alternate data streams.
+const XATTR_PREFIX = "user."
+
+// Maximal size of the value of an extended attribute (XATTR_SIZE_MAX), a file system can have a lower limit.
+const XATTR_MAX_SIZE = 64 * 1024
+
+func set_xattr(path, name string, value []byte) error {
+	return core.WrapError(syscall.Setxattr(path, name, value, 0))
+}
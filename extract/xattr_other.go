@@ -0,0 +1,19 @@
+// +build !linux
+
+package extract
+
+import (
+	"fmt"
+
+	"github.com/corebreaker/ntfstool/core"
+)
+
+// Namespace of the extended attributes made from the alternate data streams.
+const XATTR_PREFIX = "user."
+
+// No extended attribute is made, the streams are saved as sidecar files.
+const XATTR_MAX_SIZE = 0
+
+func set_xattr(path, name string, value []byte) error {
+	return core.WrapError(fmt.Errorf("The extended attributes are only supported on Linux, `%s` is not saved", name))
+}
@@ -0,0 +1,222 @@
+package inspect
+
+import (
+	"fmt"
+	"math/rand"
+	"time"
+
+	"github.com/corebreaker/ntfstool/core"
+)
+
+const _MAX_CLUSTER_SIZE = 2 * 1024 * 1024
+
+type tMftCandidate struct {
+	position     int64
+	cluster_size int64
+	mft_lcn      int64
+	record_size  int64
+}
+
+func is_power_of_two(value int64) bool {
+	return (value > 0) && ((value & (value - 1)) == 0)
+}
+
+// Encodes a size as in the boot sector: a count of clusters or a negative power of two.
+func encode_block_size(size, cluster_size int64) uint32 {
+	if size >= cluster_size {
+		return uint32(size / cluster_size)
+	}
+
+	shift := uint32(0)
+	for (int64(1) << shift) < size {
+		shift++
+	}
+
+	return uint32(uint8(-int8(shift)))
+}
+
+func read_first_data_run(disk *core.DiskIO, position int64) (*core.FileRecord, *core.AttributeDesc, error) {
+	record := new(core.FileRecord)
+
+	if err := disk.ReadStructAt(position, record); err != nil {
+		return nil, nil, err
+	}
+
+	if record.Type != core.RECTYP_FILE {
+		return record, nil, nil
+	}
+
+	attrs := record.GetAttributeFilteredList(core.ATTR_DATA)
+	if len(attrs) == 0 {
+		return record, nil, nil
+	}
+
+	desc, err := record.MakeAttributeFromOffset(attrs[0])
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return record, desc, nil
+}
+
+func get_first_lcn(desc *core.AttributeDesc) int64 {
+	if (desc == nil) || (!desc.Header.NonResident.Value()) {
+		return 0
+	}
+
+	for _, run := range desc.GetRunList() {
+		if !run.Zero {
+			return int64(run.Start)
+		}
+	}
+
+	return 0
+}
+
+func find_mft_candidate(disk *core.DiskIO, position int64) (*tMftCandidate, error) {
+	record, desc, err := read_first_data_run(disk, position)
+	if (err != nil) || (desc == nil) {
+		return nil, err
+	}
+
+	if (record.MftRecordNumber != 0) || (record.BaseFileRecord != 0) {
+		return nil, nil
+	}
+
+	// The $MFT record describes its own position: the cluster size is given by its first LCN
+	lcn := get_first_lcn(desc)
+	if (lcn <= 0) || ((position % lcn) != 0) {
+		return nil, nil
+	}
+
+	cluster_size := position / lcn
+	if (!is_power_of_two(cluster_size)) || (cluster_size < core.DEFAULT_SECTOR_SIZE) || (cluster_size > _MAX_CLUSTER_SIZE) {
+		return nil, nil
+	}
+
+	record_size := int64(record.BytesAllocated)
+	if !is_power_of_two(record_size) {
+		return nil, nil
+	}
+
+	next, _, err := read_first_data_run(disk, position+record_size)
+	if (err != nil) || (next.Type != core.RECTYP_FILE) || (next.MftRecordNumber != 1) {
+		return nil, err
+	}
+
+	res := &tMftCandidate{
+		position:     position,
+		cluster_size: cluster_size,
+		mft_lcn:      lcn,
+		record_size:  record_size,
+	}
+
+	return res, nil
+}
+
+// Derives a boot sector from the $MFT record found in the positions of scanned MFT records.
+func RebuildBootBlock(disk *core.DiskIO, positions []int64, sector_size int64) (*core.BootBlock, error) {
+	if sector_size <= 0 {
+		sector_size = core.DEFAULT_SECTOR_SIZE
+	}
+
+	var mft *tMftCandidate
+
+	for _, position := range positions {
+		candidate, err := find_mft_candidate(disk, position)
+		if err != nil {
+			return nil, err
+		}
+
+		if candidate != nil {
+			mft = candidate
+			break
+		}
+	}
+
+	if mft == nil {
+		return nil, core.WrapError(fmt.Errorf("No $MFT record found in the scanned records"))
+	}
+
+	fmt.Println(fmt.Sprintf("$MFT record found at %d: cluster size=%d, MFT LCN=%d, record size=%d", mft.position, mft.cluster_size, mft.mft_lcn, mft.record_size))
+
+	_, mirror, err := read_first_data_run(disk, mft.position+mft.record_size)
+	if err != nil {
+		return nil, err
+	}
+
+	mirror_lcn := get_first_lcn(mirror)
+	fmt.Println("$MFTMirr LCN:", mirror_lcn)
+
+	index_size := int64(core.DEFAULT_INDEX_SIZE)
+
+	root := new(core.FileRecord)
+	if err := disk.ReadStructAt(mft.position+(core.FILEIDX_ROOT*mft.record_size), root); (err == nil) && (root.Type == core.RECTYP_FILE) {
+		if attrs := root.GetAttributeFilteredList(core.ATTR_INDEX_ROOT); len(attrs) > 0 {
+			if desc, err := root.MakeAttributeFromOffset(attrs[0]); err == nil {
+				if value, err := desc.GetValue(nil); (err == nil) && (value != nil) {
+					if index_root, ok := value.Value.(*core.IndexRootAttribute); ok && is_power_of_two(int64(index_root.BytesPerIndexBlock)) {
+						index_size = int64(index_root.BytesPerIndexBlock)
+					}
+				}
+			}
+		}
+	}
+
+	fmt.Println("Index block size:", index_size)
+
+	sectors_per_cluster := mft.cluster_size / sector_size
+	total_sectors := (disk.GetSize() / sector_size) - 1
+
+	_, bitmap, err := read_first_data_run(disk, mft.position+(core.FILEIDX_BITMAP*mft.record_size))
+	if err != nil {
+		return nil, err
+	}
+
+	if bitmap != nil {
+		// The bitmap has a bit per cluster, rounded up to 8 bytes
+		bitmap_sectors := int64(bitmap.GetSize()) * 8 * sectors_per_cluster
+		if (bitmap_sectors > 0) && (total_sectors > bitmap_sectors) {
+			fmt.Println("The disk is bigger than the volume, the total sectors is approximated from $Bitmap")
+			total_sectors = bitmap_sectors - 1
+		}
+	}
+
+	fmt.Println("Total sectors:", total_sectors)
+
+	spc := uint8(sectors_per_cluster)
+	if sectors_per_cluster > 0x80 {
+		shift := uint(0)
+		for (int64(1) << shift) < sectors_per_cluster {
+			shift++
+		}
+
+		spc = uint8(256 - shift)
+	}
+
+	res := &core.BootBlock{
+		Jump:                  [3]core.Byte{0xEB, 0x52, 0x90},
+		BytesPerSector:        uint16(sector_size),
+		SectorsPerCluster:     spc,
+		MediaType:             0xF8,
+		SectorsPerTrack:       63,
+		NumberOfHeads:         255,
+		PartitionOffset:       uint32(disk.GetOffset() / sector_size),
+		Reserved2:             [2]uint32{0, 0x00800080},
+		TotalSectors:          uint64(total_sectors),
+		MftStartLcn:           core.ClusterNumber(mft.mft_lcn),
+		Mft2StartLcn:          core.ClusterNumber(mirror_lcn),
+		ClustersPerFileRecord: encode_block_size(mft.record_size, mft.cluster_size),
+		ClustersPerIndexBlock: encode_block_size(index_size, mft.cluster_size),
+		VolumeSerialNumber:    uint64(rand.New(rand.NewSource(time.Now().UnixNano())).Int63()),
+		BootSignature:         core.BOOT_SIGNATURE,
+	}
+
+	copy(res.Format[:], "NTFS    ")
+
+	if !res.IsValid() {
+		return nil, core.WrapError(fmt.Errorf("The rebuilt boot sector is not consistent"))
+	}
+
+	return res, nil
+}
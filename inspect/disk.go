@@ -1,6 +1,10 @@
 package inspect
 
 import (
+	"fmt"
+	"sort"
+	"strings"
+
 	"github.com/corebreaker/ntfstool/core"
 	"github.com/corebreaker/ntfstool/core/data"
 )
@@ -9,12 +13,123 @@ type NtfsDisk struct {
 	disk      *core.DiskIO
 	mft_rl    core.RunList
 	mft_shift int64
+	override  *core.Geometry
+	bitmap    *core.ClusterBitmap
+	attrdefs  core.AttrDefs
+	upcase    core.UpCase
+	boot      *core.BootBlock
+	boot_rl   core.RunList
+}
+
+func (self *NtfsDisk) load_geometry() error {
+	geometry := core.DefaultGeometry()
+
+	self.boot = nil
+
+	boot, position, err := core.FindBootBlock(self.disk)
+	if (err == nil) && boot.IsValid() {
+		if position != 0 {
+			fmt.Println(fmt.Sprintf("Warning: the primary boot sector is invalid, the backup at offset %d is used", position))
+		}
+
+		self.boot = boot
+		if boot_geometry, err := boot.GetGeometry(); err == nil {
+			geometry = boot_geometry
+		}
+	}
+
+	geometry = geometry.Merge(self.override)
+	if err := geometry.Check(); err != nil {
+		return err
+	}
+
+	self.disk.SetGeometry(geometry)
+
+	// A cluster is read as a single block of the cache
+	if cache := core.FindCache(self.disk.GetSource()); cache != nil {
+		cache.SetBlockSize(geometry.ClusterSize)
+	}
+
+	return nil
+}
+
+// Positions of the first MFT records, from the MFT run list or else from the boot sector.
+func (self *NtfsDisk) read_metafile_record(index int64, record *core.FileRecord) error {
+	if self.mft_rl != nil {
+		return self.ReadFileRecord(index, record)
+	}
+
+	boot := self.boot
+	if boot == nil {
+		return core.WrapError(fmt.Errorf("No valid boot sector to locate the MFT, use the `mft` parameter"))
+	}
+
+	geometry := self.disk.GetGeometry()
+	start := int64(boot.MftStartLcn) * geometry.ClusterSize
+
+	// The first records are in the first extent of $MFT, the other ones are found with the run list of $MFT
+	if index < core.FILEIDX_FIRST_USER {
+		return self.disk.ReadStructAt(start+(index*geometry.RecordSize), record)
+	}
+
+	if self.boot_rl == nil {
+		var mft core.FileRecord
+
+		if err := self.disk.ReadStructAt(start, &mft); err != nil {
+			return err
+		}
+
+		data_attrs := mft.GetAttributeFilteredList(core.ATTR_DATA)
+		if (mft.Type != core.RECTYP_FILE) || (len(data_attrs) == 0) {
+			return core.WrapError(fmt.Errorf("No $MFT at the position given by the boot sector, use the `mft` parameter"))
+		}
+
+		data_attr, err := mft.MakeAttributeFromOffset(data_attrs[0])
+		if err != nil {
+			return err
+		}
+
+		self.boot_rl = data_attr.GetRunList()
+	}
+
+	offset := index * geometry.RecordSize
+	for _, run := range self.boot_rl {
+		size := run.Count * geometry.ClusterSize
+		if offset < size {
+			if run.Zero {
+				break
+			}
+
+			return self.disk.ReadStructAt((int64(run.Start)*geometry.ClusterSize)+offset, record)
+		}
+
+		offset -= size
+	}
+
+	return core.WrapError(fmt.Errorf("The record %d is not found with the run list of $MFT, use the `mft` parameter", index))
+}
+
+// Record of a file, located by the boot sector when the MFT is not given.
+func (self *NtfsDisk) read_record(index int64, record *core.FileRecord) error {
+	if self.mft_rl != nil {
+		return self.ReadFileRecord(index, record)
+	}
+
+	return self.read_metafile_record(index, record)
+}
+
+func (self *NtfsDisk) get_mft_position() int64 {
+	geometry := self.disk.GetGeometry()
+
+	return geometry.SectorOf(self.mft_shift) * geometry.SectorSize
 }
 
 func (self *NtfsDisk) fill_runlist() error {
 	var mft core.FileRecord
 
-	if err := self.disk.ReadStruct((self.mft_shift+511)/512, &mft); err != nil {
+	self.mft_rl = nil
+
+	if err := self.disk.ReadStructAt(self.get_mft_position(), &mft); err != nil {
 		return err
 	}
 
@@ -34,56 +149,421 @@ func (self *NtfsDisk) fill_runlist() error {
 
 	self.mft_rl = data_attr.GetRunList()
 
+	// The extension records of $MFT are located with the run list of its first extent
+	attrs, err := self.GetFileAttributes(&mft, core.ATTR_DATA)
+	if err != nil {
+		fmt.Println("Warning: the extents of $MFT can not be read:", err)
+
+		return nil
+	}
+
+	if data_attr := find_unnamed(attrs); data_attr != nil {
+		self.mft_rl = data_attr.GetRunList()
+	}
+
 	return nil
 }
 
-func (self *NtfsDisk) get_file_sector(index int64) int64 {
+func find_unnamed(attrs []*core.AttributeDesc) *core.AttributeDesc {
+	for _, attr := range attrs {
+		if attr.Name == "" {
+			return attr
+		}
+	}
+
+	return nil
+}
+
+// Entries of the $ATTRIBUTE_LIST of a file, nil if the file has no attribute list.
+func (self *NtfsDisk) GetAttributeList(record *core.FileRecord) ([]*core.AttributeListEntry, error) {
+	attrs := record.GetAttributeFilteredList(core.ATTR_ATTRIBUTE_LIST)
+	if len(attrs) == 0 {
+		return nil, nil
+	}
+
+	list, err := record.MakeAttributeFromOffset(attrs[0])
+	if err != nil {
+		return nil, err
+	}
+
+	value, err := list.GetValue(self.disk)
+	if (err != nil) || (value == nil) {
+		return nil, err
+	}
+
+	return core.ParseAttributeList(value.Content), nil
+}
+
+// Attributes of a file, with the ones stored in its extension records when it has an $ATTRIBUTE_LIST,
+// a non-resident attribute in several extents is returned once with the run list of all its extents.
+func (self *NtfsDisk) GetFileAttributes(record *core.FileRecord, types ...core.AttributeType) ([]*core.AttributeDesc, error) {
+	entries, err := self.GetAttributeList(record)
+	if err != nil {
+		return nil, err
+	}
+
+	attrs := make([]*core.AttributeDesc, 0)
+
+	if entries == nil {
+		headers, err := record.GetAttributes(false)
+		if err != nil {
+			return nil, err
+		}
+
+		offsets := make([]int, 0, len(headers))
+		for offset := range headers {
+			offsets = append(offsets, offset)
+		}
+
+		sort.Ints(offsets)
+
+		for _, offset := range offsets {
+			desc, err := record.MakeAttributeFromOffset(offset)
+			if err != nil {
+				return nil, err
+			}
+
+			attrs = append(attrs, desc)
+		}
+	} else {
+		base := data.FileIndex(record.MftRecordNumber)
+		records := map[data.FileIndex]*core.FileRecord{base: record}
+
+		for _, entry := range entries {
+			idx := entry.GetFileRef().GetFileIndex()
+
+			ext, ok := records[idx]
+			if !ok {
+				ext = new(core.FileRecord)
+				if err := self.read_record(int64(idx), ext); err != nil {
+					return nil, err
+				}
+
+				if (ext.Type != core.RECTYP_FILE) || (data.FileRef(ext.BaseFileRecord).GetFileIndex() != base) {
+					fmt.Println(fmt.Sprintf("Warning: the record %d is not an extension of the record %d", idx, base))
+
+					ext = nil
+				}
+
+				records[idx] = ext
+			}
+
+			if ext == nil {
+				continue
+			}
+
+			header := &core.AttributeHeader{AttributeType: entry.AttributeType, AttributeNumber: entry.AttributeNumber}
+
+			desc, err := ext.MakeAttributeFromHeader(header)
+			if err != nil {
+				fmt.Println(fmt.Sprintf("Warning: the attribute %s is not found in the record %d", entry, idx))
+
+				continue
+			}
+
+			attrs = append(attrs, desc)
+		}
+	}
+
+	attrs, err = core.MergeAttributes(attrs)
+	if (err != nil) || (len(types) == 0) {
+		return attrs, err
+	}
+
+	filter := core.MakeAttributeTypeFilter(types[0], types[1:])
+	res := make([]*core.AttributeDesc, 0, len(attrs))
+
+	for _, attr := range attrs {
+		if filter[attr.Header.AttributeType] {
+			res = append(res, attr)
+		}
+	}
+
+	return res, nil
+}
+
+// Security descriptors of the partition, from the metafile $Secure.
+func (self *NtfsDisk) GetSecure() (*core.Secure, error) {
+	var record core.FileRecord
+
+	if err := self.read_metafile_record(core.SECURE_FILE_NUMBER, &record); err != nil {
+		return nil, err
+	}
+
+	attrs, err := self.GetFileAttributes(&record, core.ATTR_DATA, core.ATTR_INDEX_ROOT, core.ATTR_INDEX_ALLOCATION)
+	if err != nil {
+		return nil, err
+	}
+
+	return core.LoadSecure(self.disk, attrs)
+}
+
+// Content of the unnamed $DATA of a metafile.
+func (self *NtfsDisk) read_metafile_data(index int64, name string) ([]byte, error) {
+	var record core.FileRecord
+
+	if err := self.read_metafile_record(index, &record); err != nil {
+		return nil, err
+	}
+
+	if record.Type != core.RECTYP_FILE {
+		return nil, core.WrapError(fmt.Errorf("The MFT record of %s is not found", name))
+	}
+
+	data_attrs, err := self.GetFileAttributes(&record, core.ATTR_DATA)
+	if err != nil {
+		return nil, err
+	}
+
+	desc := find_unnamed(data_attrs)
+	if desc == nil {
+		return nil, core.WrapError(fmt.Errorf("No data in the MFT record of %s", name))
+	}
+
+	value, err := desc.GetValue(self.disk)
+	if err != nil {
+		return nil, err
+	}
+
+	if (value == nil) || (value.Content == nil) {
+		return nil, core.WrapError(fmt.Errorf("The content of %s can not be read", name))
+	}
+
+	return value.Content, nil
+}
+
+// Attribute definitions of the volume, loaded from $AttrDef.
+func (self *NtfsDisk) GetAttrDefs() (core.AttrDefs, error) {
+	if self.attrdefs != nil {
+		return self.attrdefs, nil
+	}
+
+	content, err := self.read_metafile_data(core.FILEIDX_ATTRDEF, "$AttrDef")
+	if err != nil {
+		return nil, err
+	}
+
+	defs, err := core.ParseAttrDefs(content)
+	if err != nil {
+		return nil, err
+	}
+
+	self.attrdefs = defs
+
+	return defs, nil
+}
+
+// Upper case table of the volume, loaded from $UpCase.
+func (self *NtfsDisk) GetUpCase() (core.UpCase, error) {
+	if self.upcase != nil {
+		return self.upcase, nil
+	}
+
+	content, err := self.read_metafile_data(core.FILEIDX_UPCASE, "$UpCase")
+	if err != nil {
+		return nil, err
+	}
+
+	table, err := core.ParseUpCase(content)
+	if err != nil {
+		return nil, err
+	}
+
+	self.upcase = table
+
+	return table, nil
+}
+
+// Finds a file from its path in the directory tree of the volume, each name is found in the index of its directory.
+func (self *NtfsDisk) LookupPath(path string, upcase core.UpCase) (data.FileRef, error) {
+	var record core.FileRecord
+
+	if err := self.read_metafile_record(core.FILEIDX_ROOT, &record); err != nil {
+		return 0, err
+	}
+
+	ref := data.MakeFileRef(record.SequenceNumber, data.FileIndex(core.FILEIDX_ROOT))
+
+	for _, name := range strings.FieldsFunc(path, func(c rune) bool { return (c == '/') || (c == '\\') }) {
+		if !record.IsDir() {
+			return 0, core.WrapError(fmt.Errorf("The file %d is not a directory, `%s` can not be found in it", ref.GetFileIndex(), name))
+		}
+
+		attrs, err := self.GetFileAttributes(&record, core.ATTR_INDEX_ROOT, core.ATTR_INDEX_ALLOCATION)
+		if err != nil {
+			return 0, err
+		}
+
+		entry, err := core.FindIndexEntry(self.disk, attrs, name, upcase)
+		if err != nil {
+			return 0, err
+		}
+
+		if entry == nil {
+			return 0, core.WrapError(fmt.Errorf("`%s` is not found in the directory %d", name, ref.GetFileIndex()))
+		}
+
+		ref = entry.FileReferenceNumber
+		if err := self.ReadFileRecordFromRef(ref, &record); err != nil {
+			return 0, err
+		}
+	}
+
+	return ref, nil
+}
+
+// Security descriptor of a file and its security ID, $Secure is only read if the file has no inline descriptor.
+func (self *NtfsDisk) GetFileSecurity(record *core.FileRecord) (*core.SecurityDescriptor, uint32, error) {
+	attrs, err := self.GetFileAttributes(record, core.ATTR_STANDARD_INFORMATION, core.ATTR_SECURITY_DESCRIPTOR)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	res, id, err := core.GetFileSecurity(self.disk, nil, attrs)
+	if (err != nil) || (res != nil) || (id == 0) {
+		return res, id, err
+	}
+
+	secure, err := self.GetSecure()
+	if err != nil {
+		return nil, id, err
+	}
+
+	return core.GetFileSecurity(self.disk, secure, attrs)
+}
+
+func (self *NtfsDisk) get_file_position(index int64) int64 {
 	if index == 0 {
-		return (self.mft_shift + 511) / 512
+		return self.get_mft_position()
 	}
 
+	geometry := self.disk.GetGeometry()
+	offset := index * geometry.RecordSize
+
 	if self.mft_rl != nil {
 		start := int64(0)
 		for _, run := range self.mft_rl {
-			end := start + (run.Count * 4)
+			end := start + (run.Count * geometry.ClusterSize)
 
-			if (start <= index) && (index < end) {
-				return (int64(run.Start) * 8) + ((index - start) * 2)
+			if (start <= offset) && (offset < end) {
+				return (int64(run.Start) * geometry.ClusterSize) + (offset - start)
 			}
 
 			start = end
 		}
 	}
 
-	return index * 2
+	return offset
 }
 
 func (self *NtfsDisk) FindIndex(position int64) data.FileIndex {
-	fpos := data.FileIndex((position + 1023) / 1024)
+	geometry := self.disk.GetGeometry()
+	fpos := ((position + geometry.RecordSize - 1) / geometry.RecordSize) * geometry.RecordSize
+
 	if self.mft_rl == nil {
-		return fpos
+		return data.FileIndex(fpos / geometry.RecordSize)
 	}
 
-	vidx := data.FileIndex(0)
+	vpos := int64(0)
 	for _, run := range self.mft_rl {
-		start, end := data.FileIndex(run.Start)*4, data.FileIndex(run.GetNext())*4
+		start, end := int64(run.Start)*geometry.ClusterSize, int64(run.GetNext())*geometry.ClusterSize
 
 		if (start <= fpos) && (fpos < end) {
-			return vidx + (fpos - start)
+			return data.FileIndex((vpos + (fpos - start)) / geometry.RecordSize)
 		}
 
-		vidx += data.FileIndex(run.Count) * 4
+		vpos += run.Count * geometry.ClusterSize
 	}
 
 	return data.FileIndex(0)
 }
 
+// Cluster allocation map of the volume, loaded from $Bitmap.
+func (self *NtfsDisk) GetBitmap() (*core.ClusterBitmap, error) {
+	if self.bitmap != nil {
+		return self.bitmap, nil
+	}
+
+	var record core.FileRecord
+
+	if err := self.read_metafile_record(core.FILEIDX_BITMAP, &record); err != nil {
+		return nil, err
+	}
+
+	if record.Type != core.RECTYP_FILE {
+		return nil, core.WrapError(fmt.Errorf("The MFT record of $Bitmap is not found"))
+	}
+
+	data_attrs, err := self.GetFileAttributes(&record, core.ATTR_DATA)
+	if err != nil {
+		return nil, err
+	}
+
+	desc := find_unnamed(data_attrs)
+	if desc == nil {
+		return nil, core.WrapError(fmt.Errorf("No data in the MFT record of $Bitmap"))
+	}
+
+	value, err := desc.GetValue(self.disk)
+	if err != nil {
+		return nil, err
+	}
+
+	if (value == nil) || (value.Content == nil) {
+		return nil, core.WrapError(fmt.Errorf("The content of $Bitmap can not be read"))
+	}
+
+	clusters := int64(0)
+	if self.boot != nil {
+		geometry := self.disk.GetGeometry()
+		clusters = int64(self.boot.TotalSectors) * geometry.SectorSize / geometry.ClusterSize
+	}
+
+	self.bitmap = core.NewClusterBitmap(value.Content, clusters)
+
+	return self.bitmap, nil
+}
+
+func (self *NtfsDisk) IsAllocated(lcn core.ClusterNumber, count int64) (bool, error) {
+	bitmap, err := self.GetBitmap()
+	if err != nil {
+		return false, err
+	}
+
+	return bitmap.IsRangeAllocated(lcn, count), nil
+}
+
+// Valid boot sector of the volume (primary or backup), nil if there is none.
+func (self *NtfsDisk) GetBootBlock() *core.BootBlock {
+	return self.boot
+}
+
+func (self *NtfsDisk) GetGeometry() *core.Geometry {
+	return self.disk.GetGeometry()
+}
+
+func (self *NtfsDisk) SetGeometryOverride(geometry *core.Geometry) error {
+	self.override = geometry
+	self.bitmap = nil
+
+	if err := self.load_geometry(); err != nil {
+		return err
+	}
+
+	return self.fill_runlist()
+}
+
 func (self *NtfsDisk) GetDisk() *core.DiskIO {
 	return self.disk.Shift(0)
 }
 
 func (self *NtfsDisk) SetStart(start int64) error {
 	self.disk.SetOffset(start)
+	self.bitmap = nil
+
+	if err := self.load_geometry(); err != nil {
+		return err
+	}
 
 	return self.fill_runlist()
 }
@@ -95,7 +575,7 @@ func (self *NtfsDisk) SetMftShift(shift int64) error {
 }
 
 func (self *NtfsDisk) ReadRecordHeader(index int64, header *core.RecordHeader) error {
-	return self.disk.ReadStruct(((self.mft_shift+511)/512)+(index*2), header)
+	return self.disk.ReadStructAt(self.get_mft_position()+(index*self.disk.GetGeometry().RecordSize), header)
 }
 
 func (self *NtfsDisk) ReadRecordHeaderFromRef(ref data.FileRef, header *core.RecordHeader) error {
@@ -103,7 +583,7 @@ func (self *NtfsDisk) ReadRecordHeaderFromRef(ref data.FileRef, header *core.Rec
 }
 
 func (self *NtfsDisk) ReadFileRecord(index int64, record *core.FileRecord) error {
-	return self.disk.ReadStruct(self.get_file_sector(index), record)
+	return self.disk.ReadStructAt(self.get_file_position(index), record)
 }
 
 func (self *NtfsDisk) ReadFileRecordFromRef(ref data.FileRef, record *core.FileRecord) error {
@@ -118,8 +598,35 @@ func (self *NtfsDisk) GetAttributeValue(desc *core.AttributeDesc, read bool) (*c
 	return desc.GetValue(nil)
 }
 
+func (self *NtfsDisk) GetAttributePreview(desc *core.AttributeDesc, limit int) (*core.AttributeValue, error) {
+	return desc.GetValuePreview(self.disk, limit)
+}
+
 func (self *NtfsDisk) GetFileRecordFilename(record *core.FileRecord) (string, error) {
-	return record.GetFilename(self.disk)
+	name, err := record.GetFilename(self.disk)
+	if (err != nil) || (name != "") {
+		return name, err
+	}
+
+	// The names can be in the extension records
+	attrs, err := self.GetFileAttributes(record, core.ATTR_FILE_NAME)
+	if err != nil {
+		return "", err
+	}
+
+	for _, attr := range attrs {
+		value, err := attr.GetValue(nil)
+		if (err != nil) || (value == nil) {
+			continue
+		}
+
+		name = value.GetFilename()
+		if value.IsLongName() {
+			break
+		}
+	}
+
+	return name, nil
 }
 
 func (self *NtfsDisk) InitState(state IStateRecord) (bool, error) {
@@ -140,18 +647,33 @@ func (self *NtfsDisk) Close() error {
 	return nil
 }
 
+func NewNtfsDisk(disk *core.DiskIO, mft_shift int64) (*NtfsDisk, error) {
+	res := &NtfsDisk{
+		disk:      disk,
+		mft_shift: mft_shift,
+	}
+
+	if err := res.load_geometry(); err != nil {
+		return nil, err
+	}
+
+	if err := res.fill_runlist(); err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
 func OpenNtfsDisk(name string, mft_shift int64) (*NtfsDisk, error) {
 	data, err := core.OpenDisk(name)
 	if err != nil {
 		return nil, err
 	}
 
-	res := &NtfsDisk{
-		disk:      data,
-		mft_shift: mft_shift,
-	}
+	res, err := NewNtfsDisk(data, mft_shift)
+	if err != nil {
+		data.Close()
 
-	if err := res.fill_runlist(); err != nil {
 		return nil, err
 	}
 
@@ -0,0 +1,62 @@
+package inspect
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/corebreaker/ntfstool/core/data"
+)
+
+type tBaseKey struct {
+	mft string
+	ref data.FileRef
+}
+
+// Moves the attributes of the extension records into their base records, the attributes in several extents
+// are merged by starting VCN. The extension records are removed from the returned list, the extension records
+// without their base record are counted as orphans.
+func MergeExtensions(files []*StateFileRecord) ([]*StateFileRecord, int, int) {
+	bases := make(map[tBaseKey]*StateFileRecord)
+	extensions := make([]*StateFileRecord, 0)
+	res := make([]*StateFileRecord, 0, len(files))
+
+	for _, file := range files {
+		if file.IsExtension() {
+			extensions = append(extensions, file)
+
+			continue
+		}
+
+		bases[tBaseKey{file.MftId, file.Header.FileRef()}] = file
+		res = append(res, file)
+	}
+
+	sort.SliceStable(extensions, func(i, j int) bool {
+		return extensions[i].Header.MftRecordNumber < extensions[j].Header.MftRecordNumber
+	})
+
+	merged, orphans := 0, 0
+	extended := make(map[*StateFileRecord]bool)
+
+	for _, ext := range extensions {
+		base, ok := bases[tBaseKey{ext.MftId, ext.GetBaseRecord()}]
+		if !ok {
+			orphans++
+
+			continue
+		}
+
+		base.AddExtension(ext)
+		extended[base] = true
+		merged++
+	}
+
+	// A file with inconsistent extents keeps them unmerged
+	for base := range extended {
+		if err := base.merge_extents(); err != nil {
+			fmt.Println(fmt.Sprintf("Warning: the extents of the file at %d can not be merged: %v", base.Position, err))
+		}
+	}
+
+	return res, merged, orphans
+}
@@ -3,7 +3,6 @@ package inspect
 import (
 	"bytes"
 	"fmt"
-	"os"
 
 	"github.com/corebreaker/ntfstool/core"
 )
@@ -20,12 +19,12 @@ func has_done(indexes []int64) bool {
 	return true
 }
 
-func FindPositionsWithType(name string, rectype core.RecordType, rectypes ...core.RecordType) ([][]int64, error) {
+func get_type_patterns(rectype core.RecordType, rectypes []core.RecordType) ([]byte, [][]byte, error) {
 	patterns := make([][]byte, len(rectypes))
 	for i, t := range rectypes {
 		p, err := t.Bytes()
 		if err != nil {
-			return nil, err
+			return nil, nil, err
 		}
 
 		patterns[i] = p
@@ -33,36 +32,46 @@ func FindPositionsWithType(name string, rectype core.RecordType, rectypes ...cor
 
 	pattern, err := rectype.Bytes()
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
-	return FindPositionsWithPattern(name, pattern, patterns...)
+	return pattern, patterns, nil
 }
 
-func FindPositionsWithPattern(name string, pattern []byte, patterns ...[]byte) ([][]int64, error) {
-	fmt.Println("Preparation")
-
-	file, err := os.Open(name)
+func FindPositionsWithType(name string, rectype core.RecordType, rectypes ...core.RecordType) ([][]int64, error) {
+	pattern, patterns, err := get_type_patterns(rectype, rectypes)
 	if err != nil {
-		return nil, core.WrapError(err)
+		return nil, err
 	}
 
-	defer core.DeferedCall(file.Close)
+	return FindPositionsWithPattern(name, pattern, patterns...)
+}
 
-	info, err := file.Stat()
+func FindPositionsInDiskWithType(disk *core.DiskIO, rectype core.RecordType, rectypes ...core.RecordType) ([][]int64, error) {
+	pattern, patterns, err := get_type_patterns(rectype, rectypes)
 	if err != nil {
-		return nil, core.WrapError(err)
+		return nil, err
 	}
 
-	if info.IsDir() {
-		return nil, core.WrapError(fmt.Errorf("Path '%s' specifies a directory"))
-	}
+	return FindPositionsInDisk(disk, pattern, patterns...)
+}
 
-	size, err := file.Seek(0, os.SEEK_END)
+func FindPositionsWithPattern(name string, pattern []byte, patterns ...[]byte) ([][]int64, error) {
+	file, err := core.OpenDisk(name)
 	if err != nil {
-		return nil, core.WrapError(err)
+		return nil, err
 	}
 
+	defer core.DeferedCall(file.Close)
+
+	return FindPositionsInDisk(file, pattern, patterns...)
+}
+
+func FindPositionsInDisk(file *core.DiskIO, pattern []byte, patterns ...[]byte) ([][]int64, error) {
+	fmt.Println("Preparation")
+
+	size := file.GetSize()
+
 	p_count := len(patterns) + 1
 	pattern_list := make([][]byte, p_count)
 	copy(pattern_list[1:], patterns)
@@ -8,8 +8,19 @@ import (
 )
 
 func Scan(name string, destination *os.File) error {
+	disk, err := core.OpenDisk(name)
+	if err != nil {
+		return err
+	}
+
+	defer core.DeferedCall(disk.Close)
+
+	return ScanDisk(disk, destination)
+}
+
+func ScanDisk(disk *core.DiskIO, destination *os.File) error {
 	fmt.Println("Scanning...")
-	positions, err := FindPositionsWithType(name, core.RECTYP_FILE, core.RECTYP_INDX)
+	positions, err := FindPositionsInDiskWithType(disk, core.RECTYP_FILE, core.RECTYP_INDX)
 	if err != nil {
 		return err
 	}
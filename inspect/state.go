@@ -36,6 +36,7 @@ type IStateRecord interface {
 	GetAttribute(pos int64) *StateAttribute
 	GetAttributes(attr core.AttributeType, others ...core.AttributeType) []*StateAttribute
 	Init(disk *core.DiskIO) (bool, error)
+	GetTornSectors() []int64
 }
 
 type tNoneState struct {
@@ -48,6 +49,7 @@ func (self *tNoneState) GetMftId() string                   { return "" }
 func (self *tNoneState) SetMft(*StateMft)                   {}
 func (self *tNoneState) Init(*core.DiskIO) (bool, error)    { return true, nil }
 func (self *tNoneState) GetAttribute(int64) *StateAttribute { return nil }
+func (self *tNoneState) GetTornSectors() []int64            { return nil }
 
 func (self *tNoneState) GetAttributeDesc(*StateAttribute) (*core.AttributeDesc, error) {
 	return nil, core.WrapError(fmt.Errorf("This state has no attribute"))
@@ -83,11 +85,76 @@ func (self *StateBase) String() string {
 	return fmt.Sprintf("{STATEBASE: MFTID=%s Position=%d}", self.MftId, self.Position)
 }
 
+func get_torn_sectors(status *core.FixupStatus) []int64 {
+	if !status.IsTorn() {
+		return nil
+	}
+
+	res := make([]int64, len(status.Torn))
+	for i, sector := range status.Torn {
+		res[i] = int64(sector)
+	}
+
+	return res
+}
+
+// Reads a FILE or INDX record again to find its torn sectors, whatever the lenient mode of the disk,
+// the result is false if the record is not torn or if it is not a FILE or INDX record.
+func FindTornSectors(disk *core.DiskIO, record IStateRecord) ([]int64, bool, error) {
+	geometry := disk.GetGeometry()
+
+	var size int64
+	var record_type core.RecordType
+
+	switch record.GetType() {
+	case STATE_RECORD_TYPE_FILE:
+		size, record_type = geometry.RecordSize, core.RECTYP_FILE
+
+	case STATE_RECORD_TYPE_INDEX:
+		size, record_type = geometry.IndexSize, core.RECTYP_INDX
+
+	default:
+		return nil, false, nil
+	}
+
+	from := disk.Shift(0)
+	from.SetOffset(record.GetPosition())
+
+	buffer := make([]byte, size)
+	if _, err := from.ReadAt(buffer, 0); err != nil {
+		return nil, false, err
+	}
+
+	var header core.RecordHeader
+
+	if err := core.Read(buffer, &header); (err != nil) || (header.Type != record_type) {
+		return nil, false, nil
+	}
+
+	if record_size := core.FixupSize(&header); (record_size > size) && (record_size <= core.MAX_RECORD_SIZE) {
+		buffer = make([]byte, record_size)
+		if _, err := from.ReadAt(buffer, 0); err != nil {
+			return nil, false, err
+		}
+	}
+
+	status := core.ApplyFixups(buffer, true)
+
+	return get_torn_sectors(status), status.IsTorn(), nil
+}
+
 type StateAttribute struct {
 	BasePosition   int64
 	RecordPosition int64
 	Header         core.AttributeHeader
 	RunList        core.RunList
+	Extension      int64
+}
+
+// Hard link of a file: a name (not a DOS name) in a directory, in another $FILE_NAME than the one of the file name.
+type StateLink struct {
+	Name   string
+	Parent data.FileRef
 }
 
 type StateFileRecord struct {
@@ -99,6 +166,12 @@ type StateFileRecord struct {
 	Name       string
 	Names      []string
 	Attributes []*StateAttribute
+	Torn       []int64
+	Extensions []core.FileRecord
+	Links      []*StateLink
+
+	// Attributes rejected by the definitions of the volume with their position in the record, they are not saved
+	Rejected map[int]error
 }
 
 func (self *StateFileRecord) GetEncodingCode() string       { return "F" }
@@ -114,19 +187,25 @@ func (self *StateFileRecord) Print()                        { fmt.Println("[FILE
 
 func (self *StateFileRecord) Init(disk *core.DiskIO) (bool, error) {
 	disk.SetOffset(self.Position)
-	err := disk.ReadStruct(0, &self.Header)
+	status, err := disk.ReadRecordAt(0, &self.Header)
 	if err != nil {
 		return false, err
 	}
 
+	if self.Torn = get_torn_sectors(status); status.IsBroken() || (status.IsTorn() && !disk.IsLenient()) {
+		return false, nil
+	}
+
 	rec := &self.Header
 	header := &rec.RecordHeader
+	record_size := disk.GetGeometry().RecordSize
+	max_usa := uint16(record_size/512) + 1
 
-	if (header.Type != core.RECTYP_FILE) || (header.UsaCount > 3) || ((header.UsaOffset + (header.UsaCount * 2)) >= 1024) {
+	if (header.Type != core.RECTYP_FILE) || (header.UsaCount > max_usa) || (int64(header.UsaOffset+(header.UsaCount*2)) >= record_size) {
 		return false, nil
 	}
 
-	if (rec.BytesAllocated > 1024) || (rec.BytesInUse > 1024) || (rec.AttributesOffset >= 1024) {
+	if (int64(rec.BytesAllocated) > record_size) || (int64(rec.BytesInUse) > record_size) || (int64(rec.AttributesOffset) >= record_size) {
 		return false, nil
 	}
 
@@ -139,11 +218,13 @@ func (self *StateFileRecord) Init(disk *core.DiskIO) (bool, error) {
 		return false, nil
 	}
 
-	attributes, err := rec.GetAttributes(true)
+	attributes, rejected, err := rec.GetCheckedAttributes(disk.GetAttrDefs())
 	if err != nil {
 		return false, err
 	}
 
+	self.Rejected = rejected
+
 	sz := len(attributes)
 	if sz == 0 {
 		return false, nil
@@ -177,8 +258,70 @@ func (self *StateFileRecord) Init(disk *core.DiskIO) (bool, error) {
 	return true, nil
 }
 
+// True if a sector trailer of the record did not match the update sequence number.
+func (self *StateFileRecord) IsTorn() bool            { return len(self.Torn) > 0 }
+func (self *StateFileRecord) GetTornSectors() []int64 { return self.Torn }
+
+// An extension record holds the attributes of a file which do not fit in its base record.
+func (self *StateFileRecord) IsExtension() bool {
+	return self.Header.BaseFileRecord != 0
+}
+
+func (self *StateFileRecord) GetBaseRecord() data.FileRef {
+	return data.FileRef(self.Header.BaseFileRecord)
+}
+
 func (self *StateFileRecord) GetAttributeDesc(attr *StateAttribute) (*core.AttributeDesc, error) {
-	return self.Header.MakeAttributeFromHeader(&attr.Header)
+	record := &self.Header
+	if (attr.Extension > 0) && (attr.Extension <= int64(len(self.Extensions))) {
+		record = &self.Extensions[attr.Extension-1]
+	}
+
+	return record.MakeAttributeFromHeader(&attr.Header)
+}
+
+// Adds the attributes of an extension record.
+func (self *StateFileRecord) AddExtension(ext *StateFileRecord) {
+	self.Extensions = append(self.Extensions, ext.Header)
+	extension := int64(len(self.Extensions))
+
+	for _, attr := range ext.Attributes {
+		added := *attr
+		added.Extension = extension
+
+		self.Attributes = append(self.Attributes, &added)
+	}
+}
+
+// Merges the attributes in several extents, once all the extension records are added.
+func (self *StateFileRecord) merge_extents() error {
+	descs := make([]*core.AttributeDesc, len(self.Attributes))
+	states := make(map[*core.AttributeDesc]*StateAttribute)
+
+	for i, attr := range self.Attributes {
+		desc, err := self.GetAttributeDesc(attr)
+		if err != nil {
+			return err
+		}
+
+		descs[i] = desc
+		states[desc] = attr
+	}
+
+	merged, err := core.MergeAttributes(descs)
+	if err != nil {
+		return err
+	}
+
+	self.Attributes = make([]*StateAttribute, len(merged))
+	for i, desc := range merged {
+		attr := states[desc]
+		attr.RunList = desc.GetRunList()
+
+		self.Attributes[i] = attr
+	}
+
+	return nil
 }
 
 func (self *StateFileRecord) GetAttribute(pos int64) *StateAttribute {
@@ -242,6 +385,7 @@ type StateIndexRecord struct {
 	RecordRef data.FileRef
 	Header    core.IndexBlockHeader
 	Entries   []*StateDirEntry
+	Torn      []int64
 }
 
 func (self *StateIndexRecord) GetEncodingCode() string       { return "I" }
@@ -251,10 +395,11 @@ func (self *StateIndexRecord) GetHeader() *core.RecordHeader { return &self.Head
 func (self *StateIndexRecord) Print()                        { fmt.Println("[INDEX]"); core.PrintStruct(self) }
 
 func (self *StateIndexRecord) Init(disk *core.DiskIO) (bool, error) {
-	buffer := make([]byte, 4096)
+	index_size := disk.GetGeometry().IndexSize
+	buffer := make([]byte, index_size)
 
 	disk.SetOffset(self.Position)
-	if err := disk.ReadCluster(0, buffer); err != nil {
+	if _, err := disk.ReadAt(buffer, 0); err != nil {
 		return false, err
 	}
 
@@ -265,11 +410,18 @@ func (self *StateIndexRecord) Init(disk *core.DiskIO) (bool, error) {
 	record := &self.Header
 	hdr := &record.RecordHeader
 
-	if (hdr.Type != core.RECTYP_INDX) || (hdr.UsaCount > 9) || ((hdr.UsaOffset + (hdr.UsaCount * 2)) >= 4096) {
+	max_usa := uint16(index_size/512) + 1
+
+	if (hdr.Type != core.RECTYP_INDX) || (hdr.UsaCount > max_usa) || (int64(hdr.UsaOffset+(hdr.UsaCount*2)) >= index_size) {
 		return false, nil
 	}
 
-	if record.DirectoryIndex.EntriesOffset >= 4096 {
+	status := core.ApplyFixups(buffer, disk.IsLenient())
+	if self.Torn = get_torn_sectors(status); status.IsBroken() || (status.IsTorn() && !disk.IsLenient()) {
+		return false, nil
+	}
+
+	if int64(record.DirectoryIndex.EntriesOffset) >= index_size {
 		return false, nil
 	}
 
@@ -307,6 +459,9 @@ func (self *StateIndexRecord) Init(disk *core.DiskIO) (bool, error) {
 	return true, nil
 }
 
+func (self *StateIndexRecord) IsTorn() bool            { return len(self.Torn) > 0 }
+func (self *StateIndexRecord) GetTornSectors() []int64 { return self.Torn }
+
 func (self *StateIndexRecord) String() string {
 	const msg = "{<Index> at %d [MFT:%s] for file %s}"
 
@@ -337,9 +492,11 @@ func (self *StateIndexRecord) UnmarshalBinary(data []byte) error {
 type StateMft struct {
 	StateBase
 
-	Header     core.FileRecord
-	RunList    core.RunList
-	PartOrigin int64
+	Header      core.FileRecord
+	RunList     core.RunList
+	PartOrigin  int64
+	ClusterSize int64
+	RecordSize  int64
 }
 
 func (self *StateMft) GetEncodingCode() string       { return "M" }
@@ -353,36 +510,58 @@ func (self *StateMft) Init(disk *core.DiskIO) (bool, error) {
 		self.MftId = core.NewFileId()
 	}
 
+	geometry := disk.GetGeometry()
+
+	if self.ClusterSize == 0 {
+		self.ClusterSize = geometry.ClusterSize
+	}
+
+	if self.RecordSize == 0 {
+		self.RecordSize = geometry.RecordSize
+	}
+
 	return true, nil
 }
 
+func (self *StateMft) GetGeometry() *core.Geometry {
+	return core.DefaultGeometry().Merge(&core.Geometry{
+		ClusterSize: self.ClusterSize,
+		RecordSize:  self.RecordSize,
+	})
+}
+
 func (self *StateMft) GetReference(file *StateFileRecord) data.FileRef {
+	geometry := self.GetGeometry()
 	fpos := file.Position - self.PartOrigin
 
 	vidx := int64(0)
 	for _, run := range self.RunList {
-		start, end := int64(run.Start)*0x1000, int64(run.GetNext())*0x1000
+		start, end := int64(run.Start)*geometry.ClusterSize, int64(run.GetNext())*geometry.ClusterSize
 
 		if (start <= fpos) && (fpos < end) {
-			if uint32((vidx+(fpos-start))/1024) != file.Header.MftRecordNumber {
+			if uint32((vidx+(fpos-start))/geometry.RecordSize) != file.Header.MftRecordNumber {
 				return data.FileRef(0)
 			}
 
 			return file.Header.FileRef()
 		}
 
-		vidx += int64(run.Count) * 0x1000
+		vidx += int64(run.Count) * geometry.ClusterSize
 	}
 
 	return data.FileRef(0)
 }
 
+func (self *StateMft) GetStart() int64 {
+	return self.PartOrigin + (int64(self.RunList[0].Start) * self.GetGeometry().ClusterSize)
+}
+
 func (self *StateMft) IsMft() bool {
-	return (self.PartOrigin + (int64(self.RunList[0].Start) * 4096)) == self.Position
+	return self.GetStart() == self.Position
 }
 
 func (self *StateMft) IsMirror(disk *NtfsDisk) (bool, error) {
-	return (self.PartOrigin + (int64(self.RunList[0].Start) * 4096)) == self.Position, nil
+	return self.GetStart() == self.Position, nil
 }
 
 func (self *StateMft) String() string {
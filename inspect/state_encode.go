@@ -71,7 +71,7 @@ func (self *tFileRecord) from(src *core.FileRecord) *tFileRecord {
 }
 
 func (self *tFileRecord) to(dest *core.FileRecord) *core.FileRecord {
-	*dest = core.FileRecord{
+	dest.FileRecordHeader = core.FileRecordHeader{
 		SequenceNumber:      uint16(self.SequenceNumber),
 		LinkCount:           uint16(self.LinkCount),
 		AttributesOffset:    uint16(self.AttributesOffset),
@@ -82,9 +82,9 @@ func (self *tFileRecord) to(dest *core.FileRecord) *core.FileRecord {
 		NextAttributeNumber: uint16(self.NextAttributeNumber),
 		Reserved:            uint16(self.Reserved),
 		MftRecordNumber:     self.MftRecordNumber,
-		Data:                self.Data,
 	}
 
+	dest.Data = self.Data
 	self.tRecordHeader.to(&dest.RecordHeader)
 
 	return dest
@@ -281,6 +281,7 @@ type tStateAttribute struct {
 	RecordPosition int64
 	Header         tAttributeHeader
 	RunList        core.RunList
+	Extension      int64
 }
 
 func (self *tStateAttribute) from(src *StateAttribute) *tStateAttribute {
@@ -288,6 +289,7 @@ func (self *tStateAttribute) from(src *StateAttribute) *tStateAttribute {
 		BasePosition:   src.BasePosition,
 		RecordPosition: src.RecordPosition,
 		RunList:        src.RunList,
+		Extension:      src.Extension,
 	}
 
 	self.Header.from(&src.Header)
@@ -300,6 +302,7 @@ func (self *tStateAttribute) to(dest *StateAttribute) *StateAttribute {
 		BasePosition:   self.BasePosition,
 		RecordPosition: self.RecordPosition,
 		RunList:        self.RunList,
+		Extension:      self.Extension,
 	}
 
 	self.Header.to(&dest.Header)
@@ -347,6 +350,7 @@ type tStateIndexRecord struct {
 	RecordRef data.FileRef
 	Header    tIndexBlockHeader
 	Entries   []*tStateDirEntry
+	Torn      []int64
 }
 
 func (self *tStateIndexRecord) from(src *StateIndexRecord) *tStateIndexRecord {
@@ -358,6 +362,7 @@ func (self *tStateIndexRecord) from(src *StateIndexRecord) *tStateIndexRecord {
 	*self = tStateIndexRecord{
 		RecordRef: src.RecordRef,
 		Entries:   entries,
+		Torn:      src.Torn,
 	}
 
 	self.tStateBase.from(&src.StateBase)
@@ -375,6 +380,7 @@ func (self *tStateIndexRecord) to(dest *StateIndexRecord) *StateIndexRecord {
 	*dest = StateIndexRecord{
 		RecordRef: self.RecordRef,
 		Entries:   entries,
+		Torn:      self.Torn,
 	}
 
 	self.tStateBase.to(&dest.StateBase)
@@ -392,6 +398,9 @@ type tStateFileRecord struct {
 	Reference  data.FileRef
 	Parent     data.FileRef
 	Attributes []*tStateAttribute
+	Torn       []int64
+	Extensions []*tFileRecord
+	Links      []*StateLink
 }
 
 func (self *tStateFileRecord) from(src *StateFileRecord) *tStateFileRecord {
@@ -400,12 +409,20 @@ func (self *tStateFileRecord) from(src *StateFileRecord) *tStateFileRecord {
 		attributes[i] = new(tStateAttribute).from(attr)
 	}
 
+	extensions := make([]*tFileRecord, len(src.Extensions))
+	for i := range src.Extensions {
+		extensions[i] = new(tFileRecord).from(&src.Extensions[i])
+	}
+
 	*self = tStateFileRecord{
 		Name:       src.Name,
 		Names:      src.Names,
 		Reference:  src.Reference,
 		Parent:     src.Parent,
 		Attributes: attributes,
+		Torn:       src.Torn,
+		Extensions: extensions,
+		Links:      src.Links,
 	}
 
 	self.Header.from(&src.Header)
@@ -420,12 +437,24 @@ func (self *tStateFileRecord) to(dest *StateFileRecord) *StateFileRecord {
 		attributes[i] = attr.to(new(StateAttribute))
 	}
 
+	var extensions []core.FileRecord
+
+	if len(self.Extensions) > 0 {
+		extensions = make([]core.FileRecord, len(self.Extensions))
+		for i, ext := range self.Extensions {
+			ext.to(&extensions[i])
+		}
+	}
+
 	*dest = StateFileRecord{
 		Name:       self.Name,
 		Names:      self.Names,
 		Reference:  self.Reference,
 		Parent:     self.Parent,
 		Attributes: attributes,
+		Torn:       self.Torn,
+		Extensions: extensions,
+		Links:      self.Links,
 	}
 
 	self.Header.to(&dest.Header)
@@ -437,15 +466,19 @@ func (self *tStateFileRecord) to(dest *StateFileRecord) *StateFileRecord {
 type tStateMft struct {
 	tStateBase
 
-	Header     tFileRecord
-	RunList    core.RunList
-	PartOrigin int64
+	Header      tFileRecord
+	RunList     core.RunList
+	PartOrigin  int64
+	ClusterSize int64
+	RecordSize  int64
 }
 
 func (self *tStateMft) from(src *StateMft) *tStateMft {
 	*self = tStateMft{
-		RunList:    src.RunList,
-		PartOrigin: src.PartOrigin,
+		RunList:     src.RunList,
+		PartOrigin:  src.PartOrigin,
+		ClusterSize: src.ClusterSize,
+		RecordSize:  src.RecordSize,
 	}
 
 	self.tStateBase.from(&src.StateBase)
@@ -456,8 +489,10 @@ func (self *tStateMft) from(src *StateMft) *tStateMft {
 
 func (self *tStateMft) to(dest *StateMft) *StateMft {
 	*dest = StateMft{
-		RunList:    self.RunList,
-		PartOrigin: self.PartOrigin,
+		RunList:     self.RunList,
+		PartOrigin:  self.PartOrigin,
+		ClusterSize: self.ClusterSize,
+		RecordSize:  self.RecordSize,
 	}
 
 	self.tStateBase.to(&dest.StateBase)
@@ -4,19 +4,32 @@ import (
 	"fmt"
 	"os"
 	"os/signal"
+	"sync"
 
 	ntfs "github.com/corebreaker/ntfstool/core"
 )
 
-var _stk [100]error
+var (
+	_stk [100]error
+
+	_interrupt_handlers = make(map[int]func())
+	_interrupt_mutex    sync.Mutex
+	_interrupt_next     int
+)
 
 func init() {
-	s := make(chan os.Signal)
+	s := make(chan os.Signal, 1)
 	signal.Notify(s, os.Interrupt)
 
 	go func() {
 		<-s
 
+		_interrupt_mutex.Lock()
+		for _, handler := range _interrupt_handlers {
+			handler()
+		}
+		_interrupt_mutex.Unlock()
+
 		for _, x := range _stk {
 			if x == nil {
 				continue
@@ -37,3 +50,20 @@ func addstep(msg string, a ...interface{}) {
 	copy(_stk[1:], _stk[:])
 	_stk[0] = ntfs.WrapError(fmt.Errorf(msg, a...))
 }
+
+// Registers a handler called before the exit on an interruption, the returned function unregisters it.
+func on_interrupt(handler func()) func() {
+	_interrupt_mutex.Lock()
+	defer _interrupt_mutex.Unlock()
+
+	id := _interrupt_next
+	_interrupt_next++
+	_interrupt_handlers[id] = handler
+
+	return func() {
+		_interrupt_mutex.Lock()
+		defer _interrupt_mutex.Unlock()
+
+		delete(_interrupt_handlers, id)
+	}
+}
@@ -10,28 +10,72 @@ import (
 	"github.com/corebreaker/ntfstool/extract"
 )
 
+// Prefix of the parts of a node pattern which filter by owner, with the SID or the name of a well-known owner.
+const OWNER_PATTERN_PREFIX = "owner:"
+
 type tNodePattern struct {
 	tree  *extract.Tree
 	root  *extract.Node
 	ids   map[string]bool
 	globs []glob.Glob
+
+	// The owner filters restrict the files matched by the other parts of the pattern
+	owners []glob.Glob
+
+	// Upper case table for the case-insensitive matching of the names, nil to match them exactly
+	upcase ntfs.UpCase
+}
+
+func (np *tNodePattern) matchOwner(file *extract.File) bool {
+	if len(np.owners) == 0 {
+		return true
+	}
+
+	if file.Security == nil {
+		return false
+	}
+
+	for _, g := range np.owners {
+		if file.Security.MatchOwner(g.Match) {
+			return true
+		}
+	}
+
+	return false
 }
 
 func (np *tNodePattern) Match(file *extract.File) bool {
-	if file.Id == "" {
+	if (file.Id == "") || !np.matchOwner(file) {
 		return false
 	}
 
+	// A pattern with only owner filters matches all the files of the owners
+	if (len(np.ids) == 0) && (len(np.globs) == 0) {
+		return true
+	}
+
 	if np.ids[file.Id] {
 		return true
 	}
 
-	name := file.Name
-	path := np.tree.GetFilePath(file)
+	// A file with hard links is matched by the names and the paths of all its links
+	names := []string{file.Name}
+	for _, link := range file.Links {
+		names = append(names, link.Name)
+	}
+
+	names = append(names, np.tree.GetFilePaths(file)...)
+	if np.upcase != nil {
+		for i, name := range names {
+			names[i] = np.upcase.ToUpper(name)
+		}
+	}
 
 	for _, g := range np.globs {
-		if g.Match(name) || g.Match(path) {
-			return true
+		for _, name := range names {
+			if g.Match(name) {
+				return true
+			}
 		}
 	}
 
@@ -60,13 +104,37 @@ func (np *tNodePattern) GetNodes(from *extract.Node) map[string]*extract.Node {
 	return res
 }
 
-func parseNodePattern(src string, tree *extract.Tree) (*tNodePattern, error) {
+// Upper case table used by the node patterns, only with the `nocase` option.
+func get_pattern_upcase(arg *tActionArg) ntfs.UpCase {
+	if _, ok := arg.GetExt("nocase"); !ok {
+		return nil
+	}
+
+	return get_upcase(arg)
+}
+
+func parseNodePattern(src string, tree *extract.Tree, upcase ntfs.UpCase) (*tNodePattern, error) {
 	parts := strings.Split(src, ",")
 	ids := make(map[string]bool)
 
-	var globs []glob.Glob
+	var globs, owners []glob.Glob
 
 	for _, part := range parts {
+		if len(part) == 0 {
+			continue
+		}
+
+		if strings.HasPrefix(part, OWNER_PATTERN_PREFIX) {
+			g, err := glob.Compile(part[len(OWNER_PATTERN_PREFIX):])
+			if err != nil {
+				return nil, ntfs.WrapError(err)
+			}
+
+			owners = append(owners, g)
+
+			continue
+		}
+
 		if part[0] == '@' {
 			id := part[1:]
 			if _, err := hex.DecodeString(id); err != nil {
@@ -78,6 +146,10 @@ func parseNodePattern(src string, tree *extract.Tree) (*tNodePattern, error) {
 			continue
 		}
 
+		if upcase != nil {
+			part = upcase.ToUpper(part)
+		}
+
 		g, err := glob.Compile(part)
 		if err != nil {
 			return nil, ntfs.WrapError(err)
@@ -87,9 +159,11 @@ func parseNodePattern(src string, tree *extract.Tree) (*tNodePattern, error) {
 	}
 
 	res := &tNodePattern{
-		tree:  tree,
-		ids:   ids,
-		globs: globs,
+		tree:   tree,
+		ids:    ids,
+		globs:  globs,
+		owners: owners,
+		upcase: upcase,
 		root: &extract.Node{
 			File:     new(extract.File),
 			Children: tree.Roots,